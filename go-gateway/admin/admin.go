@@ -0,0 +1,239 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sen-golang-study/go-gateway/load_balance"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Route 网关的一条路由，Upstreams 为空表示路由没有可管理的下游
+type Route struct {
+	Name      string
+	Protocol  string // http、tcp、grpc
+	Match     string // 路径前缀、监听地址或方法名
+	Upstreams load_balance.Manager
+}
+
+// Server 管理接口：查看路由和下游状态、摘除和恢复下游、查看和断开 TCP 连接、调整日志级别、查看生效的配置
+//
+// 所有接口都要求请求头 Authorization: Bearer <Token>，响应均为 JSON
+//
+//	GET    /routes                     路由及下游状态
+//	POST   /upstreams/{addr}/drain     摘除下游，所有包含该下游的路由都不再分配新请求
+//	POST   /upstreams/{addr}/enable    恢复下游
+//	GET    /tcp/connections            TCP 活跃连接
+//	DELETE /tcp/connections/{id}       断开 TCP 连接
+//	GET    /log/level                  当前日志级别
+//	PUT    /log/level                  修改日志级别，请求体 {"level":"debug"}
+//	GET    /config                     生效的配置
+type Server struct {
+	token    string
+	logLevel *slog.LevelVar
+	mux      *http.ServeMux
+
+	mu         sync.RWMutex
+	routes     []Route
+	tcpServers map[string]*tcp_proxy.TCPServer
+	config     func() any
+}
+
+// NewServer 新建管理接口，token 为空时拒绝所有请求；logLevel 为 slog 默认 Handler 使用的级别变量
+func NewServer(token string, logLevel *slog.LevelVar) *Server {
+	s := &Server{token: token, logLevel: logLevel, mux: http.NewServeMux(), tcpServers: make(map[string]*tcp_proxy.TCPServer)}
+	s.mux.HandleFunc("GET /routes", s.listRoutes)
+	s.mux.HandleFunc("POST /upstreams/{addr}/drain", s.setDrained(true))
+	s.mux.HandleFunc("POST /upstreams/{addr}/enable", s.setDrained(false))
+	s.mux.HandleFunc("GET /tcp/connections", s.listConns)
+	s.mux.HandleFunc("DELETE /tcp/connections/{id}", s.closeConn)
+	s.mux.HandleFunc("GET /log/level", s.getLogLevel)
+	s.mux.HandleFunc("PUT /log/level", s.setLogLevel)
+	s.mux.HandleFunc("GET /config", s.dumpConfig)
+	return s
+}
+
+// AddRoute 登记路由
+func (s *Server) AddRoute(routes ...Route) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append(s.routes, routes...)
+}
+
+// AddTCPServer 登记 TCP 服务，以便查看和断开它的连接
+func (s *Server) AddTCPServer(name string, srv *tcp_proxy.TCPServer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tcpServers[name] = srv
+}
+
+// SetConfig 设置返回生效配置的函数，返回值按 JSON 输出，注意不要包含密钥
+func (s *Server) SetConfig(config func() any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+}
+
+// Handle 在管理端口上挂载其他接口，如 /metrics，同样需要认证
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, "invalid admin token")
+		return
+	}
+	s.mux.ServeHTTP(w, req)
+}
+
+type routeInfo struct {
+	Name      string                  `json:"name"`
+	Protocol  string                  `json:"protocol"`
+	Match     string                  `json:"match"`
+	Upstreams []load_balance.Upstream `json:"upstreams"`
+}
+
+func (s *Server) listRoutes(w http.ResponseWriter, req *http.Request) {
+	s.mu.RLock()
+	routes := make([]routeInfo, len(s.routes))
+	for i, r := range s.routes {
+		routes[i] = routeInfo{Name: r.Name, Protocol: r.Protocol, Match: r.Match, Upstreams: []load_balance.Upstream{}}
+		if r.Upstreams != nil {
+			routes[i].Upstreams = r.Upstreams.Upstreams()
+		}
+	}
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, routes)
+}
+
+func (s *Server) setDrained(drained bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		addr := req.PathValue("addr")
+		s.mu.RLock()
+		// 同一个负载均衡器可能被多条路由共用
+		affected := []string{}
+		found := make(map[load_balance.Manager]bool)
+		for _, r := range s.routes {
+			if r.Upstreams == nil {
+				continue
+			}
+			ok, done := found[r.Upstreams]
+			if !done {
+				ok = !errors.Is(r.Upstreams.SetDrained(addr, drained), load_balance.ErrUnknownServer)
+				found[r.Upstreams] = ok
+			}
+			if ok {
+				affected = append(affected, r.Name)
+			}
+		}
+		s.mu.RUnlock()
+		if len(affected) == 0 {
+			writeError(w, http.StatusNotFound, "unknown upstream "+addr)
+			return
+		}
+		slog.Info("admin: upstream drained state changed", "upstream", addr, "drained", drained, "routes", affected)
+		writeJSON(w, http.StatusOK, map[string]any{"upstream": addr, "drained": drained, "routes": affected})
+	}
+}
+
+type connInfo struct {
+	Server string `json:"server"`
+	tcp_proxy.ConnInfo
+}
+
+func (s *Server) listConns(w http.ResponseWriter, req *http.Request) {
+	s.mu.RLock()
+	conns := []connInfo{}
+	for name, srv := range s.tcpServers {
+		for _, c := range srv.Conns() {
+			conns = append(conns, connInfo{Server: name, ConnInfo: c})
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(conns, func(i, j int) bool {
+		if conns[i].Server != conns[j].Server {
+			return conns[i].Server < conns[j].Server
+		}
+		return conns[i].ID < conns[j].ID
+	})
+	writeJSON(w, http.StatusOK, conns)
+}
+
+// closeConn 断开连接，多个 TCP 服务时用 ?server=<name> 指定服务
+func (s *Server) closeConn(w http.ResponseWriter, req *http.Request) {
+	id, err := strconv.ParseUint(req.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid connection id")
+		return
+	}
+	server := req.URL.Query().Get("server")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if server == "" && len(s.tcpServers) > 1 {
+		writeError(w, http.StatusBadRequest, "server is required when multiple tcp servers are registered")
+		return
+	}
+	for name, srv := range s.tcpServers {
+		if (server == "" || server == name) && srv.CloseConn(id) {
+			slog.Info("admin: tcp connection closed", "server", name, "id", id)
+			writeJSON(w, http.StatusOK, map[string]any{"server": name, "id": id, "closed": true})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "connection not found")
+}
+
+func (s *Server) getLogLevel(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"level": s.logLevel.Level().String()})
+}
+
+func (s *Server) setLogLevel(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<10)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(body.Level)); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid level "+strconv.Quote(body.Level))
+		return
+	}
+	old := s.logLevel.Level()
+	s.logLevel.Set(level)
+	slog.Warn("admin: log level changed", "from", old, "to", level)
+	writeJSON(w, http.StatusOK, map[string]string{"level": level.String()})
+}
+
+func (s *Server) dumpConfig(w http.ResponseWriter, req *http.Request) {
+	s.mu.RLock()
+	config := s.config
+	s.mu.RUnlock()
+	if config == nil {
+		writeJSON(w, http.StatusOK, map[string]any{})
+		return
+	}
+	writeJSON(w, http.StatusOK, config())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
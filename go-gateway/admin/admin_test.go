@@ -0,0 +1,198 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sen-golang-study/go-gateway/load_balance"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const token = "secret"
+
+// do 带 token 发送请求，返回状态码和解析后的 JSON
+func do(t *testing.T, s *Server, method, path, body string, out any) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("%s %s: want json, got %q", method, path, ct)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+// TestAuth 测试缺少或错误的 token 被拒绝
+func TestAuth(t *testing.T) {
+	for _, s := range []*Server{NewServer(token, new(slog.LevelVar)), NewServer("", new(slog.LevelVar))} {
+		for _, header := range []string{"", "Bearer wrong", token, "Bearer "} {
+			req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), `"error"`) {
+				t.Errorf("want 401 for %q, got %d %s", header, rec.Code, rec.Body)
+			}
+		}
+	}
+}
+
+// TestDrain 测试摘除下游后不再被选中，并作用于所有包含该下游的路由
+func TestDrain(t *testing.T) {
+	s := NewServer(token, new(slog.LevelVar))
+	shared := load_balance.NewRoundRobinBalance("127.0.0.1:2003", "127.0.0.1:2004")
+	other := load_balance.NewRandomBalance("127.0.0.1:2004", "127.0.0.1:2005")
+	s.AddRoute(
+		Route{Name: "order", Protocol: "http", Match: "/order", Upstreams: shared},
+		Route{Name: "order-v2", Protocol: "http", Match: "/v2/order", Upstreams: shared},
+		Route{Name: "product", Protocol: "http", Match: "/product", Upstreams: other},
+		Route{Name: "static", Protocol: "http", Match: "/"},
+	)
+
+	var result struct {
+		Routes []string `json:"routes"`
+	}
+	if code := do(t, s, http.MethodPost, "/upstreams/127.0.0.1:2004/drain", "", &result); code != http.StatusOK ||
+		strings.Join(result.Routes, ",") != "order,order-v2,product" {
+		t.Fatalf("drain got %d %v", code, result.Routes)
+	}
+	for i := 0; i < 10; i++ {
+		if addr, _ := shared.Get(""); addr != "127.0.0.1:2003" {
+			t.Fatalf("want drained upstream skipped, got %s", addr)
+		}
+	}
+
+	var routes []routeInfo
+	do(t, s, http.MethodGet, "/routes", "", &routes)
+	if len(routes) != 4 || !routes[0].Upstreams[1].Drained || routes[0].Upstreams[0].Drained || len(routes[3].Upstreams) != 0 {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+
+	if code := do(t, s, http.MethodPost, "/upstreams/127.0.0.1:2004/enable", "", nil); code != http.StatusOK {
+		t.Errorf("enable got %d", code)
+	}
+	if upstreams := other.Upstreams(); upstreams[0].Drained {
+		t.Errorf("want upstream enabled, got %+v", upstreams)
+	}
+	if code := do(t, s, http.MethodPost, "/upstreams/127.0.0.1:9999/drain", "", nil); code != http.StatusNotFound {
+		t.Errorf("want 404 for unknown upstream, got %d", code)
+	}
+}
+
+// TestHealthCheck 测试健康检查连续失败后摘除下游，所有下游都不可用时 Get 返回错误
+func TestHealthCheck(t *testing.T) {
+	rb := load_balance.NewRoundRobinBalance("a:1", "b:1")
+	checker := load_balance.NewHealthChecker(rb, time.Hour)
+	checker.Check = func(ctx context.Context, addr string) error {
+		if addr == "a:1" {
+			return nil
+		}
+		return context.DeadlineExceeded
+	}
+	checker.CheckAll()
+	if upstreams := rb.Upstreams(); !upstreams[1].Healthy {
+		t.Fatalf("want healthy before reaching threshold, got %+v", upstreams)
+	}
+	checker.CheckAll()
+	if upstreams := rb.Upstreams(); upstreams[1].Healthy || !upstreams[0].Healthy {
+		t.Fatalf("want b:1 unhealthy, got %+v", upstreams)
+	}
+	rb.SetDrained("a:1", true)
+	if _, err := rb.Get(""); err == nil {
+		t.Errorf("want error when no upstream available")
+	}
+}
+
+// TestTCPConnections 测试查看和断开 TCP 连接
+func TestTCPConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan struct{})
+	srv := &tcp_proxy.TCPServer{Handler: tcpHandlerFunc(func(ctx context.Context, conn net.Conn) {
+		<-ctx.Done()
+		close(closed)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	s := NewServer(token, new(slog.LevelVar))
+	s.AddTCPServer("tcp", srv)
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var conns []connInfo
+	for deadline := time.Now().Add(time.Second); len(conns) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		do(t, s, http.MethodGet, "/tcp/connections", "", &conns)
+	}
+	if len(conns) != 1 || conns[0].Server != "tcp" || conns[0].RemoteAddr != client.LocalAddr().String() {
+		t.Fatalf("unexpected connections %+v", conns)
+	}
+
+	if code := do(t, s, http.MethodDelete, "/tcp/connections/abc", "", nil); code != http.StatusBadRequest {
+		t.Errorf("want 400 for invalid id, got %d", code)
+	}
+	path := "/tcp/connections/" + strconv.FormatUint(conns[0].ID, 10)
+	if code := do(t, s, http.MethodDelete, path, "", nil); code != http.StatusOK {
+		t.Fatalf("close got %d", code)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("want handler context canceled")
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Error("want client connection closed")
+	}
+	if code := do(t, s, http.MethodDelete, path, "", nil); code != http.StatusNotFound {
+		t.Errorf("want 404 for closed connection, got %d", code)
+	}
+}
+
+// TestLogLevelAndConfig 测试调整日志级别和查看配置
+func TestLogLevelAndConfig(t *testing.T) {
+	level := new(slog.LevelVar)
+	s := NewServer(token, level)
+	s.SetConfig(func() any { return map[string]any{"http_addr": ":8080"} })
+
+	var got map[string]string
+	if code := do(t, s, http.MethodPut, "/log/level", `{"level":"debug"}`, &got); code != http.StatusOK ||
+		got["level"] != "DEBUG" || level.Level() != slog.LevelDebug {
+		t.Errorf("set level got %d %v, level %v", code, got, level.Level())
+	}
+	if code := do(t, s, http.MethodPut, "/log/level", `{"level":"verbose"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("want 400 for invalid level, got %d", code)
+	}
+	do(t, s, http.MethodGet, "/log/level", "", &got)
+	if got["level"] != "DEBUG" {
+		t.Errorf("want DEBUG, got %v", got)
+	}
+	do(t, s, http.MethodGet, "/config", "", &got)
+	if got["http_addr"] != ":8080" {
+		t.Errorf("unexpected config %v", got)
+	}
+}
+
+type tcpHandlerFunc func(ctx context.Context, conn net.Conn)
+
+func (f tcpHandlerFunc) Serve(ctx context.Context, conn net.Conn) { f(ctx, conn) }
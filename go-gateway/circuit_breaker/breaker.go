@@ -0,0 +1,247 @@
+package circuit_breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOpen 熔断器处于打开状态，请求被直接拒绝
+	ErrOpen = errors.New("circuit_breaker: circuit is open")
+	// ErrTooManyTrials 熔断器处于半开状态，试探请求数已达上限
+	ErrTooManyTrials = errors.New("circuit_breaker: too many half-open trial requests")
+)
+
+// State 熔断器状态
+type State int32
+
+const (
+	StateClosed   State = iota // 关闭：请求正常通过，统计错误率和慢调用率
+	StateOpen                  // 打开：请求直接失败，等待 OpenDuration 后进入半开
+	StateHalfOpen              // 半开：只放行有限的试探请求，全部成功则关闭，任一失败则重新打开
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Config 熔断配置
+type Config struct {
+	Window                time.Duration // 统计窗口
+	Buckets               int           // 统计窗口划分的桶数
+	MinRequests           int           // 窗口内请求数达到该值才判断是否熔断
+	ErrorRateThreshold    float64       // 错误率阈值，如 0.5
+	SlowCallThreshold     time.Duration // 耗时超过该值算作慢调用
+	SlowCallRateThreshold float64       // 慢调用率阈值，0 表示不按慢调用熔断
+	OpenDuration          time.Duration // 打开状态持续时间
+	HalfOpenMaxRequests   int           // 半开状态允许的试探请求数，不大于 0 时为 1
+}
+
+// DefaultConfig 默认熔断配置
+func DefaultConfig() Config {
+	return Config{
+		Window:                10 * time.Second,
+		Buckets:               10,
+		MinRequests:           20,
+		ErrorRateThreshold:    0.5,
+		SlowCallThreshold:     time.Second,
+		SlowCallRateThreshold: 0.8,
+		OpenDuration:          5 * time.Second,
+		HalfOpenMaxRequests:   3,
+	}
+}
+
+// StateChange 熔断器状态变化事件
+type StateChange struct {
+	Name string
+	From State
+	To   State
+	At   time.Time
+}
+
+// Breaker 熔断器
+type Breaker struct {
+	name     string
+	config   Config
+	onChange func(StateChange)
+
+	mu         sync.Mutex
+	state      State
+	generation uint64 // 每次状态变化加一，丢弃状态变化前发出的请求结果
+	openedAt   time.Time
+	buckets    []bucket
+	trials     int           // 半开状态下已放行的试探请求数
+	successes  int           // 半开状态下成功的试探请求数
+	pending    []StateChange // 待通知的状态变化，解锁后按顺序回调
+	now        func() time.Time
+}
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+	slow     int
+}
+
+// NewBreaker 新建熔断器，onChange 为状态变化回调，可为空
+func NewBreaker(name string, config Config, onChange func(StateChange)) *Breaker {
+	if config.Buckets <= 0 {
+		config.Buckets = 1
+	}
+	// 不允许试探请求时半开状态永远无法关闭
+	if config.HalfOpenMaxRequests <= 0 {
+		config.HalfOpenMaxRequests = 1
+	}
+	return &Breaker{
+		name:     name,
+		config:   config,
+		onChange: onChange,
+		buckets:  make([]bucket, config.Buckets),
+		now:      time.Now,
+	}
+}
+
+// Name 熔断器名称，通常为下游地址或路由
+func (b *Breaker) Name() string { return b.name }
+
+// State 返回当前状态，打开状态到期时会转为半开
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.unlock()
+	b.checkOpenExpired(b.now())
+	return b.state
+}
+
+// Allow 判断请求能否通过，通过时返回的 done 必须在请求结束后调用一次，记录结果和耗时
+func (b *Breaker) Allow() (done func(success bool, latency time.Duration), err error) {
+	b.mu.Lock()
+	defer b.unlock()
+	now := b.now()
+	b.checkOpenExpired(now)
+	switch b.state {
+	case StateOpen:
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if b.trials >= b.config.HalfOpenMaxRequests {
+			return nil, ErrTooManyTrials
+		}
+		b.trials++
+	}
+	generation := b.generation
+	return func(success bool, latency time.Duration) {
+		b.record(generation, success, latency)
+	}, nil
+}
+
+func (b *Breaker) record(generation uint64, success bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.unlock()
+	if generation != b.generation {
+		return
+	}
+	now := b.now()
+	slow := b.config.SlowCallThreshold > 0 && latency >= b.config.SlowCallThreshold
+
+	switch b.state {
+	case StateHalfOpen:
+		if !success || (slow && b.config.SlowCallRateThreshold > 0) {
+			b.setState(StateOpen, now)
+			return
+		}
+		if b.successes++; b.successes >= b.config.HalfOpenMaxRequests {
+			b.setState(StateClosed, now)
+		}
+	case StateClosed:
+		cur := b.current(now)
+		cur.total++
+		if !success {
+			cur.failures++
+		}
+		if slow {
+			cur.slow++
+		}
+		if b.shouldOpen(now) {
+			b.setState(StateOpen, now)
+		}
+	}
+}
+
+// shouldOpen 窗口内请求数达到下限，且错误率或慢调用率超过阈值
+func (b *Breaker) shouldOpen(now time.Time) bool {
+	var total, failures, slow int
+	windowStart := now.Add(-b.config.Window)
+	for _, bk := range b.buckets {
+		if bk.start.After(windowStart) {
+			total += bk.total
+			failures += bk.failures
+			slow += bk.slow
+		}
+	}
+	if total == 0 || total < b.config.MinRequests {
+		return false
+	}
+	if b.config.ErrorRateThreshold > 0 && float64(failures)/float64(total) >= b.config.ErrorRateThreshold {
+		return true
+	}
+	return b.config.SlowCallRateThreshold > 0 && float64(slow)/float64(total) >= b.config.SlowCallRateThreshold
+}
+
+// current 返回当前时间所在的桶，桶已过期时清零复用
+func (b *Breaker) current(now time.Time) *bucket {
+	width := b.config.Window / time.Duration(len(b.buckets))
+	if width <= 0 {
+		width = time.Second
+	}
+	start := now.Truncate(width)
+	bk := &b.buckets[(start.UnixNano()/int64(width))%int64(len(b.buckets))]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+func (b *Breaker) checkOpenExpired(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.config.OpenDuration {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) setState(to State, now time.Time) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.generation++
+	b.trials, b.successes = 0, 0
+	switch to {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+	}
+	if b.onChange != nil {
+		b.pending = append(b.pending, StateChange{Name: b.name, From: from, To: to, At: now})
+	}
+}
+
+// unlock 解锁后再回调状态变化，避免回调中访问熔断器时死锁
+func (b *Breaker) unlock() {
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	for _, change := range pending {
+		b.onChange(change)
+	}
+}
@@ -0,0 +1,186 @@
+package circuit_breaker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		Window:                10 * time.Second,
+		Buckets:               10,
+		MinRequests:           4,
+		ErrorRateThreshold:    0.5,
+		SlowCallThreshold:     100 * time.Millisecond,
+		SlowCallRateThreshold: 0.5,
+		OpenDuration:          5 * time.Second,
+		HalfOpenMaxRequests:   2,
+	}
+}
+
+// TestBreaker_StateMachine 测试 关闭 -> 打开 -> 半开 -> 关闭/打开 的状态变化
+func TestBreaker_StateMachine(t *testing.T) {
+	now := time.Unix(1000, 0)
+	changes := make(chan StateChange, 10)
+	b := NewBreaker("backend", testConfig(), func(c StateChange) { changes <- c })
+	b.now = func() time.Time { return now }
+
+	call := func(success bool, latency time.Duration) error {
+		done, err := b.Allow()
+		if err == nil {
+			done(success, latency)
+		}
+		return err
+	}
+
+	// 请求数不足 MinRequests 时不熔断
+	for i := 0; i < 3; i++ {
+		call(false, 0)
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("want closed below MinRequests, got %s", b.State())
+	}
+	call(false, 0)
+	if b.State() != StateOpen {
+		t.Fatalf("want open after error rate exceeded, got %s", b.State())
+	}
+	if err := call(true, 0); !errors.Is(err, ErrOpen) {
+		t.Fatalf("want ErrOpen, got %v", err)
+	}
+
+	// 打开持续时间过后进入半开，只放行 HalfOpenMaxRequests 个试探请求
+	now = now.Add(5 * time.Second)
+	done1, err1 := b.Allow()
+	done2, err2 := b.Allow()
+	if err1 != nil || err2 != nil {
+		t.Fatalf("want trial requests allowed, got %v %v", err1, err2)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrTooManyTrials) {
+		t.Fatalf("want ErrTooManyTrials, got %v", err)
+	}
+	done1(true, 0)
+	done2(true, 0)
+	if b.State() != StateClosed {
+		t.Fatalf("want closed after successful trials, got %s", b.State())
+	}
+
+	// 慢调用率超过阈值同样熔断，半开试探失败重新打开
+	for i := 0; i < 4; i++ {
+		call(true, 200*time.Millisecond)
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("want open after slow call rate exceeded, got %s", b.State())
+	}
+	now = now.Add(5 * time.Second)
+	call(false, 0)
+	if b.State() != StateOpen {
+		t.Fatalf("want open after failed trial, got %s", b.State())
+	}
+
+	want := []State{StateOpen, StateHalfOpen, StateClosed, StateOpen, StateHalfOpen, StateOpen}
+	for _, to := range want {
+		select {
+		case c := <-changes:
+			if c.To != to {
+				t.Errorf("want change to %s, got %s", to, c.To)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing state change to %s", to)
+		}
+	}
+}
+
+// TestBreaker_WindowExpires 测试滚动窗口之外的失败不再计入
+func TestBreaker_WindowExpires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := NewBreaker("backend", testConfig(), nil)
+	b.now = func() time.Time { return now }
+	for i := 0; i < 3; i++ {
+		done, _ := b.Allow()
+		done(false, 0)
+	}
+	now = now.Add(11 * time.Second)
+	for i := 0; i < 3; i++ {
+		done, _ := b.Allow()
+		done(true, 0)
+	}
+	done, _ := b.Allow()
+	done(false, 0)
+	if b.State() != StateClosed {
+		t.Errorf("want closed after old failures expired, got %s", b.State())
+	}
+}
+
+// TestBreaker_ZeroHalfOpenRequests 测试未配置试探请求数时半开状态仍能放行试探请求并关闭
+func TestBreaker_ZeroHalfOpenRequests(t *testing.T) {
+	now := time.Unix(1000, 0)
+	config := testConfig()
+	config.HalfOpenMaxRequests = 0
+	b := NewBreaker("backend", config, nil)
+	b.now = func() time.Time { return now }
+	for i := 0; i < 4; i++ {
+		done, _ := b.Allow()
+		done(false, 0)
+	}
+	now = now.Add(config.OpenDuration)
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("want trial request allowed in half-open state, got %v", err)
+	}
+	done(true, 0)
+	if b.State() != StateClosed {
+		t.Errorf("want closed after successful trial, got %s", b.State())
+	}
+}
+
+// TestTransport 测试下游持续返回 5xx 后熔断，熔断期间不再请求下游并返回降级响应
+func TestTransport(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	transport := NewTransport(http.DefaultTransport, NewGroup(testConfig()))
+	transport.Fallback = StaticFallback(http.StatusServiceUnavailable, "application/json", `{"error":"degraded"}`)
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 6; i++ {
+		res, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if i >= 4 && (res.StatusCode != http.StatusServiceUnavailable || res.Header.Get(StateHeader) != "open") {
+			t.Errorf("request %d: want fallback response, got %d", i, res.StatusCode)
+		}
+	}
+	if hits.Load() != 4 {
+		t.Errorf("want 4 requests reach backend, got %d", hits.Load())
+	}
+}
+
+// TestGroup_DialContext 测试拨号失败后熔断，熔断期间不再拨号
+func TestGroup_DialContext(t *testing.T) {
+	var dials atomic.Int32
+	dial := NewGroup(testConfig()).DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dials.Add(1)
+		return nil, errors.New("connection refused")
+	})
+	for i := 0; i < 6; i++ {
+		dial(context.Background(), "tcp", "127.0.0.1:1")
+	}
+	if _, err := dial(context.Background(), "tcp", "127.0.0.1:1"); !errors.Is(err, ErrOpen) {
+		t.Errorf("want ErrOpen, got %v", err)
+	}
+	if dials.Load() != 4 {
+		t.Errorf("want 4 dials, got %d", dials.Load())
+	}
+}
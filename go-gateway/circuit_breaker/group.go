@@ -0,0 +1,76 @@
+package circuit_breaker
+
+import (
+	"log"
+	"sort"
+	"sync"
+)
+
+// Group 按下游地址或路由分别维护熔断器，同一个 Group 内的熔断器共享配置
+type Group struct {
+	config Config
+
+	mu        sync.Mutex
+	breakers  map[string]*Breaker
+	listeners []func(StateChange)
+}
+
+// NewGroup 新建熔断器组，默认打印状态变化日志
+func NewGroup(config Config) *Group {
+	g := &Group{config: config, breakers: make(map[string]*Breaker)}
+	g.Subscribe(func(change StateChange) {
+		log.Printf("circuit_breaker: %s %s -> %s", change.Name, change.From, change.To)
+	})
+	return g
+}
+
+// Get 返回 name 对应的熔断器，不存在时新建
+func (g *Group) Get(name string) *Breaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.breakers[name]
+	if !ok {
+		b = NewBreaker(name, g.config, g.notify)
+		g.breakers[name] = b
+	}
+	return b
+}
+
+// Subscribe 订阅组内所有熔断器的状态变化事件
+func (g *Group) Subscribe(listener func(StateChange)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.listeners = append(g.listeners, listener)
+}
+
+// States 返回组内所有熔断器的当前状态，按名称排序
+func (g *Group) States() []BreakerState {
+	g.mu.Lock()
+	breakers := make([]*Breaker, 0, len(g.breakers))
+	for _, b := range g.breakers {
+		breakers = append(breakers, b)
+	}
+	g.mu.Unlock()
+
+	states := make([]BreakerState, 0, len(breakers))
+	for _, b := range breakers {
+		states = append(states, BreakerState{Name: b.Name(), State: b.State()})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// BreakerState 熔断器名称及状态
+type BreakerState struct {
+	Name  string
+	State State
+}
+
+func (g *Group) notify(change StateChange) {
+	g.mu.Lock()
+	listeners := append([]func(StateChange){}, g.listeners...)
+	g.mu.Unlock()
+	for _, listener := range listeners {
+		listener(change)
+	}
+}
@@ -0,0 +1,112 @@
+package circuit_breaker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StateHeader 熔断时返回的降级响应中标记熔断器状态的响应头
+const StateHeader = "X-Circuit-Breaker"
+
+// Transport 带熔断的 http.RoundTripper
+//
+// 按 Key 返回的下游地址或路由选择熔断器：熔断打开时不再请求下游，
+// 有 Fallback 时返回降级响应，否则返回 ErrOpen / ErrTooManyTrials，交给 ReverseProxy 的 ErrorHandler 处理
+type Transport struct {
+	Base  http.RoundTripper
+	Group *Group
+
+	// Key 熔断器的键，为空时按下游地址 req.URL.Host
+	Key func(req *http.Request) string
+	// IsFailure 判断请求是否失败，为空时传输错误和 5xx 响应算作失败
+	IsFailure func(res *http.Response, err error) bool
+	// Fallback 熔断时的降级响应，为空时返回错误
+	Fallback func(req *http.Request, err error) (*http.Response, error)
+}
+
+// NewTransport 新建带熔断的 Transport
+func NewTransport(base http.RoundTripper, group *Group) *Transport {
+	return &Transport{Base: base, Group: group}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.Host
+	if t.Key != nil {
+		key = t.Key(req)
+	}
+	done, err := t.Group.Get(key).Allow()
+	if err != nil {
+		if t.Fallback != nil {
+			return t.Fallback(req, err)
+		}
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := t.base().RoundTrip(req)
+	done(!t.isFailure(res, err, req), time.Since(start))
+	return res, err
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) isFailure(res *http.Response, err error, req *http.Request) bool {
+	if t.IsFailure != nil {
+		return t.IsFailure(res, err)
+	}
+	if err != nil {
+		// 客户端主动取消不算下游故障
+		return req.Context().Err() != context.Canceled
+	}
+	return res.StatusCode >= http.StatusInternalServerError
+}
+
+// StaticFallback 返回固定内容的降级响应
+func StaticFallback(status int, contentType, body string) func(*http.Request, error) (*http.Response, error) {
+	return func(req *http.Request, err error) (*http.Response, error) {
+		header := make(http.Header)
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		header.Set(StateHeader, "open")
+		return &http.Response{
+			Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+}
+
+// DialContext 包装拨号函数，按拨号地址熔断，拨号失败算作失败，拨号耗时用于统计慢调用
+//
+// 可用于 tcp_proxy.TCPReverseProxy.DialContext，dial 为空时使用 net.Dialer
+func (g *Group) DialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		done, err := g.Get(address).Allow()
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		conn, err := dial(ctx, network, address)
+		done(err == nil || ctx.Err() == context.Canceled, time.Since(start))
+		return conn, err
+	}
+}
@@ -0,0 +1,114 @@
+package load_balance
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// HealthChecker 定时探测负载均衡器中的下游，连续失败 FailThreshold 次标记为不健康，探测成功立即恢复
+type HealthChecker struct {
+	Balancer      Manager
+	Interval      time.Duration
+	Timeout       time.Duration
+	FailThreshold int
+	// Check 探测函数，为空时只检查能否建立 TCP 连接
+	Check func(ctx context.Context, addr string) error
+
+	mu       sync.Mutex
+	failures map[string]int
+	stop     chan struct{}
+}
+
+// NewHealthChecker 新建健康检查器，默认超时 2 秒，连续失败 2 次标记为不健康
+func NewHealthChecker(balancer Manager, interval time.Duration) *HealthChecker {
+	return &HealthChecker{Balancer: balancer, Interval: interval, Timeout: 2 * time.Second, FailThreshold: 2}
+}
+
+// Start 立即探测一次，之后每隔 Interval 探测一次
+func (h *HealthChecker) Start() {
+	h.mu.Lock()
+	if h.stop != nil {
+		h.mu.Unlock()
+		return
+	}
+	h.stop = make(chan struct{})
+	stop := h.stop
+	h.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(h.Interval)
+		defer ticker.Stop()
+		for {
+			h.CheckAll()
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止探测
+func (h *HealthChecker) Stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stop != nil {
+		close(h.stop)
+		h.stop = nil
+	}
+}
+
+// CheckAll 并发探测所有下游并更新健康状态
+func (h *HealthChecker) CheckAll() {
+	var wg sync.WaitGroup
+	for _, upstream := range h.Balancer.Upstreams() {
+		wg.Add(1)
+		go func(upstream Upstream) {
+			defer wg.Done()
+			h.update(upstream, h.check(upstream.Addr))
+		}(upstream)
+	}
+	wg.Wait()
+}
+
+func (h *HealthChecker) check(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+	if h.Check != nil {
+		return h.Check(ctx, addr)
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (h *HealthChecker) update(upstream Upstream, err error) {
+	h.mu.Lock()
+	if h.failures == nil {
+		h.failures = make(map[string]int)
+	}
+	if err == nil {
+		delete(h.failures, upstream.Addr)
+	} else {
+		h.failures[upstream.Addr]++
+	}
+	healthy := h.failures[upstream.Addr] < h.FailThreshold
+	h.mu.Unlock()
+
+	if healthy == upstream.Healthy {
+		return
+	}
+	if err := h.Balancer.SetHealthy(upstream.Addr, healthy); err != nil {
+		return
+	}
+	if healthy {
+		log.Printf("load_balance: upstream %s is healthy", upstream.Addr)
+	} else {
+		log.Printf("load_balance: upstream %s is unhealthy: %v", upstream.Addr, err)
+	}
+}
@@ -0,0 +1,16 @@
+package load_balance
+
+import "errors"
+
+// ErrNoAvailableServer 没有可用的下游服务器
+var ErrNoAvailableServer = errors.New("load_balance: no available server")
+
+// LoadBalance 负载均衡器
+//
+// 前提：所有下游服务器提供的服务都是相同的
+type LoadBalance interface {
+	// Add 添加下游服务器地址
+	Add(addrs ...string) error
+	// Get 根据key（如客户端IP）选出一个下游服务器地址
+	Get(key string) (string, error)
+}
@@ -0,0 +1,74 @@
+package load_balance
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+// RandomBalance 随机负载均衡
+type RandomBalance struct {
+	mu        sync.RWMutex
+	servAddrs []string // 下游真实服务器地址
+	serverStatus
+}
+
+// NewRandomBalance 新建随机负载均衡器
+func NewRandomBalance(addrs ...string) *RandomBalance {
+	rb := &RandomBalance{}
+	rb.servAddrs = append(rb.servAddrs, addrs...)
+	return rb
+}
+
+func (rb *RandomBalance) Add(addrs ...string) error {
+	if len(addrs) == 0 {
+		return errors.New("load_balance: at least one address is required")
+	}
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.servAddrs = append(rb.servAddrs, addrs...)
+	return nil
+}
+
+func (rb *RandomBalance) Get(string) (string, error) {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	// 在可用的下游中随机选择第 k 个
+	n := 0
+	for _, addr := range rb.servAddrs {
+		if rb.available(addr) {
+			n++
+		}
+	}
+	if n == 0 {
+		return "", ErrNoAvailableServer
+	}
+	k := rand.Intn(n)
+	for _, addr := range rb.servAddrs {
+		if rb.available(addr) {
+			if k == 0 {
+				return addr, nil
+			}
+			k--
+		}
+	}
+	return "", ErrNoAvailableServer
+}
+
+func (rb *RandomBalance) Upstreams() []Upstream {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.upstreams(rb.servAddrs)
+}
+
+func (rb *RandomBalance) SetDrained(addr string, drained bool) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.setDrained(rb.servAddrs, addr, drained)
+}
+
+func (rb *RandomBalance) SetHealthy(addr string, healthy bool) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.setHealthy(rb.servAddrs, addr, healthy)
+}
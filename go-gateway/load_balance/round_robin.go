@@ -0,0 +1,66 @@
+package load_balance
+
+import (
+	"errors"
+	"sync"
+)
+
+// RoundRobinBalance 轮询负载均衡
+type RoundRobinBalance struct {
+	mu        sync.Mutex
+	servAddrs []string // 下游真实服务器地址
+	curIndex  int      // 当前轮询的节点索引
+	serverStatus
+}
+
+// NewRoundRobinBalance 新建轮询负载均衡器
+func NewRoundRobinBalance(addrs ...string) *RoundRobinBalance {
+	rb := &RoundRobinBalance{}
+	rb.servAddrs = append(rb.servAddrs, addrs...)
+	return rb
+}
+
+func (rb *RoundRobinBalance) Add(addrs ...string) error {
+	if len(addrs) == 0 {
+		return errors.New("load_balance: at least one address is required")
+	}
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.servAddrs = append(rb.servAddrs, addrs...)
+	return nil
+}
+
+func (rb *RoundRobinBalance) Get(string) (string, error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	// 跳过不健康或被摘除的下游，最多轮询一圈
+	for i := 0; i < len(rb.servAddrs); i++ {
+		if rb.curIndex >= len(rb.servAddrs) {
+			rb.curIndex = 0
+		}
+		addr := rb.servAddrs[rb.curIndex]
+		rb.curIndex = (rb.curIndex + 1) % len(rb.servAddrs)
+		if rb.available(addr) {
+			return addr, nil
+		}
+	}
+	return "", ErrNoAvailableServer
+}
+
+func (rb *RoundRobinBalance) Upstreams() []Upstream {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.upstreams(rb.servAddrs)
+}
+
+func (rb *RoundRobinBalance) SetDrained(addr string, drained bool) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.setDrained(rb.servAddrs, addr, drained)
+}
+
+func (rb *RoundRobinBalance) SetHealthy(addr string, healthy bool) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.setHealthy(rb.servAddrs, addr, healthy)
+}
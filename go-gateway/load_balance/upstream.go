@@ -0,0 +1,68 @@
+package load_balance
+
+import (
+	"errors"
+	"slices"
+)
+
+// ErrUnknownServer 负载均衡器中没有该下游服务器
+var ErrUnknownServer = errors.New("load_balance: unknown server")
+
+// Upstream 下游服务器及其状态
+type Upstream struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"` // 健康检查结果
+	Drained bool   `json:"drained"` // 被运维手动摘除
+}
+
+// Manager 支持查看和调整下游状态的负载均衡器，不健康或被摘除的下游不会被 Get 选中
+type Manager interface {
+	LoadBalance
+	// Upstreams 返回所有下游及其状态
+	Upstreams() []Upstream
+	// SetDrained 摘除或恢复下游，摘除后不再分配新请求，已有连接不受影响
+	SetDrained(addr string, drained bool) error
+	// SetHealthy 更新下游的健康状态，一般由 HealthChecker 调用
+	SetHealthy(addr string, healthy bool) error
+}
+
+// serverStatus 下游的摘除和健康状态，调用方负责加锁
+type serverStatus struct {
+	drained   map[string]bool
+	unhealthy map[string]bool
+}
+
+func (s *serverStatus) available(addr string) bool {
+	return !s.drained[addr] && !s.unhealthy[addr]
+}
+
+func (s *serverStatus) upstreams(addrs []string) []Upstream {
+	upstreams := make([]Upstream, len(addrs))
+	for i, addr := range addrs {
+		upstreams[i] = Upstream{Addr: addr, Healthy: !s.unhealthy[addr], Drained: s.drained[addr]}
+	}
+	return upstreams
+}
+
+func (s *serverStatus) setDrained(addrs []string, addr string, drained bool) error {
+	return setFlag(&s.drained, addrs, addr, drained)
+}
+
+func (s *serverStatus) setHealthy(addrs []string, addr string, healthy bool) error {
+	return setFlag(&s.unhealthy, addrs, addr, !healthy)
+}
+
+func setFlag(flags *map[string]bool, addrs []string, addr string, value bool) error {
+	if !slices.Contains(addrs, addr) {
+		return ErrUnknownServer
+	}
+	if *flags == nil {
+		*flags = make(map[string]bool)
+	}
+	if value {
+		(*flags)[addr] = true
+	} else {
+		delete(*flags, addr)
+	}
+	return nil
+}
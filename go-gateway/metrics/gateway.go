@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/proxy/http_proxy/proxy_error"
+	"strconv"
+	"time"
+)
+
+// Gateway 网关内置指标
+type Gateway struct {
+	Requests       *CounterVec   // gateway_http_requests_total{route,method,code}
+	Duration       *HistogramVec // gateway_http_request_duration_seconds{route,method}
+	InFlight       *GaugeVec     // gateway_http_requests_in_flight{route}
+	UpstreamErrors *CounterVec   // gateway_upstream_errors_total{upstream,class}
+	TCPActive      *GaugeVec     // gateway_tcp_connections_active{listener}
+	TCPTotal       *CounterVec   // gateway_tcp_connections_total{listener}
+	Bytes          *CounterVec   // gateway_proxied_bytes_total{protocol,direction}
+}
+
+// NewGateway 新建网关内置指标并注册到 r
+func NewGateway(r *Registry) *Gateway {
+	g := &Gateway{
+		Requests: NewCounterVec("gateway_http_requests_total",
+			"Total HTTP requests handled by the gateway.", "route", "method", "code"),
+		Duration: NewHistogramVec("gateway_http_request_duration_seconds",
+			"HTTP request latency at the gateway in seconds.", DefaultBuckets, "route", "method"),
+		InFlight: NewGaugeVec("gateway_http_requests_in_flight",
+			"HTTP requests currently being handled.", "route"),
+		UpstreamErrors: NewCounterVec("gateway_upstream_errors_total",
+			"Failed upstream requests by error class.", "upstream", "class"),
+		TCPActive: NewGaugeVec("gateway_tcp_connections_active",
+			"TCP connections currently being proxied.", "listener"),
+		TCPTotal: NewCounterVec("gateway_tcp_connections_total",
+			"Total TCP connections accepted.", "listener"),
+		Bytes: NewCounterVec("gateway_proxied_bytes_total",
+			"Bytes proxied; direction in is from client, out is to client.", "protocol", "direction"),
+	}
+	r.MustRegister(g.Requests, g.Duration, g.InFlight, g.UpstreamErrors, g.TCPActive, g.TCPTotal, g.Bytes)
+	return g
+}
+
+// Handler 包装 http.Handler，统计请求数、延迟、并发数和字节数，route 作为指标的路由标签
+func (g *Gateway) Handler(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rw, done := g.begin(route, w, req)
+		// 下游 panic（如 ReverseProxy 复制响应体失败时的 http.ErrAbortHandler）也要结束统计，否则并发数只增不减
+		defer done()
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// HTTPMiddleware 指标中间件，以路由组的路径作为路由标签
+func (g *Gateway) HTTPMiddleware() middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		w := c.Rw
+		rw, done := g.begin(c.Path(), w, c.Req)
+		defer done()
+		c.Rw = rw
+		defer func() { c.Rw = w }()
+		c.Next()
+	}
+}
+
+func (g *Gateway) begin(route string, w http.ResponseWriter, req *http.Request) (http.ResponseWriter, func()) {
+	start := time.Now()
+	method := normalizeMethod(req.Method)
+	inFlight := g.InFlight.WithLabelValues(route)
+	inFlight.Inc()
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingBody{ReadCloser: req.Body, counter: g.Bytes.WithLabelValues("http", "in")}
+	}
+	rw := &statusWriter{ResponseWriter: w, counter: g.Bytes.WithLabelValues("http", "out")}
+	return rw, func() {
+		inFlight.Dec()
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		g.Requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+		g.Duration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// normalizeMethod 非标准的请求方法统一为 OTHER，避免标签基数失控
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// Transport 统计下游请求错误：网络错误按 proxy_error 的错误分类计数，5xx 响应计为 status_5xx
+type Transport struct {
+	Base    http.RoundTripper
+	Gateway *Gateway
+}
+
+// NewTransport 新建统计下游错误的 Transport
+func (g *Gateway) NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base, Gateway: g}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	res, err := base.RoundTrip(req)
+	switch {
+	case err != nil:
+		// 客户端取消的请求不算下游错误
+		if !errors.Is(req.Context().Err(), context.Canceled) {
+			t.Gateway.UpstreamErrors.WithLabelValues(req.URL.Host, string(proxy_error.Classify(err))).Inc()
+		}
+	case res.StatusCode >= http.StatusInternalServerError:
+		t.Gateway.UpstreamErrors.WithLabelValues(req.URL.Host, "status_5xx").Inc()
+	}
+	return res, err
+}
+
+// TCPMiddleware 统计活跃连接数、连接总数和字节数，以监听地址作为标签
+func (g *Gateway) TCPMiddleware() middleware.TCPHandlerFunc {
+	return func(c *middleware.TCPSliceRouterContext) {
+		listener := c.Conn.LocalAddr().String()
+		g.TCPTotal.WithLabelValues(listener).Inc()
+		active := g.TCPActive.WithLabelValues(listener)
+		active.Inc()
+		conn := c.Conn
+		c.Conn = &countingConn{Conn: conn, in: g.Bytes.WithLabelValues("tcp", "in"), out: g.Bytes.WithLabelValues("tcp", "out")}
+		defer func() {
+			c.Conn = conn
+			active.Dec()
+		}()
+		c.Next()
+	}
+}
+
+// statusWriter 记录响应状态码并统计响应字节数
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	counter *Counter
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.counter.Add(float64(n))
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+type countingBody struct {
+	io.ReadCloser
+	counter *Counter
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.counter.Add(float64(n))
+	return n, err
+}
+
+type countingConn struct {
+	net.Conn
+	in, out *Counter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.in.Add(float64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.out.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Type 指标类型
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// Desc 指标描述
+type Desc struct {
+	Name       string
+	Help       string
+	Type       Type
+	LabelNames []string
+}
+
+// Sample 一个时间序列的当前值，Histogram 类型使用 Buckets/Count/Sum
+type Sample struct {
+	LabelValues []string
+	Value       float64
+	Buckets     []Bucket
+	Count       uint64
+	Sum         float64
+}
+
+// Bucket 直方图的一个累计桶
+type Bucket struct {
+	UpperBound float64
+	Count      uint64 // 小于等于 UpperBound 的观测次数
+}
+
+// Collector 可以注册到 Registry 的指标
+type Collector interface {
+	Desc() Desc
+	Collect() []Sample
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	desc Desc
+	bits atomic.Uint64
+}
+
+// NewCounter 新建计数器
+func NewCounter(name, help string) *Counter {
+	return &Counter{desc: Desc{Name: name, Help: help, Type: TypeCounter}}
+}
+
+// Inc 加一
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add 增加 v，v 为负数时 panic
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	addFloat(&c.bits, v)
+}
+
+// Value 当前值
+func (c *Counter) Value() float64 { return math.Float64frombits(c.bits.Load()) }
+
+func (c *Counter) Desc() Desc        { return c.desc }
+func (c *Counter) Collect() []Sample { return []Sample{{Value: c.Value()}} }
+
+// Gauge 可增可减的瞬时值
+type Gauge struct {
+	desc Desc
+	bits atomic.Uint64
+}
+
+// NewGauge 新建瞬时值指标
+func NewGauge(name, help string) *Gauge {
+	return &Gauge{desc: Desc{Name: name, Help: help, Type: TypeGauge}}
+}
+
+// Set 设置为 v
+func (g *Gauge) Set(v float64) { g.bits.Store(math.Float64bits(v)) }
+
+// Add 增加 v，v 可以为负数
+func (g *Gauge) Add(v float64) { addFloat(&g.bits, v) }
+
+// Inc 加一
+func (g *Gauge) Inc() { g.Add(1) }
+
+// Dec 减一
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Value 当前值
+func (g *Gauge) Value() float64 { return math.Float64frombits(g.bits.Load()) }
+
+func (g *Gauge) Desc() Desc        { return g.desc }
+func (g *Gauge) Collect() []Sample { return []Sample{{Value: g.Value()}} }
+
+// GaugeFunc 抓取时调用 fn 取值的瞬时值指标，适合暴露已有组件的状态，如队列长度、丢弃条数
+type GaugeFunc struct {
+	desc Desc
+	fn   func() float64
+}
+
+// NewGaugeFunc 新建抓取时取值的瞬时值指标
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return &GaugeFunc{desc: Desc{Name: name, Help: help, Type: TypeGauge}, fn: fn}
+}
+
+func (g *GaugeFunc) Desc() Desc        { return g.desc }
+func (g *GaugeFunc) Collect() []Sample { return []Sample{{Value: g.fn()}} }
+
+// DefaultBuckets 默认的延迟直方图桶，单位秒
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram 直方图，按桶统计观测值的分布
+type Histogram struct {
+	desc   Desc
+	bounds []float64
+	mu     sync.Mutex // 保证抓取时桶、总数和总和一致
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram 新建直方图，buckets 为桶的上界，为空时使用 DefaultBuckets
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := newHistogram(checkBuckets(buckets))
+	h.desc = Desc{Name: name, Help: help, Type: TypeHistogram}
+	return h
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+func (h *Histogram) Desc() Desc        { return h.desc }
+func (h *Histogram) Collect() []Sample { return []Sample{h.sample()} }
+
+func (h *Histogram) sample() Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := Sample{Buckets: make([]Bucket, len(h.bounds)), Count: h.count, Sum: h.sum}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		s.Buckets[i] = Bucket{UpperBound: bound, Count: cumulative}
+	}
+	return s
+}
+
+func checkBuckets(buckets []float64) []float64 {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: histogram buckets must be sorted")
+	}
+	// +Inf 桶由输出时的 _count 表示
+	if math.IsInf(buckets[len(buckets)-1], 1) {
+		buckets = buckets[:len(buckets)-1]
+	}
+	return buckets
+}
+
+// vec 按标签值区分的一组时间序列
+type vec[T any] struct {
+	desc     Desc
+	newChild func() T
+	sample   func(T) Sample
+
+	mu       sync.RWMutex
+	children map[string]*child[T]
+}
+
+type child[T any] struct {
+	labelValues []string
+	metric      T
+}
+
+func newVec[T any](desc Desc, newChild func() T, sample func(T) Sample) *vec[T] {
+	return &vec[T]{desc: desc, newChild: newChild, sample: sample, children: make(map[string]*child[T])}
+}
+
+// with 返回标签值对应的时间序列，不存在时新建；标签值个数不对时 panic
+func (v *vec[T]) with(labelValues []string) T {
+	if len(labelValues) != len(v.desc.LabelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.desc.Name, len(v.desc.LabelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.RLock()
+	c, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return c.metric
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.children[key]; !ok {
+		c = &child[T]{labelValues: append([]string(nil), labelValues...), metric: v.newChild()}
+		v.children[key] = c
+	}
+	return c.metric
+}
+
+// delete 删除标签值对应的时间序列，如下游下线后不再输出
+func (v *vec[T]) delete(labelValues []string) bool {
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, ok := v.children[key]
+	delete(v.children, key)
+	return ok
+}
+
+func (v *vec[T]) Desc() Desc { return v.desc }
+
+func (v *vec[T]) Collect() []Sample {
+	v.mu.RLock()
+	samples := make([]Sample, 0, len(v.children))
+	for _, c := range v.children {
+		s := v.sample(c.metric)
+		s.LabelValues = c.labelValues
+		samples = append(samples, s)
+	}
+	v.mu.RUnlock()
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].LabelValues, "\xff") < strings.Join(samples[j].LabelValues, "\xff")
+	})
+	return samples
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct{ *vec[*Counter] }
+
+// NewCounterVec 新建带标签的计数器
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	desc := Desc{Name: name, Help: help, Type: TypeCounter, LabelNames: labelNames}
+	return &CounterVec{newVec(desc, func() *Counter { return &Counter{} },
+		func(c *Counter) Sample { return Sample{Value: c.Value()} })}
+}
+
+// WithLabelValues 返回标签值对应的计数器，按 labelNames 的顺序传入
+func (v *CounterVec) WithLabelValues(labelValues ...string) *Counter { return v.with(labelValues) }
+
+// DeleteLabelValues 删除标签值对应的计数器
+func (v *CounterVec) DeleteLabelValues(labelValues ...string) bool { return v.delete(labelValues) }
+
+// GaugeVec 带标签的瞬时值
+type GaugeVec struct{ *vec[*Gauge] }
+
+// NewGaugeVec 新建带标签的瞬时值指标
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	desc := Desc{Name: name, Help: help, Type: TypeGauge, LabelNames: labelNames}
+	return &GaugeVec{newVec(desc, func() *Gauge { return &Gauge{} },
+		func(g *Gauge) Sample { return Sample{Value: g.Value()} })}
+}
+
+// WithLabelValues 返回标签值对应的瞬时值，按 labelNames 的顺序传入
+func (v *GaugeVec) WithLabelValues(labelValues ...string) *Gauge { return v.with(labelValues) }
+
+// DeleteLabelValues 删除标签值对应的瞬时值
+func (v *GaugeVec) DeleteLabelValues(labelValues ...string) bool { return v.delete(labelValues) }
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct{ *vec[*Histogram] }
+
+// NewHistogramVec 新建带标签的直方图，buckets 为空时使用 DefaultBuckets
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	bounds := checkBuckets(buckets)
+	desc := Desc{Name: name, Help: help, Type: TypeHistogram, LabelNames: labelNames}
+	return &HistogramVec{newVec(desc, func() *Histogram { return newHistogram(bounds) },
+		(*Histogram).sample)}
+}
+
+// WithLabelValues 返回标签值对应的直方图，按 labelNames 的顺序传入
+func (v *HistogramVec) WithLabelValues(labelValues ...string) *Histogram { return v.with(labelValues) }
+
+// DeleteLabelValues 删除标签值对应的直方图
+func (v *HistogramVec) DeleteLabelValues(labelValues ...string) bool { return v.delete(labelValues) }
+
+// addFloat 原子地给 float64 加上 v
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"strings"
+	"testing"
+)
+
+// TestWriteText 测试文本格式输出：排序、标签转义和直方图的累计桶
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := NewCounterVec("requests_total", "Total requests.", "path")
+	latency := NewHistogram("latency_seconds", "Latency.\nIn seconds.", []float64{0.1, 1})
+	r.MustRegister(requests, latency, NewGaugeFunc("queue_length", "", func() float64 { return 3 }))
+
+	requests.WithLabelValues(`/a"b`).Add(2)
+	requests.WithLabelValues("/").Inc()
+	latency.Observe(0.05)
+	latency.Observe(0.1)
+	latency.Observe(5)
+
+	var buf bytes.Buffer
+	r.WriteText(&buf)
+	want := `# HELP latency_seconds Latency.\nIn seconds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.15
+latency_seconds_count 3
+# TYPE queue_length gauge
+queue_length 3
+# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{path="/"} 1
+requests_total{path="/a\"b"} 2
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+// TestRegister 测试重复注册和非法名称
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(NewCounter("a_total", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(NewGauge("a_total", "")); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("want ErrAlreadyExists, got %v", err)
+	}
+	for _, c := range []Collector{
+		NewCounter("1abc", ""),
+		NewCounterVec("b_total", "", "bad-label"),
+		NewHistogramVec("c_seconds", "", nil, "le"),
+	} {
+		if err := r.Register(c); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("want ErrInvalidName for %s, got %v", c.Desc().Name, err)
+		}
+	}
+}
+
+// TestGatewayHTTP 测试中间件统计请求数、字节数，Transport 统计下游错误
+func TestGatewayHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	r := NewRegistry()
+	g := NewGateway(r)
+	transport := g.NewTransport(http.DefaultTransport)
+	router := middleware.NewSliceRouter()
+	router.Group("/api").Use(g.HTTPMiddleware())
+	handler := middleware.NewSliceRouterHandler(func(c *middleware.SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			io.ReadAll(req.Body)
+			res, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, upstream.URL, nil).WithContext(context.Background()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			w.WriteHeader(res.StatusCode)
+			w.Write([]byte("bad gateway"))
+		})
+	}, router)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/api/x", strings.NewReader("body")))
+
+	if v := g.Requests.WithLabelValues("/api", "OTHER", "502").Value(); v != 1 {
+		t.Errorf("want 1 request counted, got %v", v)
+	}
+	if v := g.InFlight.WithLabelValues("/api").Value(); v != 0 {
+		t.Errorf("want no request in flight, got %v", v)
+	}
+	if in, out := g.Bytes.WithLabelValues("http", "in").Value(), g.Bytes.WithLabelValues("http", "out").Value(); in != 4 || out != 11 {
+		t.Errorf("unexpected bytes in %v out %v", in, out)
+	}
+	if v := g.UpstreamErrors.WithLabelValues(strings.TrimPrefix(upstream.URL, "http://"), "status_5xx").Value(); v != 1 {
+		t.Errorf("want 1 upstream error, got %v", v)
+	}
+
+	res := httptest.NewRecorder()
+	r.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if res.Header().Get("Content-Type") != ContentType ||
+		!strings.Contains(res.Body.String(), `gateway_http_request_duration_seconds_count{route="/api",method="OTHER"} 1`) {
+		t.Errorf("unexpected exposition %s", res.Body.String())
+	}
+}
+
+// TestGatewayHTTP_Panic 测试下游 panic 时并发数仍然归零，请求仍被统计
+func TestGatewayHTTP_Panic(t *testing.T) {
+	g := NewGateway(NewRegistry())
+	abort := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic(http.ErrAbortHandler)
+	})
+	router := middleware.NewSliceRouter()
+	router.Group("/api").Use(g.HTTPMiddleware())
+	for _, handler := range []http.Handler{
+		g.Handler("/api", abort),
+		middleware.NewSliceRouterHandler(func(*middleware.SliceRouterContext) http.Handler { return abort }, router),
+	} {
+		func() {
+			defer func() { recover() }()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/x", nil))
+		}()
+	}
+
+	if v := g.InFlight.WithLabelValues("/api").Value(); v != 0 {
+		t.Errorf("want no request in flight, got %v", v)
+	}
+	if v := g.Requests.WithLabelValues("/api", http.MethodGet, "200").Value(); v != 2 {
+		t.Errorf("want 2 requests counted, got %v", v)
+	}
+}
+
+// TestGatewayTCP 测试活跃连接数在会话结束后归零
+func TestGatewayTCP(t *testing.T) {
+	g := NewGateway(NewRegistry())
+	router := middleware.NewTCPSliceRouter()
+	router.Group("").Use(g.TCPMiddleware())
+	var active float64
+	handler := middleware.NewTCPSliceRouterHandler(func(c *middleware.TCPSliceRouterContext) tcp_proxy.TCPHandler {
+		active = g.TCPActive.WithLabelValues("pipe").Value()
+		return tcp_proxy.DefaultTCPHandler{}
+	}, router)
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go io.ReadAll(client)
+	handler.Serve(context.Background(), server)
+
+	if active != 1 || g.TCPActive.WithLabelValues("pipe").Value() != 0 || g.TCPTotal.WithLabelValues("pipe").Value() != 1 {
+		t.Errorf("unexpected tcp metrics: active during session %v, after %v", active, g.TCPActive.WithLabelValues("pipe").Value())
+	}
+	if g.Bytes.WithLabelValues("tcp", "out").Value() == 0 {
+		t.Error("want bytes written to client counted")
+	}
+}
@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidName   = errors.New("metrics: invalid metric or label name")
+	ErrAlreadyExists = errors.New("metrics: duplicate metric name")
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Registry 指标注册表，按 Prometheus 文本格式输出所有已注册的指标
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry 新建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// DefaultRegistry 默认注册表，网关内置指标注册在这里
+var DefaultRegistry = NewRegistry()
+
+// Register 注册指标，名称不合法或重复时返回错误
+func (r *Registry) Register(c Collector) error {
+	desc := c.Desc()
+	if !metricNameRE.MatchString(desc.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, desc.Name)
+	}
+	for _, label := range desc.LabelNames {
+		// le 是直方图桶的保留标签，__ 开头的标签为 Prometheus 内部使用
+		if !labelNameRE.MatchString(label) || strings.HasPrefix(label, "__") ||
+			(desc.Type == TypeHistogram && label == "le") {
+			return fmt.Errorf("%w: label %q of %s", ErrInvalidName, label, desc.Name)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[desc.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, desc.Name)
+	}
+	r.collectors[desc.Name] = c
+	return nil
+}
+
+// MustRegister 注册指标，失败时 panic
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister 取消注册指标
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.collectors[name]
+	delete(r.collectors, name)
+	return ok
+}
+
+// WriteText 按 Prometheus 文本格式（0.0.4）输出所有指标，指标按名称排序
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	collectors := make([]Collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.RUnlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].Desc().Name < collectors[j].Desc().Name })
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		writeFamily(bw, c.Desc(), c.Collect())
+	}
+	return bw.Flush()
+}
+
+// ContentType Prometheus 文本格式的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler 返回输出所有指标的 http.Handler，一般挂在管理端口的 /metrics 上
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteText(w)
+	})
+}
+
+func writeFamily(w *bufio.Writer, desc Desc, samples []Sample) {
+	if desc.Help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", desc.Name, escapeHelp(desc.Help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", desc.Name, desc.Type)
+	for _, s := range samples {
+		if desc.Type != TypeHistogram {
+			writeSample(w, desc.Name, desc.LabelNames, s.LabelValues, "", "", s.Value)
+			continue
+		}
+		for _, b := range s.Buckets {
+			writeSample(w, desc.Name+"_bucket", desc.LabelNames, s.LabelValues, "le", formatFloat(b.UpperBound), float64(b.Count))
+		}
+		writeSample(w, desc.Name+"_bucket", desc.LabelNames, s.LabelValues, "le", "+Inf", float64(s.Count))
+		writeSample(w, desc.Name+"_sum", desc.LabelNames, s.LabelValues, "", "", s.Sum)
+		writeSample(w, desc.Name+"_count", desc.LabelNames, s.LabelValues, "", "", float64(s.Count))
+	}
+}
+
+// writeSample 输出一行样本，extraName 非空时追加一个标签（直方图的 le）
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(labelNames) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
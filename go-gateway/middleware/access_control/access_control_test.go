@@ -0,0 +1,179 @@
+package access_control
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestACL 测试最长前缀匹配及默认动作
+func TestACL(t *testing.T) {
+	acl, err := NewACL([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.1.0.0/16", "10.1.2.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"10.2.3.4":        true,
+		"10.1.9.9":        false,
+		"10.1.2.3":        false,
+		"::ffff:10.2.3.4": true,
+		"192.168.1.1":     false,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+	}
+	for ip, want := range cases {
+		if got := acl.Allowed(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Allowed(%s) got %v, want %v", ip, got, want)
+		}
+	}
+
+	// 只有黑名单时默认放行
+	if err := acl.Update(nil, []string{"0.0.0.0/0"}); err != nil {
+		t.Fatal(err)
+	}
+	if acl.Allowed(netip.MustParseAddr("1.2.3.4")) || !acl.Allowed(netip.MustParseAddr("::1")) {
+		t.Error("want all IPv4 denied and IPv6 allowed")
+	}
+	if err := acl.Update([]string{"bad"}, nil); err == nil {
+		t.Error("want error for invalid cidr")
+	}
+}
+
+// TestACL_WatchFile 测试规则文件修改后热加载
+func TestACL_WatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl.rules")
+	os.WriteFile(path, []byte("# office\nallow 10.0.0.0/8\n"), 0o644)
+	acl, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := acl.WatchFile(path, 10*time.Millisecond)
+	defer stop()
+
+	ip := netip.MustParseAddr("192.168.1.1")
+	if acl.Allowed(ip) {
+		t.Fatal("want denied before reload")
+	}
+	os.WriteFile(path, []byte("allow 10.0.0.0/8\nallow 192.168.0.0/16\n"), 0o644)
+	os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	deadline := time.Now().Add(time.Second)
+	for !acl.Allowed(ip) {
+		if time.Now().After(deadline) {
+			t.Fatal("want allowed after reload")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestResolver 测试只信任受信任代理追加的 X-Forwarded-For
+func TestResolver(t *testing.T) {
+	resolver, _ := NewResolver("10.0.0.0/8")
+	cases := []struct {
+		remote, xff, want string
+	}{
+		{"1.1.1.1:1234", "6.6.6.6", "1.1.1.1"},
+		{"10.0.0.1:1234", "6.6.6.6, 2.2.2.2, 10.0.0.2", "2.2.2.2"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "garbage, 10.0.0.2", "10.0.0.2"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+		if c.xff != "" {
+			req.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := resolver.ClientIP(req).String(); got != c.want {
+			t.Errorf("remote %s xff %q: want %s, got %s", c.remote, c.xff, c.want, got)
+		}
+	}
+}
+
+// TestReadProxyHeader 测试 PROXY protocol v1/v2 头部解析
+func TestReadProxyHeader(t *testing.T) {
+	v2 := append([]byte{}, proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0, 12, 203, 0, 113, 7, 10, 0, 0, 1)
+	v2 = binary.BigEndian.AppendUint16(v2, 5555)
+	v2 = binary.BigEndian.AppendUint16(v2, 443)
+
+	cases := []struct {
+		header, want string
+	}{
+		{"PROXY TCP4 198.51.100.1 10.0.0.1 4321 443\r\n", "198.51.100.1:4321"},
+		{"PROXY TCP6 2001:db8::1 ::1 4321 443\r\n", "[2001:db8::1]:4321"},
+		{"PROXY UNKNOWN\r\n", "<nil>"},
+		{string(v2), "203.0.113.7:5555"},
+	}
+	for _, c := range cases {
+		r := bufio.NewReader(strings.NewReader(c.header + "payload"))
+		addr, err := ReadProxyHeader(r)
+		if err != nil {
+			t.Errorf("%q: %v", c.header, err)
+			continue
+		}
+		if got := fmt.Sprint(addr); got != c.want {
+			t.Errorf("%q: want %s, got %s", c.header, c.want, got)
+		}
+		if rest, _ := r.ReadString(0); rest != "payload" {
+			t.Errorf("%q: want payload left, got %q", c.header, rest)
+		}
+	}
+	if _, err := ReadProxyHeader(bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n"))); err == nil {
+		t.Error("want error for non PROXY header")
+	}
+}
+
+// TestListener 测试 PROXY protocol 还原客户端地址后，在 Accept 阶段按黑白名单过滤连接
+func TestListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, _ := NewResolver("127.0.0.1")
+	acl, _ := NewACL(nil, []string{"198.51.100.0/24"})
+	listener := NewListener(NewProxyProtoListener(ln, resolver), acl)
+	defer listener.Close()
+
+	accepted := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			accepted <- conn.RemoteAddr().String() + " " + line
+			conn.Close()
+		}
+	}()
+
+	for _, src := range []string{"198.51.100.1", "203.0.113.7"} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "PROXY TCP4 %s 10.0.0.1 4321 443\r\nhello\n", src)
+		defer conn.Close()
+	}
+	select {
+	case got := <-accepted:
+		if got != "203.0.113.7:4321 hello\n" {
+			t.Errorf("want only allowed client accepted, got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for accepted connection")
+	}
+	select {
+	case got := <-accepted:
+		t.Errorf("denied client accepted: %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
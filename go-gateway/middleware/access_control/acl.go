@@ -0,0 +1,195 @@
+package access_control
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Action 访问控制动作
+type Action int8
+
+const (
+	ActionNone Action = iota
+	ActionAllow
+	ActionDeny
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAllow:
+		return "allow"
+	case ActionDeny:
+		return "deny"
+	}
+	return "none"
+}
+
+// ACL IP 黑白名单
+//
+// 按最长前缀匹配：客户端IP命中的最具体的 CIDR 决定放行或拒绝，
+// 同一 CIDR 同时出现在白名单和黑名单中时以黑名单为准；
+// 没有命中任何规则时，配置了白名单则拒绝，只有黑名单则放行。
+// 规则可以在运行时整体替换，替换过程中查找不加锁
+type ACL struct {
+	rules atomic.Pointer[ruleSet]
+}
+
+type ruleSet struct {
+	tree          *prefixTree
+	defaultAction Action
+	allow, deny   int
+}
+
+// NewACL 新建黑白名单，allow/deny 为 CIDR 或单个IP
+func NewACL(allow, deny []string) (*ACL, error) {
+	acl := &ACL{}
+	if err := acl.Update(allow, deny); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// Update 整体替换黑白名单，任一规则无效时保留原有规则
+func (a *ACL) Update(allow, deny []string) error {
+	rules := &ruleSet{tree: newPrefixTree(), defaultAction: ActionAllow, allow: len(allow), deny: len(deny)}
+	for _, list := range []struct {
+		cidrs  []string
+		action Action
+	}{{allow, ActionAllow}, {deny, ActionDeny}} {
+		for _, cidr := range list.cidrs {
+			prefix, err := parsePrefix(cidr)
+			if err != nil {
+				return err
+			}
+			rules.tree.insert(prefix, list.action)
+		}
+	}
+	if len(allow) > 0 {
+		rules.defaultAction = ActionDeny
+	}
+	a.rules.Store(rules)
+	return nil
+}
+
+// Allowed 判断IP是否允许访问，无效IP一律拒绝
+func (a *ACL) Allowed(ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+	rules := a.rules.Load()
+	action := rules.tree.lookup(ip)
+	if action == ActionNone {
+		action = rules.defaultAction
+	}
+	return action == ActionAllow
+}
+
+// Size 返回白名单和黑名单的规则数
+func (a *ACL) Size() (allow, deny int) {
+	rules := a.rules.Load()
+	return rules.allow, rules.deny
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("access_control: invalid cidr %q: %w", s, err)
+		}
+		return prefix, nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("access_control: invalid ip %q: %w", s, err)
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// ParseRules 解析规则文件，每行一条规则，# 开头为注释：
+//
+//	allow 10.0.0.0/8
+//	deny  10.1.2.3
+func ParseRules(data []byte) (allow, deny []string, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("access_control: line %d: want \"allow|deny <cidr>\"", line)
+		}
+		switch fields[0] {
+		case "allow":
+			allow = append(allow, fields[1])
+		case "deny":
+			deny = append(deny, fields[1])
+		default:
+			return nil, nil, fmt.Errorf("access_control: line %d: unknown action %q", line, fields[0])
+		}
+	}
+	return allow, deny, scanner.Err()
+}
+
+// LoadFile 从规则文件新建黑白名单
+func LoadFile(path string) (*ACL, error) {
+	acl := &ACL{}
+	if err := acl.reload(path); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+// WatchFile 每隔 interval 检查规则文件的修改时间，文件变化时热加载规则，返回停止检查的函数
+//
+// 新规则无效时打印日志并保留原有规则
+func (a *ACL) WatchFile(path string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			if err := a.reload(path); err != nil {
+				log.Printf("access_control: reload %s failed, keep old rules: %v", path, err)
+				continue
+			}
+			allow, deny := a.Size()
+			log.Printf("access_control: reloaded %s, %d allow and %d deny rules", path, allow, deny)
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (a *ACL) reload(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	allow, deny, err := ParseRules(data)
+	if err != nil {
+		return err
+	}
+	return a.Update(allow, deny)
+}
@@ -0,0 +1,71 @@
+package access_control
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver 解析客户端真实IP
+//
+// 连接对端是受信任的代理（如前置的 LB）时，从 X-Forwarded-For 从右往左跳过受信任的代理，
+// 第一个不受信任的地址即为客户端IP；对端不受信任时直接使用对端地址，客户端伪造的 X-Forwarded-For 不生效
+type Resolver struct {
+	trusted *prefixTree
+}
+
+// NewResolver 新建客户端IP解析器，trustedProxies 为受信任代理的 CIDR 或IP，为空时不信任 X-Forwarded-For
+func NewResolver(trustedProxies ...string) (*Resolver, error) {
+	r := &Resolver{trusted: newPrefixTree()}
+	for _, s := range trustedProxies {
+		prefix, err := parsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		r.trusted.insert(prefix, ActionAllow)
+	}
+	return r, nil
+}
+
+// Trusted 判断IP是否是受信任的代理
+func (r *Resolver) Trusted(ip netip.Addr) bool {
+	return r != nil && ip.IsValid() && r.trusted.lookup(ip) == ActionAllow
+}
+
+// ClientIP 返回请求的客户端IP，r 为空时只使用连接对端地址
+func (r *Resolver) ClientIP(req *http.Request) netip.Addr {
+	ip := AddrOf(req.RemoteAddr)
+	if !r.Trusted(ip) {
+		return ip
+	}
+	values := req.Header.Values("X-Forwarded-For")
+	for i := len(values) - 1; i >= 0; i-- {
+		hops := strings.Split(values[i], ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[j]))
+			if err != nil {
+				// 链路中出现无效地址时不再继续往左信任
+				return ip
+			}
+			ip = hop.Unmap()
+			if !r.Trusted(ip) {
+				return ip
+			}
+		}
+	}
+	return ip
+}
+
+// AddrOf 解析 host:port 或纯IP形式的地址，失败时返回无效地址
+func AddrOf(addr string) netip.Addr {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ip.Unmap()
+}
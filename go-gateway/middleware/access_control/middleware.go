@@ -0,0 +1,64 @@
+package access_control
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware"
+)
+
+// HTTPMiddleware HTTP访问控制中间件，挂在路由组上即为该路由的黑白名单，不允许访问时返回 403
+//
+// resolver 为空时只按连接对端地址判断
+func HTTPMiddleware(acl *ACL, resolver *Resolver) middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		if ip := resolver.ClientIP(c.Req); !acl.Allowed(ip) {
+			log.Printf("access_control: deny %s %s from %v", c.Req.Method, c.Req.URL.Path, ip)
+			http.Error(c.Rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// TCPMiddleware TCP访问控制中间件，挂在按监听地址划分的路由组上，不允许访问时直接关闭连接
+func TCPMiddleware(acl *ACL) middleware.TCPHandlerFunc {
+	return func(c *middleware.TCPSliceRouterContext) {
+		if !acl.Allowed(AddrOf(c.Conn.RemoteAddr().String())) {
+			c.Conn.Close()
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Listener 在 Accept 阶段按黑白名单过滤连接，可直接传给 TCPServer.Serve 或 http.Server.Serve，
+// 即为该监听端口的黑白名单。配合 PROXY protocol 时包装在 ProxyProtoListener 外层：
+//
+//	NewListener(NewProxyProtoListener(l, resolver), acl)
+type Listener struct {
+	net.Listener
+	acl *ACL
+}
+
+// NewListener 包装监听器，不允许访问的连接在交给服务器处理前就被关闭
+func NewListener(l net.Listener, acl *ACL) *Listener {
+	return &Listener{Listener: l, acl: acl}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if !l.acl.Allowed(AddrOf(conn.RemoteAddr().String())) {
+			log.Printf("access_control: deny connection from %v", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
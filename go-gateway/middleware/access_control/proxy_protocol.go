@@ -0,0 +1,215 @@
+package access_control
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrProxyHeader = errors.New("access_control: invalid PROXY protocol header")
+
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// ProxyProtoListener 解析 PROXY protocol（v1 文本格式和 v2 二进制格式）头部的监听器
+//
+// 只有受信任的对端（前置的 LB）发来的头部才会被采信，连接的 RemoteAddr 替换为头部中的客户端地址；
+// 不受信任的对端原样返回。头部在独立的协程中读取，慢连接不会阻塞 Accept
+type ProxyProtoListener struct {
+	net.Listener
+	Resolver      *Resolver     // 受信任的代理
+	HeaderTimeout time.Duration // 读取头部的超时时间
+
+	once  sync.Once
+	conns chan acceptResult
+	done  chan struct{}
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// NewProxyProtoListener 新建 PROXY protocol 监听器
+func NewProxyProtoListener(l net.Listener, resolver *Resolver) *ProxyProtoListener {
+	return &ProxyProtoListener{
+		Listener:      l,
+		Resolver:      resolver,
+		HeaderTimeout: 5 * time.Second,
+		conns:         make(chan acceptResult),
+		done:          make(chan struct{}),
+	}
+}
+
+func (l *ProxyProtoListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { go l.acceptLoop() })
+	select {
+	case r := <-l.conns:
+		return r.conn, r.err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *ProxyProtoListener) Close() error {
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	return l.Listener.Close()
+}
+
+func (l *ProxyProtoListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.conns <- acceptResult{err: err}:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if !l.Resolver.Trusted(AddrOf(conn.RemoteAddr().String())) {
+			l.deliver(conn)
+			continue
+		}
+		go func() {
+			wrapped, err := l.readHeader(conn)
+			if err != nil {
+				log.Printf("access_control: read PROXY header from %v: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			l.deliver(wrapped)
+		}()
+	}
+}
+
+func (l *ProxyProtoListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- acceptResult{conn: conn}:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *ProxyProtoListener) readHeader(conn net.Conn) (net.Conn, error) {
+	if l.HeaderTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(l.HeaderTimeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+	reader := bufio.NewReader(conn)
+	src, err := ReadProxyHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := &proxyConn{Conn: conn, reader: reader}
+	if src != nil {
+		wrapped.remoteAddr = src
+	}
+	return wrapped, nil
+}
+
+// ReadProxyHeader 读取 PROXY protocol 头部，返回客户端地址；LOCAL/UNKNOWN 连接返回 nil
+func ReadProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	peek, err := r.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(peek, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	return readProxyV1(r)
+}
+
+// readProxyV1 解析 "PROXY TCP4 <src> <dst> <srcport> <dstport>\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > 107 || !strings.HasSuffix(line, "\r\n") {
+		return nil, ErrProxyHeader
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, ErrProxyHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrProxyHeader
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, ErrProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, ErrProxyHeader
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// readProxyV2 解析二进制头部：12 字节签名、版本/命令、地址族/协议、2 字节长度、地址信息
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, ErrProxyHeader
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if header[12]&0x0f == 0 {
+		// LOCAL 命令：LB 自己的健康检查连接
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1: // AF_INET
+		if len(payload) < 12 {
+			return nil, ErrProxyHeader
+		}
+		ip := netip.AddrFrom4([4]byte(payload[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(payload[8:10]))), nil
+	case 2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, ErrProxyHeader
+		}
+		ip := netip.AddrFrom16([16]byte(payload[0:16]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(payload[32:34]))), nil
+	}
+	return nil, nil
+}
+
+// proxyConn 替换了 RemoteAddr 的连接，读取时先读取解析头部时缓冲的数据
+type proxyConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) { return c.reader.Read(b) }
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
@@ -0,0 +1,66 @@
+package access_control
+
+import "net/netip"
+
+// prefixTree 按比特位展开的前缀树（基数为 2 的 radix tree），查找时间只与地址位数有关，与规则数量无关
+//
+// IPv4 与 IPv6 分别建树，IPv4-mapped IPv6 地址按 IPv4 处理
+type prefixTree struct {
+	v4, v6 *treeNode
+}
+
+type treeNode struct {
+	children [2]*treeNode
+	action   Action // 以该节点结尾的前缀对应的动作，ActionNone 表示没有前缀在此结束
+}
+
+func newPrefixTree() *prefixTree {
+	return &prefixTree{v4: &treeNode{}, v6: &treeNode{}}
+}
+
+// insert 插入前缀，同一前缀重复插入时后插入的覆盖先插入的
+func (t *prefixTree) insert(prefix netip.Prefix, action Action) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr = addr.Unmap()
+		bits -= 96
+	}
+	node := t.root(addr)
+	raw := addr.AsSlice()
+	for i := 0; i < bits; i++ {
+		bit := bitAt(raw, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &treeNode{}
+		}
+		node = node.children[bit]
+	}
+	node.action = action
+}
+
+// lookup 最长前缀匹配，返回匹配到的最具体前缀的动作
+func (t *prefixTree) lookup(addr netip.Addr) Action {
+	addr = addr.Unmap()
+	node := t.root(addr)
+	raw := addr.AsSlice()
+	action := node.action
+	for i := 0; i < len(raw)*8 && node != nil; i++ {
+		node = node.children[bitAt(raw, i)]
+		if node != nil && node.action != ActionNone {
+			action = node.action
+		}
+	}
+	return action
+}
+
+func (t *prefixTree) root(addr netip.Addr) *treeNode {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+func bitAt(raw []byte, i int) int {
+	return int(raw[i/8]>>(7-i%8)) & 1
+}
@@ -0,0 +1,220 @@
+package access_log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 并发安全的日志缓冲
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSpace(b.buf.String()), "\n")
+}
+
+// TestRotatingFile 测试按大小切割并只保留指定数量的历史文件
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f := NewRotatingFile(path, 10, 0, 2)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	defer f.Close()
+	for i := 0; i < 5; i++ {
+		if _, err := f.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("want 2 backups, got %v", backups)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "12345678\n" {
+		t.Errorf("want current file holds last line, got %q", data)
+	}
+	// 最老的历史文件被删除，保留的是最近两次切割的文件
+	if !strings.HasSuffix(backups[1], "20260101-000005.000") {
+		t.Errorf("unexpected backups %v", backups)
+	}
+}
+
+// TestAsyncWriter 测试关闭时写完队列，关闭后的写入被丢弃
+func TestAsyncWriter(t *testing.T) {
+	out := &syncBuffer{}
+	w := NewAsyncWriter(out, 100, time.Hour)
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("line\n"))
+	}
+	w.Close()
+	if lines := out.Lines(); len(lines) != 10 {
+		t.Errorf("want 10 lines flushed on close, got %d", len(lines))
+	}
+	w.Write([]byte("late\n"))
+	if w.Dropped() != 1 {
+		t.Errorf("want write after close dropped, got %d", w.Dropped())
+	}
+}
+
+// TestHTTPMiddleware 测试记录状态码、双向字节数、下游地址和重试次数
+func TestHTTPMiddleware(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	out := &syncBuffer{}
+	logger := New(out, JSONFormat{})
+	transport := NewTransport(http.DefaultTransport)
+	router := middleware.NewSliceRouter()
+	router.Group("/").Use(HTTPMiddleware(logger))
+	handler := middleware.NewSliceRouterHandler(func(c *middleware.SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			// 模拟重试：同一个请求发给下游两次
+			var res *http.Response
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequestWithContext(r.Context(), r.Method, upstream.URL+r.URL.Path, bytes.NewReader(body))
+				var err error
+				if res, err = transport.RoundTrip(req); err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 {
+					res.Body.Close()
+				}
+			}
+			defer res.Body.Close()
+			w.WriteHeader(res.StatusCode)
+			io.Copy(w, res.Body)
+		})
+	}, router)
+
+	req := httptest.NewRequest(http.MethodPost, "/api?x=1", strings.NewReader("payload"))
+	req.RemoteAddr = "1.2.3.4:5678"
+	req.Header.Set("X-Request-Id", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry struct {
+		HTTPEntry
+		Latency map[string]float64 `json:"latency"`
+	}
+	if err := json.Unmarshal([]byte(out.Lines()[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.RequestID != "req-1" || entry.ClientIP != "1.2.3.4" || entry.URI != "/api?x=1" ||
+		entry.Status != http.StatusCreated || entry.BytesIn != 7 || entry.BytesOut != 5 ||
+		entry.Upstream != strings.TrimPrefix(upstream.URL, "http://") || entry.Retries != 1 {
+		t.Errorf("unexpected entry %+v", entry.HTTPEntry)
+	}
+	if entry.Latency["total_ms"] <= 0 {
+		t.Errorf("want total latency recorded, got %v", entry.Latency)
+	}
+}
+
+// TestTransport_Hedged 测试并发的尝试中，记录拿到响应的尝试，而不是之后才返回的被取消的尝试
+func TestTransport_Hedged(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	out := &syncBuffer{}
+	logger := New(out, JSONFormat{})
+	transport := NewTransport(http.DefaultTransport)
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		slowDone := make(chan struct{})
+		go func() {
+			defer close(slowDone)
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, slow.URL, nil)
+			if _, err := transport.RoundTrip(req); err == nil {
+				t.Error("want slow attempt canceled")
+			}
+		}()
+		time.Sleep(20 * time.Millisecond)
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, fast.URL, nil)
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		cancel()
+		<-slowDone
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var entry HTTPEntry
+	if err := json.Unmarshal([]byte(out.Lines()[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Upstream != strings.TrimPrefix(fast.URL, "http://") || entry.Retries != 1 {
+		t.Errorf("want winning attempt recorded, got %+v", entry)
+	}
+}
+
+type tcpHandlerFunc func(ctx context.Context, conn net.Conn)
+
+func (f tcpHandlerFunc) Serve(ctx context.Context, conn net.Conn) { f(ctx, conn) }
+
+// TestTCPMiddleware 测试会话日志记录双向字节数和下游地址
+func TestTCPMiddleware(t *testing.T) {
+	out := &syncBuffer{}
+	logger := New(out, CombinedFormat{})
+	dial := DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("unused")
+	})
+
+	router := middleware.NewTCPSliceRouter()
+	router.Group("").Use(TCPMiddleware(logger))
+	handler := middleware.NewTCPSliceRouterHandler(func(c *middleware.TCPSliceRouterContext) tcp_proxy.TCPHandler {
+		return tcpHandlerFunc(func(ctx context.Context, conn net.Conn) {
+			dial(ctx, "tcp", "10.0.0.1:8000")
+			buf := make([]byte, 4)
+			io.ReadFull(conn, buf)
+			conn.Write([]byte("pong!!"))
+		})
+	}, router)
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte("ping"))
+		io.ReadAll(client)
+	}()
+	handler.Serve(context.Background(), server)
+	server.Close()
+
+	line := out.Lines()[0]
+	if !strings.Contains(line, `"tcp pipe -> 10.0.0.1:8000" 4 6`) {
+		t.Errorf("unexpected session log %q", line)
+	}
+}
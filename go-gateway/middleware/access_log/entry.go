@@ -0,0 +1,122 @@
+package access_log
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// HTTPEntry 一次 HTTP 代理请求的访问日志
+type HTTPEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	BytesIn   int64     `json:"bytes_in"`
+	BytesOut  int64     `json:"bytes_out"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Upstream  string    `json:"upstream,omitempty"` // 第一个拿到响应的尝试的下游地址，后续的重试会覆盖
+	Retries   int       `json:"retries"`            // 重试、对冲请求的次数，即尝试次数减一
+	Latency   Latency   `json:"latency"`
+}
+
+// Latency 请求耗时分解，复用连接时 Dial/TLS 为 0
+//
+// 下游相关耗时和 Upstream 取第一个拿到响应的尝试，之后先后发生的重试会覆盖它；
+// 同时进行的对冲请求中落后的尝试不覆盖，所有尝试都失败时取先失败的
+type Latency struct {
+	Dial  time.Duration
+	TLS   time.Duration
+	TTFB  time.Duration // 请求写完到收到下游第一个响应字节
+	Total time.Duration
+}
+
+// MarshalJSON 耗时以毫秒输出
+func (l Latency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Dial  float64 `json:"dial_ms"`
+		TLS   float64 `json:"tls_ms"`
+		TTFB  float64 `json:"ttfb_ms"`
+		Total float64 `json:"total_ms"`
+	}{millis(l.Dial), millis(l.TLS), millis(l.TTFB), millis(l.Total)})
+}
+
+// SessionEntry 一个 TCP/UDP 会话的访问日志
+type SessionEntry struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"request_id,omitempty"`
+	Protocol  string        `json:"protocol"` // tcp 或 udp
+	Client    string        `json:"client"`
+	Local     string        `json:"local,omitempty"`
+	Upstream  string        `json:"upstream,omitempty"`
+	Duration  time.Duration `json:"-"`
+	BytesIn   int64         `json:"bytes_in"`  // 从客户端收到的字节数
+	BytesOut  int64         `json:"bytes_out"` // 发给客户端的字节数
+	Error     string        `json:"error,omitempty"`
+}
+
+// Format 访问日志格式
+type Format interface {
+	FormatHTTP(e *HTTPEntry) []byte
+	FormatSession(e *SessionEntry) []byte
+}
+
+// JSONFormat 每行一个 JSON 对象
+type JSONFormat struct{}
+
+func (JSONFormat) FormatHTTP(e *HTTPEntry) []byte {
+	data, _ := json.Marshal(e)
+	return append(data, '\n')
+}
+
+func (JSONFormat) FormatSession(e *SessionEntry) []byte {
+	data, _ := json.Marshal(struct {
+		*SessionEntry
+		DurationMs float64 `json:"duration_ms"`
+	}{e, millis(e.Duration)})
+	return append(data, '\n')
+}
+
+// CombinedFormat Apache/Nginx combined 日志格式，末尾追加下游地址、重试次数、耗时和请求ID：
+//
+//	1.2.3.4 - - [19/Oct/2026:14:03:34 +0800] "GET /api HTTP/1.1" 200 512 "-" "curl/8.0" upstream=10.0.0.1:80 retries=0 dial=1.2 tls=0.0 ttfb=3.4 rt=5.0 request_id=01JAB...
+type CombinedFormat struct{}
+
+func (CombinedFormat) FormatHTTP(e *HTTPEntry) []byte {
+	return fmt.Appendf(nil, "%s - - [%s] \"%s %s %s\" %d %d \"%s\" \"%s\" upstream=%s retries=%d dial=%.1f tls=%.1f ttfb=%.1f rt=%.1f request_id=%s\n",
+		orDash(e.ClientIP), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, escape(e.URI), e.Proto, e.Status, e.BytesOut,
+		orDash(escape(e.Referer)), orDash(escape(e.UserAgent)), orDash(e.Upstream), e.Retries,
+		millis(e.Latency.Dial), millis(e.Latency.TLS), millis(e.Latency.TTFB), millis(e.Latency.Total), orDash(escape(e.RequestID)))
+}
+
+func (CombinedFormat) FormatSession(e *SessionEntry) []byte {
+	line := fmt.Appendf(nil, "%s - - [%s] \"%s %s -> %s\" %d %d duration=%.1f",
+		orDash(e.Client), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Protocol, orDash(e.Local), orDash(e.Upstream), e.BytesIn, e.BytesOut, millis(e.Duration))
+	if e.RequestID != "" {
+		line = append(line, " request_id="+escape(e.RequestID)...)
+	}
+	if e.Error != "" {
+		line = append(line, " error=\""+escape(e.Error)+"\""...)
+	}
+	return append(line, '\n')
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// millis 转换为毫秒，保留到微秒
+func millis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
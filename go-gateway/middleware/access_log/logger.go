@@ -0,0 +1,315 @@
+package access_log
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/middleware/request_id"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Logger 访问日志记录器
+type Logger struct {
+	out    io.Writer
+	format Format
+}
+
+// New 新建访问日志记录器，out 通常是 NewAsyncWriter(NewRotatingFile(...))
+func New(out io.Writer, format Format) *Logger {
+	return &Logger{out: out, format: format}
+}
+
+// LogHTTP 记录一条 HTTP 访问日志
+func (l *Logger) LogHTTP(e *HTTPEntry) { l.out.Write(l.format.FormatHTTP(e)) }
+
+// LogSession 记录一条 TCP/UDP 会话日志
+func (l *Logger) LogSession(e *SessionEntry) { l.out.Write(l.format.FormatSession(e)) }
+
+type contextKey struct{}
+
+// record 一次请求的日志记录，对冲请求会并发更新下游信息，需要加锁
+type record struct {
+	mu       sync.Mutex
+	entry    HTTPEntry
+	attempts int
+
+	recorded  time.Time // 已记录的尝试的结束时间
+	succeeded bool      // 已记录的尝试是否拿到了响应
+}
+
+// Handler 包装 http.Handler，请求结束后记录访问日志；
+// 下游地址、重试次数和耗时分解需要 ReverseProxy 的 Transport 使用 NewTransport 包装
+func (l *Logger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec, req := l.begin(req)
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, req)
+		l.end(rec, rw)
+	})
+}
+
+// HTTPMiddleware 访问日志中间件，放在中间件链最前面才能统计完整耗时
+func HTTPMiddleware(l *Logger) middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		rec, req := l.begin(c.Req)
+		rw := &responseRecorder{ResponseWriter: c.Rw}
+		c.Req, c.Ctx, c.Rw = req, req.Context(), rw
+		c.Next()
+		c.Rw = rw.ResponseWriter
+		l.end(rec, rw)
+	}
+}
+
+func (l *Logger) begin(req *http.Request) (*record, *http.Request) {
+	rec := &record{entry: HTTPEntry{
+		Time:      time.Now(),
+		RequestID: requestID(req),
+		ClientIP:  hostOf(req.RemoteAddr),
+		Method:    req.Method,
+		Host:      req.Host,
+		URI:       req.RequestURI,
+		Proto:     req.Proto,
+		Referer:   req.Referer(),
+		UserAgent: req.UserAgent(),
+	}}
+	if rec.entry.URI == "" {
+		rec.entry.URI = req.URL.RequestURI()
+	}
+	req = req.WithContext(context.WithValue(req.Context(), contextKey{}, rec))
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingReader{ReadCloser: req.Body, n: &rec.entry.BytesIn}
+	}
+	return rec, req
+}
+
+func (l *Logger) end(rec *record, rw *responseRecorder) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	e := &rec.entry
+	e.Status = rw.status
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+	e.BytesOut = rw.bytes
+	e.Latency.Total = time.Since(e.Time)
+	if rec.attempts > 1 {
+		e.Retries = rec.attempts - 1
+	}
+	l.LogHTTP(e)
+}
+
+// Transport 记录下游地址、尝试次数，并通过 httptrace 统计拨号、TLS 握手和首字节耗时
+//
+// 放在重试、对冲 Transport 之下，每次尝试都会经过它
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport 新建记录下游信息的 Transport
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rec, ok := req.Context().Value(contextKey{}).(*record)
+	if !ok {
+		return base.RoundTrip(req)
+	}
+	rec.mu.Lock()
+	rec.attempts++
+	rec.mu.Unlock()
+
+	// 请求被取消后拨号可能仍在后台进行，回调和 RoundTrip 不一定在同一个协程
+	var mu sync.Mutex
+	var latency Latency
+	var dialStart, tlsStart, wroteRequest time.Time
+	update := func(f func()) {
+		mu.Lock()
+		f()
+		mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		ConnectStart:      func(string, string) { update(func() { dialStart = time.Now() }) },
+		ConnectDone:       func(string, string, error) { update(func() { latency.Dial = time.Since(dialStart) }) },
+		TLSHandshakeStart: func() { update(func() { tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			update(func() { latency.TLS = time.Since(tlsStart) })
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { update(func() { wroteRequest = time.Now() }) },
+		GotFirstResponseByte: func() { update(func() { latency.TTFB = time.Since(wroteRequest) }) },
+	}
+	start := time.Now()
+	res, err := base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+
+	mu.Lock()
+	attempt := latency
+	mu.Unlock()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	// 重试是先后发生的，后一次尝试覆盖前一次；对冲的尝试同时进行，落后的尝试被取消后才返回，
+	// 只记录第一个拿到响应的尝试，都失败时记录先失败的
+	sequential := rec.recorded.IsZero() || start.After(rec.recorded)
+	if !sequential && (err != nil || rec.succeeded) {
+		return res, err
+	}
+	rec.recorded, rec.succeeded = time.Now(), err == nil
+	rec.entry.Upstream = req.URL.Host
+	attempt.Total = rec.entry.Latency.Total
+	rec.entry.Latency = attempt
+	return res, err
+}
+
+// Session TCP/UDP 会话，字节数可并发累加
+type Session struct {
+	logger   *Logger
+	entry    SessionEntry
+	upstream atomic.Value
+	in, out  atomic.Int64
+	once     sync.Once
+}
+
+// StartSession 开始记录一个会话，会话结束时调用 End 输出日志；UDP 代理按客户端地址维护会话即可复用
+func (l *Logger) StartSession(protocol, client, local string) *Session {
+	return &Session{logger: l, entry: SessionEntry{Time: time.Now(), Protocol: protocol, Client: client, Local: local}}
+}
+
+// SetUpstream 记录会话的下游地址
+func (s *Session) SetUpstream(addr string) { s.upstream.Store(addr) }
+
+// AddIn 累加从客户端收到的字节数
+func (s *Session) AddIn(n int64) { s.in.Add(n) }
+
+// AddOut 累加发给客户端的字节数
+func (s *Session) AddOut(n int64) { s.out.Add(n) }
+
+// End 结束会话并输出日志，多次调用只输出一次
+func (s *Session) End(err error) {
+	s.once.Do(func() {
+		e := s.entry
+		e.Duration = time.Since(e.Time)
+		e.BytesIn, e.BytesOut = s.in.Load(), s.out.Load()
+		if upstream, ok := s.upstream.Load().(string); ok {
+			e.Upstream = upstream
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		s.logger.LogSession(&e)
+	})
+}
+
+// TCPMiddleware TCP会话日志中间件：统计双向字节数，会话结束时输出日志；
+// 下游地址需要 TCPReverseProxy 的 DialContext 使用 DialContext 包装
+func TCPMiddleware(l *Logger) middleware.TCPHandlerFunc {
+	return func(c *middleware.TCPSliceRouterContext) {
+		session := l.StartSession("tcp", c.Conn.RemoteAddr().String(), c.Conn.LocalAddr().String())
+		session.entry.RequestID = request_id.FromContext(c.Ctx)
+		conn := c.Conn
+		c.Conn = &countingConn{Conn: conn, session: session}
+		c.Ctx = context.WithValue(c.Ctx, contextKey{}, session)
+		defer func() {
+			c.Conn = conn
+			session.End(nil)
+		}()
+		c.Next()
+	}
+}
+
+// DialContext 包装拨号函数，把拨号地址记录为会话的下游地址，dial 为空时使用 net.Dialer
+func DialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if session, ok := ctx.Value(contextKey{}).(*Session); ok {
+			session.SetUpstream(address)
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+// requestID 优先使用请求ID中间件放入 context 的请求ID
+func requestID(req *http.Request) string {
+	if id := request_id.FromContext(req.Context()); id != "" {
+		return id
+	}
+	return req.Header.Get(request_id.Header)
+}
+
+// countingConn 统计会话字节数的连接
+type countingConn struct {
+	net.Conn
+	session *Session
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.session.AddIn(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.session.AddOut(int64(n))
+	return n, err
+}
+
+// responseRecorder 记录响应状态码和字节数
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// countingReader 统计请求体字节数
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,216 @@
+package access_log
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RotatingFile 按大小和时间切割的日志文件
+//
+// 当前文件写满 MaxSize 字节或距打开超过 MaxAge 时，重命名为 <Path>.<时间戳> 并重新打开，
+// 只保留最近 MaxBackups 个历史文件
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64         // 0 表示不按大小切割
+	MaxAge     time.Duration // 0 表示不按时间切割
+	MaxBackups int           // 0 表示保留全部历史文件
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time
+}
+
+// NewRotatingFile 新建按大小和时间切割的日志文件
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) *RotatingFile {
+	return &RotatingFile{Path: path, MaxSize: maxSize, MaxAge: maxAge, MaxBackups: maxBackups, now: time.Now}
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	if f.file != nil && f.shouldRotate(now, int64(len(p))) {
+		if err := f.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	if f.file == nil {
+		if err := f.open(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close 关闭当前文件
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) shouldRotate(now time.Time, n int64) bool {
+	return (f.MaxSize > 0 && f.size > 0 && f.size+n > f.MaxSize) ||
+		(f.MaxAge > 0 && now.Sub(f.openedAt) >= f.MaxAge)
+}
+
+func (f *RotatingFile) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), now
+	return nil
+}
+
+func (f *RotatingFile) rotate(now time.Time) error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := fmt.Sprintf("%s.%s", f.Path, now.Format("20060102-150405.000"))
+	if err := os.Rename(f.Path, backup); err != nil {
+		return err
+	}
+	f.removeOldBackups()
+	return nil
+}
+
+// removeOldBackups 删除超出 MaxBackups 的历史文件，时间戳格式保证按文件名排序即按时间排序
+func (f *RotatingFile) removeOldBackups() {
+	if f.MaxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(f.Path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Strings(backups)
+	for len(backups) > f.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			log.Printf("access_log: remove old log %s: %v", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// AsyncWriter 异步缓冲写入器：日志先放入有界队列，由后台协程批量写入，
+// 不会因为磁盘慢阻塞请求；队列满时丢弃日志并计数
+type AsyncWriter struct {
+	out     io.Writer
+	queue   chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+
+	mu     sync.RWMutex // 保护 closed，关闭后的写入直接丢弃
+	closed bool
+}
+
+// NewAsyncWriter 新建异步写入器，queueSize 为最多排队的日志条数，每隔 flushInterval 刷新一次缓冲
+func NewAsyncWriter(out io.Writer, queueSize int, flushInterval time.Duration) *AsyncWriter {
+	w := &AsyncWriter{out: out, queue: make(chan []byte, queueSize), done: make(chan struct{})}
+	go w.run(flushInterval)
+	return w
+}
+
+// Write 把一条日志放入队列，p 会被拷贝
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	line := append([]byte(nil), p...)
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return len(p), nil
+	}
+	select {
+	case w.queue <- line:
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Dropped 返回因队列满而丢弃的日志条数
+func (w *AsyncWriter) Dropped() int64 { return w.dropped.Load() }
+
+// Close 写完队列中剩余的日志并关闭底层写入器
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+	if closer, ok := w.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (w *AsyncWriter) run(flushInterval time.Duration) {
+	defer close(w.done)
+	// 按整行攒批写入，保证切割文件时不会把一行日志拆到两个文件中
+	const batchSize = 64 << 10
+	batch := make([]byte, 0, batchSize)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if _, err := w.out.Write(batch); err != nil {
+			log.Printf("access_log: write failed: %v", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case line, ok := <-w.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch)+len(line) > batchSize {
+				flush()
+			}
+			batch = append(batch, line...)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// escape 日志字段中的引号和换行转义，防止日志注入
+func escape(s string) string {
+	if !strings.ContainsAny(s, "\"\\\n\r") {
+		return s
+	}
+	r := strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`, "\r", `\r`)
+	return r.Replace(s)
+}
@@ -0,0 +1,74 @@
+package concurrency_limit
+
+import (
+	"sync"
+	"time"
+)
+
+// FixedLimit 固定并发上限
+type FixedLimit int
+
+func (l FixedLimit) Limit() int { return int(l) }
+
+func (l FixedLimit) OnSample(int, time.Duration, Outcome) {}
+
+// AIMDLimit 按观测延迟自适应调整的并发上限（加性增、乘性减）
+//
+//  1. 记录一段时间内的最小延迟作为下游无排队时的基准延迟
+//  2. 请求被丢弃，或延迟超过 基准延迟*Tolerance 时，说明下游开始排队，上限乘以 BackoffRatio
+//  3. 否则在并发接近上限时（inFlight*2 >= limit）上限加一，避免空闲时上限无限增长
+//  4. 基准延迟每 ProbeInterval 重置一次，使下游扩容或变慢后能重新收敛
+type AIMDLimit struct {
+	MinLimit      int
+	MaxLimit      int
+	BackoffRatio  float64       // 乘性减小比例，如 0.9
+	Tolerance     float64       // 延迟超过基准延迟的倍数视为过载，如 2
+	ProbeInterval time.Duration // 基准延迟的重置周期
+
+	mu         sync.Mutex
+	limit      float64
+	minLatency time.Duration
+	probeAt    time.Time
+	now        func() time.Time
+}
+
+// NewAIMDLimit 新建自适应并发上限，初始上限为 initial
+func NewAIMDLimit(initial, minLimit, maxLimit int) *AIMDLimit {
+	return &AIMDLimit{
+		MinLimit:      minLimit,
+		MaxLimit:      maxLimit,
+		BackoffRatio:  0.9,
+		Tolerance:     2,
+		ProbeInterval: 30 * time.Second,
+		limit:         float64(initial),
+		now:           time.Now,
+	}
+}
+
+func (l *AIMDLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *AIMDLimit) OnSample(inFlight int, latency time.Duration, outcome Outcome) {
+	if outcome == OutcomeIgnore {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if outcome == OutcomeSuccess && (l.minLatency == 0 || latency < l.minLatency || now.After(l.probeAt)) {
+		if now.After(l.probeAt) {
+			l.probeAt = now.Add(l.ProbeInterval)
+		}
+		l.minLatency = latency
+	}
+
+	switch {
+	case outcome == OutcomeDropped || float64(latency) > float64(l.minLatency)*l.Tolerance:
+		l.limit = max(l.limit*l.BackoffRatio, float64(l.MinLimit))
+	case inFlight*2 >= int(l.limit):
+		l.limit = min(l.limit+1, float64(l.MaxLimit))
+	}
+}
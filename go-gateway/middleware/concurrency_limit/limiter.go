@@ -0,0 +1,136 @@
+package concurrency_limit
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull 并发已满且等待队列已满
+	ErrQueueFull = errors.New("concurrency_limit: wait queue is full")
+	// ErrQueueTimeout 在等待队列中超过 QueueTimeout 仍未获得执行机会
+	ErrQueueTimeout = errors.New("concurrency_limit: wait queue timeout")
+)
+
+// Outcome 请求结果，用于自适应并发限制调整上限
+type Outcome int
+
+const (
+	OutcomeSuccess Outcome = iota // 请求正常完成，耗时计入延迟样本
+	OutcomeDropped                // 请求因下游过载失败（超时、503等），立即降低上限
+	OutcomeIgnore                 // 不计入样本，例如客户端取消或TCP长连接
+)
+
+// Limit 并发上限策略
+type Limit interface {
+	// Limit 当前并发上限
+	Limit() int
+	// OnSample 请求结束时回调，inFlight 为请求开始时的并发数
+	OnSample(inFlight int, latency time.Duration, outcome Outcome)
+}
+
+// Limiter 并发限制器：最多 Limit() 个请求同时执行，超出的请求进入有界等待队列，
+// 队列已满或等待超过 QueueTimeout 时拒绝
+type Limiter struct {
+	limit        Limit
+	queueSize    int
+	queueTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	waiters  *list.List // 等待中的请求，元素为 *waiter，按先来先服务
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// Stats 并发限制器当前状态
+type Stats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+}
+
+// NewLimiter 新建并发限制器，queueSize 为 0 时不排队直接拒绝
+func NewLimiter(limit Limit, queueSize int, queueTimeout time.Duration) *Limiter {
+	return &Limiter{limit: limit, queueSize: queueSize, queueTimeout: queueTimeout, waiters: list.New()}
+}
+
+// Acquire 申请执行机会，成功时返回的 release 必须在请求结束后调用一次
+func (l *Limiter) Acquire(ctx context.Context) (release func(Outcome), err error) {
+	l.mu.Lock()
+	if l.inFlight < l.limit.Limit() && l.waiters.Len() == 0 {
+		l.inFlight++
+		inFlight := l.inFlight
+		l.mu.Unlock()
+		return l.releaseFunc(inFlight), nil
+	}
+	if l.waiters.Len() >= l.queueSize {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	w := &waiter{ready: make(chan struct{})}
+	elem := l.waiters.PushBack(w)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-w.ready:
+	case <-timeout:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	if w.granted {
+		// 超时与被唤醒同时发生时，以被唤醒为准
+		inFlight := l.inFlight
+		l.mu.Unlock()
+		return l.releaseFunc(inFlight), nil
+	}
+	l.waiters.Remove(elem)
+	l.mu.Unlock()
+	return nil, err
+}
+
+// Stats 返回当前上限、执行中和排队中的请求数
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Limit: l.limit.Limit(), InFlight: l.inFlight, Queued: l.waiters.Len()}
+}
+
+func (l *Limiter) releaseFunc(inFlight int) func(Outcome) {
+	start := time.Now()
+	var once sync.Once
+	return func(outcome Outcome) {
+		once.Do(func() {
+			l.limit.OnSample(inFlight, time.Since(start), outcome)
+			l.mu.Lock()
+			l.inFlight--
+			l.wakeUp()
+			l.mu.Unlock()
+		})
+	}
+}
+
+// wakeUp 上限允许时按顺序唤醒等待中的请求，执行机会直接转交给被唤醒的请求
+func (l *Limiter) wakeUp() {
+	for l.inFlight < l.limit.Limit() && l.waiters.Len() > 0 {
+		w := l.waiters.Remove(l.waiters.Front()).(*waiter)
+		w.granted = true
+		l.inFlight++
+		close(w.ready)
+	}
+}
@@ -0,0 +1,117 @@
+package concurrency_limit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sen-golang-study/go-gateway/middleware"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestLimiter_Queue 测试并发满后排队、队列满拒绝、排队超时，以及释放后按顺序唤醒
+func TestLimiter_Queue(t *testing.T) {
+	l := NewLimiter(FixedLimit(1), 1, 50*time.Millisecond)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二个请求排队，第三个请求队列已满直接拒绝
+	acquired := make(chan func(Outcome))
+	go func() {
+		r, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- r
+	}()
+	waitFor(t, func() bool { return l.Stats().Queued == 1 })
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("want ErrQueueFull, got %v", err)
+	}
+
+	release(OutcomeSuccess)
+	queued := <-acquired
+	if s := l.Stats(); s.InFlight != 1 || s.Queued != 0 {
+		t.Fatalf("want queued request running, got %+v", s)
+	}
+
+	// 没有释放时，排队的请求超时
+	go func() {
+		_, err := l.Acquire(context.Background())
+		if !errors.Is(err, ErrQueueTimeout) {
+			t.Errorf("want ErrQueueTimeout, got %v", err)
+		}
+		acquired <- nil
+	}()
+	<-acquired
+	queued(OutcomeSuccess)
+	if s := l.Stats(); s.InFlight != 0 || s.Queued != 0 {
+		t.Errorf("want limiter idle, got %+v", s)
+	}
+}
+
+// TestAIMDLimit 测试延迟正常时上限增长，延迟升高或请求被丢弃时上限降低
+func TestAIMDLimit(t *testing.T) {
+	l := NewAIMDLimit(10, 5, 20)
+	for i := 0; i < 5; i++ {
+		l.OnSample(10, 10*time.Millisecond, OutcomeSuccess)
+	}
+	if l.Limit() != 15 {
+		t.Fatalf("want limit 15 after additive increase, got %d", l.Limit())
+	}
+	// 并发远低于上限时不增长
+	l.OnSample(1, 10*time.Millisecond, OutcomeSuccess)
+	if l.Limit() != 15 {
+		t.Fatalf("want limit unchanged when underused, got %d", l.Limit())
+	}
+	l.OnSample(15, 50*time.Millisecond, OutcomeSuccess)
+	if l.Limit() != 13 {
+		t.Fatalf("want limit 13 after latency backoff, got %d", l.Limit())
+	}
+	for i := 0; i < 20; i++ {
+		l.OnSample(15, 0, OutcomeDropped)
+	}
+	if l.Limit() != 5 {
+		t.Errorf("want limit floored at MinLimit 5, got %d", l.Limit())
+	}
+}
+
+// TestHTTPMiddleware 测试并发满时返回 503
+func TestHTTPMiddleware(t *testing.T) {
+	block := make(chan struct{})
+	router := middleware.NewSliceRouter()
+	router.Group("/").Use(HTTPMiddleware(NewLimiter(FixedLimit(1), 0, 0)))
+	handler := middleware.NewSliceRouterHandler(func(c *middleware.SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-block })
+	}, router)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("want 503 with Retry-After, got %d", rec.Code)
+	}
+	close(block)
+	wg.Wait()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
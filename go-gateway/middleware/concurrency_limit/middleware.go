@@ -0,0 +1,93 @@
+package concurrency_limit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware"
+)
+
+// HTTPMiddleware HTTP并发限制中间件，挂在路由组上即为该路由的并发限制
+//
+// 并发已满且排队失败时返回 503 和 Retry-After 头，并终止中间件链；
+// 下游返回 502/503/504 时视为过载，自适应上限会随之降低
+func HTTPMiddleware(limiter *Limiter) middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		release, err := limiter.Acquire(c.Req.Context())
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				c.Abort()
+				return
+			}
+			c.Rw.Header().Set("Retry-After", "1")
+			http.Error(c.Rw, "server is busy, please retry later", http.StatusServiceUnavailable)
+			c.Abort()
+			return
+		}
+
+		rw := c.Rw
+		recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+		c.Rw = recorder
+		defer func() {
+			c.Rw = rw
+			release(outcomeOf(c.Req.Context(), recorder.status))
+		}()
+		c.Next()
+	}
+}
+
+// TCPMiddleware TCP并发连接限制中间件，连接在整个代理期间占用一个执行机会
+//
+// 连接时长不反映下游延迟，不计入自适应样本，TCP 建议使用 FixedLimit
+func TCPMiddleware(limiter *Limiter) middleware.TCPHandlerFunc {
+	return func(c *middleware.TCPSliceRouterContext) {
+		release, err := limiter.Acquire(c.Ctx)
+		if err != nil {
+			log.Printf("concurrency_limit: reject tcp connection from %v: %v", c.Conn.RemoteAddr(), err)
+			c.Conn.Close()
+			c.Abort()
+			return
+		}
+		defer release(OutcomeIgnore)
+		c.Next()
+	}
+}
+
+func outcomeOf(ctx context.Context, status int) Outcome {
+	switch {
+	case ctx.Err() != nil:
+		return OutcomeIgnore
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout:
+		return OutcomeDropped
+	}
+	return OutcomeSuccess
+}
+
+// statusRecorder 记录下游响应的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush 透传 Flush，ReverseProxy 流式响应时需要
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
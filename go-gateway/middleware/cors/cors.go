@@ -0,0 +1,268 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sen-golang-study/go-gateway/middleware"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config 跨域配置
+type Config struct {
+	// AllowedOrigins 允许的来源，支持三种写法：
+	//	精确匹配        https://app.example.com
+	//	通配子域名      https://*.example.com（不匹配 https://example.com 本身）
+	//	正则（~开头）   ~^https://[a-z]+\.example\.(com|cn)$
+	// "*" 表示允许所有来源，不能与 AllowCredentials 同时使用；
+	// AllowCredentials 时通配写法只能通配子域名，"*" 后面必须是 ".域名"，如 https://* 会被拒绝
+	AllowedOrigins   []string
+	AllowedMethods   []string // 为空时允许 GET/HEAD/POST
+	AllowedHeaders   []string // 为空时允许预检请求中声明的所有请求头
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // 预检结果的缓存时间
+}
+
+// CORS 跨域处理器：在网关直接应答预检请求，并给转发的响应加上跨域响应头
+type CORS struct {
+	config        Config
+	allowAll      bool
+	exact         map[string]bool
+	wildcards     [][2]string // 通配子域名拆成 前缀、后缀
+	patterns      []*regexp.Regexp
+	methods       string
+	headers       map[string]bool
+	exposeHeaders string
+}
+
+// New 新建跨域处理器，正则无效、"*" 或没有限定域名的通配来源与 AllowCredentials 同时使用时返回错误
+func New(config Config) (*CORS, error) {
+	c := &CORS{config: config, exact: make(map[string]bool), headers: make(map[string]bool)}
+	for _, origin := range config.AllowedOrigins {
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.HasPrefix(origin, "~"):
+			pattern, err := regexp.Compile(origin[1:])
+			if err != nil {
+				return nil, fmt.Errorf("cors: invalid origin pattern %q: %w", origin, err)
+			}
+			c.patterns = append(c.patterns, pattern)
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(strings.ToLower(origin), "*")
+			if config.AllowCredentials && !subdomainWildcard(prefix, suffix) {
+				return nil, fmt.Errorf("cors: AllowCredentials requires wildcard origins like https://*.example.com, got %q", origin)
+			}
+			c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+		default:
+			c.exact[strings.ToLower(origin)] = true
+		}
+	}
+	// 允许所有来源又允许携带凭证，任何网站都能以用户身份跨域读取响应
+	if c.allowAll && config.AllowCredentials {
+		return nil, fmt.Errorf("cors: AllowCredentials requires an explicit origin list, not \"*\"")
+	}
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	if len(config.AllowedMethods) > 0 {
+		methods = make([]string, len(config.AllowedMethods))
+		for i, m := range config.AllowedMethods {
+			methods[i] = strings.ToUpper(m)
+		}
+	}
+	c.config.AllowedMethods = methods
+	c.methods = strings.Join(methods, ", ")
+	for _, h := range config.AllowedHeaders {
+		c.headers[strings.ToLower(h)] = true
+	}
+	c.exposeHeaders = strings.Join(config.ExposedHeaders, ", ")
+	return c, nil
+}
+
+// subdomainWildcard 判断通配来源是否只通配某个域名的子域名：
+// "*" 前面是 scheme://，后面是 ".域名[:端口]"，且域名至少有两级，如 https://*.example.com
+func subdomainWildcard(prefix, suffix string) bool {
+	if !strings.HasSuffix(prefix, "://") || !strings.HasPrefix(suffix, ".") {
+		return false
+	}
+	host, _, _ := strings.Cut(suffix[1:], ":")
+	return !strings.Contains(suffix, "*") && strings.Contains(host, ".") &&
+		!strings.HasPrefix(host, ".") && !strings.HasSuffix(host, ".")
+}
+
+// OriginAllowed 判断来源是否允许跨域访问
+func (c *CORS) OriginAllowed(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if c.exact[lower] {
+		return true
+	}
+	for _, w := range c.wildcards {
+		// 通配部分必须是非空的子域名
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) {
+			return true
+		}
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPreflight 预检请求：带 Origin 和 Access-Control-Request-Method 的 OPTIONS 请求
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// handlePreflight 应答预检请求，来源、方法或请求头不允许时只返回 204 而不带跨域响应头，由浏览器拒绝
+func (c *CORS) handlePreflight(w http.ResponseWriter, req *http.Request) {
+	header := w.Header()
+	header.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	defer w.WriteHeader(http.StatusNoContent)
+
+	origin := req.Header.Get("Origin")
+	method := strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+	if !c.OriginAllowed(origin) || !slices.Contains(c.config.AllowedMethods, method) {
+		return
+	}
+	requested := parseHeaderList(req.Header.Values("Access-Control-Request-Headers"))
+	if len(c.headers) > 0 {
+		for _, h := range requested {
+			if !c.headers[h] {
+				return
+			}
+		}
+	}
+
+	c.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", c.methods)
+	if len(requested) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.config.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.config.MaxAge.Seconds())))
+	}
+}
+
+// setOrigin 设置允许的来源：允许所有来源时返回 *，否则回显具体来源
+func (c *CORS) setOrigin(header http.Header, origin string) {
+	if c.allowAll {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.config.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func parseHeaderList(values []string) []string {
+	var headers []string
+	for _, v := range values {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+				headers = append(headers, h)
+			}
+		}
+	}
+	return headers
+}
+
+// corsWriter 在写响应头时去掉下游自己设置的跨域响应头，统一使用网关的配置，避免重复的 Allow-Origin
+type corsWriter struct {
+	http.ResponseWriter
+	cors        *CORS
+	origin      string
+	wroteHeader bool
+}
+
+func (w *corsWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.Header()
+		for name := range header {
+			if strings.HasPrefix(name, "Access-Control-") {
+				header.Del(name)
+			}
+		}
+		header.Add("Vary", "Origin")
+		if w.cors.OriginAllowed(w.origin) {
+			w.cors.setOrigin(header, w.origin)
+			if w.cors.exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", w.cors.exposeHeaders)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *corsWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *corsWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish 处理器没有写任何内容时，补上跨域响应头和默认的 200 状态码
+func (w *corsWriter) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (w *corsWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Handler 包装 http.Handler：预检请求在网关直接应答，其他跨域请求转发给 next 并加上跨域响应头
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		switch {
+		case origin == "":
+			next.ServeHTTP(w, req)
+		case isPreflight(req):
+			c.handlePreflight(w, req)
+		default:
+			cw := &corsWriter{ResponseWriter: w, cors: c, origin: origin}
+			next.ServeHTTP(cw, req)
+			cw.finish()
+		}
+	})
+}
+
+// HTTPMiddleware 跨域中间件，挂在路由组上即为该路由的跨域配置，需放在认证中间件之前，预检请求不带凭证
+func HTTPMiddleware(c *CORS) middleware.HandlerFunc {
+	return func(ctx *middleware.SliceRouterContext) {
+		origin := ctx.Req.Header.Get("Origin")
+		switch {
+		case origin == "":
+			ctx.Next()
+		case isPreflight(ctx.Req):
+			c.handlePreflight(ctx.Rw, ctx.Req)
+			ctx.Abort()
+		default:
+			rw := ctx.Rw
+			cw := &corsWriter{ResponseWriter: rw, cors: c, origin: origin}
+			ctx.Rw = cw
+			ctx.Next()
+			cw.finish()
+			ctx.Rw = rw
+		}
+	}
+}
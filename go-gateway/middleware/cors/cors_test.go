@@ -0,0 +1,114 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sen-golang-study/go-gateway/middleware"
+	"testing"
+	"time"
+)
+
+// TestOriginAllowed 测试精确、通配子域名和正则三种来源匹配
+func TestOriginAllowed(t *testing.T) {
+	c, err := New(Config{AllowedOrigins: []string{
+		"https://app.example.com", "https://*.partner.com", `~^https://[a-z]+\.example\.cn$`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"https://app.example.com":   true,
+		"https://APP.example.com":   true,
+		"http://app.example.com":    false,
+		"https://a.partner.com":     true,
+		"https://partner.com":       false,
+		"https://evilpartner.com":   false,
+		"https://shop.example.cn":   true,
+		"https://shop1.example.cn":  false,
+		"https://app.example.com.x": false,
+	}
+	for origin, want := range cases {
+		if got := c.OriginAllowed(origin); got != want {
+			t.Errorf("OriginAllowed(%s) got %v, want %v", origin, got, want)
+		}
+	}
+	for _, origin := range []string{"*", "https://*", "https://app*", "https://*.com", "*.example.com", "https://*.example.*"} {
+		if _, err := New(Config{AllowedOrigins: []string{origin}, AllowCredentials: true}); err == nil {
+			t.Errorf("want %q with credentials rejected", origin)
+		}
+	}
+	if _, err := New(Config{AllowedOrigins: []string{"https://*.example.com:8443"}, AllowCredentials: true}); err != nil {
+		t.Errorf("want subdomain wildcard with credentials accepted, got %v", err)
+	}
+}
+
+// TestHTTPMiddleware 测试预检请求由网关应答，普通跨域请求替换下游的跨域响应头
+func TestHTTPMiddleware(t *testing.T) {
+	c, _ := New(Config{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowedMethods:   []string{"get", "put"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	upstreamHits := 0
+	router := middleware.NewSliceRouter()
+	router.Group("/").Use(HTTPMiddleware(c))
+	handler := middleware.NewSliceRouterHandler(func(*middleware.SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upstreamHits++
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Write([]byte("ok"))
+		})
+	}, router)
+
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/api", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://a.example.com", "PUT", "authorization, content-type")
+	header := rec.Header()
+	if rec.Code != http.StatusNoContent || header.Get("Access-Control-Allow-Origin") != "https://a.example.com" ||
+		header.Get("Access-Control-Allow-Methods") != "GET, PUT" ||
+		header.Get("Access-Control-Allow-Headers") != "authorization, content-type" ||
+		header.Get("Access-Control-Allow-Credentials") != "true" || header.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("unexpected preflight response %d %v", rec.Code, header)
+	}
+	for _, denied := range []*httptest.ResponseRecorder{
+		preflight("https://evil.com", "PUT", ""),
+		preflight("https://a.example.com", "DELETE", ""),
+		preflight("https://a.example.com", "GET", "X-Custom"),
+	} {
+		if denied.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("want preflight denied, got %v", denied.Header())
+		}
+	}
+	if upstreamHits != 0 {
+		t.Errorf("want preflight answered at gateway, upstream hit %d times", upstreamHits)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.Header.Set("Origin", "https://a.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if values := rec.Header().Values("Access-Control-Allow-Origin"); len(values) != 1 || values[0] != "https://a.example.com" {
+		t.Errorf("want single echoed origin, got %v", values)
+	}
+	if rec.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" || rec.Header().Get("Vary") != "Origin" {
+		t.Errorf("unexpected response headers %v", rec.Header())
+	}
+
+	req.Header.Set("Origin", "https://evil.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("want upstream cors header removed for denied origin, got %v", rec.Header())
+	}
+}
@@ -0,0 +1,247 @@
+package jwt_auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sen-golang-study/go-gateway/middleware"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sign 在测试进程内签发 JWT
+func sign(t *testing.T, header Header, claims Claims, key any) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwksOf(kid string, pub any) []byte {
+	enc := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var key map[string]string
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		key = map[string]string{"kty": "RSA", "n": enc(pub.N.Bytes()), "e": enc(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		key = map[string]string{"kty": "EC", "crv": "P-256", "x": enc(pub.X.Bytes()), "y": enc(pub.Y.Bytes())}
+	}
+	key["kid"], key["use"] = kid, "sig"
+	data, _ := json.Marshal(map[string]any{"keys": []any{key}})
+	return data
+}
+
+// TestValidator 测试三种签名算法及 exp/nbf/iss/aud 校验
+func TestValidator(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	secret := []byte("secret")
+	keys := StaticKeys{"hs": secret, "rs": &rsaKey.PublicKey, "es": &ecKey.PublicKey}
+
+	now := time.Unix(1700000000, 0)
+	v := NewValidator(keys)
+	v.Issuer, v.Audience = "https://auth.example.com", "gateway"
+	v.now = func() time.Time { return now }
+	valid := Claims{"iss": "https://auth.example.com", "aud": []any{"gateway"}, "exp": float64(now.Unix() + 60)}
+	with := func(k string, value any) Claims {
+		c := Claims{}
+		for key, v := range valid {
+			c[key] = v
+		}
+		c[k] = value
+		return c
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"hs256", sign(t, Header{Alg: HS256, Kid: "hs"}, valid, secret), nil},
+		{"rs256", sign(t, Header{Alg: RS256, Kid: "rs"}, valid, rsaKey), nil},
+		{"es256", sign(t, Header{Alg: ES256, Kid: "es"}, valid, ecKey), nil},
+		{"wrong secret", sign(t, Header{Alg: HS256, Kid: "hs"}, valid, []byte("other")), ErrInvalidSignature},
+		{"alg confusion", sign(t, Header{Alg: HS256, Kid: "rs"}, valid, secret), ErrKeyNotFound},
+		{"none alg", sign(t, Header{Alg: "none", Kid: "hs"}, valid, secret), ErrUnsupportedAlg},
+		{"unknown kid", sign(t, Header{Alg: HS256, Kid: "x"}, valid, secret), ErrKeyNotFound},
+		{"expired", sign(t, Header{Alg: HS256, Kid: "hs"}, with("exp", float64(now.Unix()-60)), secret), ErrExpired},
+		{"leeway", sign(t, Header{Alg: HS256, Kid: "hs"}, with("exp", float64(now.Unix()-10)), secret), nil},
+		{"not before", sign(t, Header{Alg: HS256, Kid: "hs"}, with("nbf", float64(now.Unix()+60)), secret), ErrNotYetValid},
+		{"issuer", sign(t, Header{Alg: HS256, Kid: "hs"}, with("iss", "evil"), secret), ErrInvalidIssuer},
+		{"audience", sign(t, Header{Alg: HS256, Kid: "hs"}, with("aud", "other"), secret), ErrInvalidAudience},
+		{"malformed", "a.b", ErrMalformed},
+	}
+	for _, c := range cases {
+		_, err := v.Validate(c.token)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: want %v, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+// TestRemoteKeySet_Rotation 测试签发方轮换密钥后，遇到未知 kid 时重新拉取 JWKS
+func TestRemoteKeySet_Rotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var rotated atomic.Bool
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if rotated.Load() {
+			w.Write(jwksOf("k2", &newKey.PublicKey))
+			return
+		}
+		w.Write(jwksOf("k1", &oldKey.PublicKey))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	keys := NewRemoteKeySet(server.URL, nil)
+	keys.now = func() time.Time { return now }
+	v := NewValidator(keys)
+
+	if _, err := v.Validate(sign(t, Header{Alg: ES256, Kid: "k1"}, Claims{}, oldKey)); err != nil {
+		t.Fatal(err)
+	}
+	rotated.Store(true)
+	newToken := sign(t, Header{Alg: ES256, Kid: "k2"}, Claims{}, newKey)
+	// 距上次拉取不足 MinRefreshInterval，不重新拉取
+	if _, err := v.Validate(newToken); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("want ErrKeyNotFound before refresh interval, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := v.Validate(newToken); err != nil {
+		t.Fatalf("want rotated key accepted, got %v", err)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("want 2 jwks fetches, got %d", fetches.Load())
+	}
+}
+
+// TestRemoteKeySet_SlowRefresh 测试拉取 JWKS 时不阻塞已知 kid 的校验，并发的未知 kid 只触发一次拉取
+func TestRemoteKeySet_SlowRefresh(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.Write(jwksOf("k1", &key.PublicKey))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	now := time.Unix(1700000000, 0)
+	keys := NewRemoteKeySet(server.URL, nil)
+	keys.now = func() time.Time { return now }
+	v := NewValidator(keys)
+	token := sign(t, Header{Alg: ES256, Kid: "k1"}, Claims{}, key)
+	if _, err := v.Validate(token); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute)
+	unknown := sign(t, Header{Alg: ES256, Kid: "k9"}, Claims{}, key)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.Validate(unknown)
+		}()
+	}
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	if _, err := v.Validate(token); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("known kid blocked by refresh for %v", elapsed)
+	}
+	release <- struct{}{}
+	wg.Wait()
+	if fetches.Load() != 2 {
+		t.Errorf("want 2 jwks fetches, got %d", fetches.Load())
+	}
+}
+
+// TestHTTPMiddleware 测试认证失败返回 401、声明转发为请求头、授权范围不足返回 403
+func TestHTTPMiddleware(t *testing.T) {
+	secret := []byte("secret")
+	v := NewValidator(StaticKeys{"": secret})
+	v.ClaimHeaders = map[string]string{"sub": "X-User-Id"}
+
+	router := middleware.NewSliceRouter()
+	router.Group("/").Use(HTTPMiddleware(v))
+	router.Group("/admin").Use(HTTPMiddleware(v), RequireScopes("admin"))
+	handler := middleware.NewSliceRouterHandler(func(c *middleware.SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.Header.Get("X-User-Id"))
+		})
+	}, router)
+
+	token := sign(t, Header{Alg: HS256}, Claims{"sub": "u1", "scope": "read write"}, secret)
+	cases := []struct {
+		path, auth, spoof string
+		status            int
+		body              string
+	}{
+		{"/api", "", "", http.StatusUnauthorized, ""},
+		{"/api", "Bearer bad.token.value", "", http.StatusUnauthorized, ""},
+		{"/api", "Bearer " + token, "u2", http.StatusOK, "u1"},
+		{"/admin", "Bearer " + token, "", http.StatusForbidden, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		if c.spoof != "" {
+			req.Header.Set("X-User-Id", c.spoof)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s %q: want status %d, got %d", c.path, c.auth, c.status, rec.Code)
+		}
+		if c.body != "" && rec.Body.String() != c.body {
+			t.Errorf("%s: want forwarded user %q, got %q", c.path, c.body, rec.Body.String())
+		}
+	}
+}
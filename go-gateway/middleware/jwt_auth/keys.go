@@ -0,0 +1,225 @@
+package jwt_auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeySet 按 JWT 头部返回校验签名的密钥
+type KeySet interface {
+	Key(header Header) (crypto.PublicKey, error)
+}
+
+// StaticKeys 固定的密钥集合，key 为 kid，kid 为空的 token 使用 "" 对应的密钥
+type StaticKeys map[string]crypto.PublicKey
+
+func (k StaticKeys) Key(header Header) (crypto.PublicKey, error) {
+	if key, ok := k[header.Kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, header.Kid)
+}
+
+// jwk JSON Web Key，只解析 RSA、EC(P-256) 和对称密钥用到的字段
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS 解析 JWKS 文档，返回按 kid 索引的密钥，跳过不支持或用途不是签名的密钥
+func ParseJWKS(data []byte) (StaticKeys, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("jwt_auth: parse jwks: %w", err)
+	}
+	keys := make(StaticKeys, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("jwt_auth: skip jwk %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := decodeBigInt(k.N)
+		e, err2 := decodeBigInt(k.E)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := decodeBigInt(k.X)
+		y, err2 := decodeBigInt(k.Y)
+		if err := errors.Join(err1, err2); err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return pub, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// cachedKeySet 缓存从文件或URL加载的 JWKS
+//
+//   - 缓存超过 TTL 后在后台重新加载，加载完成前继续使用旧密钥
+//   - 遇到未知 kid 时认为签发方轮换了密钥，立即重新加载，但两次加载至少间隔 MinRefreshInterval，防止伪造 kid 刷爆加载
+//   - 同一时间只有一个加载在进行，加载不持有锁，只有等待新密钥的请求会被阻塞
+//   - 加载失败时继续使用旧密钥
+type cachedKeySet struct {
+	TTL                time.Duration
+	MinRefreshInterval time.Duration
+
+	load       func() ([]byte, error)
+	mu         sync.Mutex
+	keys       StaticKeys
+	loadedAt   time.Time
+	refreshing chan struct{} // 正在进行的加载，加载完成时关闭
+	now        func() time.Time
+}
+
+func newCachedKeySet(load func() ([]byte, error)) *cachedKeySet {
+	return &cachedKeySet{TTL: 10 * time.Minute, MinRefreshInterval: 30 * time.Second, load: load, now: time.Now}
+}
+
+func (s *cachedKeySet) Key(header Header) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	now := s.now()
+	keys := s.keys
+	var done chan struct{}
+	if keys == nil || now.Sub(s.loadedAt) >= s.TTL {
+		done = s.startRefresh(now)
+	}
+	s.mu.Unlock()
+	if keys != nil {
+		if key, err := keys.Key(header); err == nil {
+			return key, nil
+		}
+	}
+
+	s.mu.Lock()
+	if done == nil {
+		if s.refreshing != nil {
+			done = s.refreshing
+		} else if now.Sub(s.loadedAt) >= s.MinRefreshInterval {
+			done = s.startRefresh(now)
+		}
+	}
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	s.mu.Lock()
+	keys = s.keys
+	s.mu.Unlock()
+	return keys.Key(header)
+}
+
+// startRefresh 在后台加载 JWKS，已有加载在进行时复用它；调用方需持有 s.mu
+func (s *cachedKeySet) startRefresh(now time.Time) chan struct{} {
+	if s.refreshing != nil {
+		return s.refreshing
+	}
+	done := make(chan struct{})
+	s.refreshing = done
+	s.loadedAt = now
+	go func() {
+		defer close(done)
+		data, err := s.load()
+		var keys StaticKeys
+		if err == nil {
+			keys, err = ParseJWKS(data)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.refreshing = nil
+		if err != nil {
+			log.Printf("jwt_auth: load jwks failed, keep %d cached keys: %v", len(s.keys), err)
+			return
+		}
+		s.keys = keys
+	}()
+	return done
+}
+
+// FileKeySet 从本地 JWKS 文件加载的密钥
+type FileKeySet struct {
+	*cachedKeySet
+}
+
+// NewFileKeySet 新建从本地 JWKS 文件加载的密钥集合，默认每分钟重新读取一次文件
+func NewFileKeySet(path string) *FileKeySet {
+	s := newCachedKeySet(func() ([]byte, error) { return os.ReadFile(path) })
+	s.TTL = time.Minute
+	s.MinRefreshInterval = 5 * time.Second
+	return &FileKeySet{s}
+}
+
+// RemoteKeySet 从 JWKS URL 加载的密钥
+type RemoteKeySet struct {
+	*cachedKeySet
+}
+
+// NewRemoteKeySet 新建从 JWKS URL 加载的密钥集合，client 为空时使用 5 秒超时的 http.Client
+func NewRemoteKeySet(url string, client *http.Client) *RemoteKeySet {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &RemoteKeySet{newCachedKeySet(func() ([]byte, error) {
+		res, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", res.Status)
+		}
+		return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	})}
+}
@@ -0,0 +1,183 @@
+package jwt_auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("jwt_auth: malformed token")
+	ErrUnsupportedAlg   = errors.New("jwt_auth: unsupported signing algorithm")
+	ErrInvalidSignature = errors.New("jwt_auth: invalid signature")
+	ErrKeyNotFound      = errors.New("jwt_auth: signing key not found")
+	ErrExpired          = errors.New("jwt_auth: token is expired")
+	ErrNotYetValid      = errors.New("jwt_auth: token is not valid yet")
+	ErrInvalidIssuer    = errors.New("jwt_auth: invalid issuer")
+	ErrInvalidAudience  = errors.New("jwt_auth: invalid audience")
+)
+
+// 支持的签名算法
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Header JWT 头部
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Claims JWT 载荷，保留原始的所有声明
+type Claims map[string]any
+
+// String 返回字符串类型的声明，不存在或类型不符时返回空字符串
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Time 返回数值类型的时间声明（exp、nbf、iat）
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+// Audience 返回 aud 声明，aud 可以是字符串或字符串数组
+func (c Claims) Audience() []string {
+	return stringList(c["aud"], false)
+}
+
+// Scopes 返回授权范围：scope 为空格分隔的字符串，scp 为字符串数组
+func (c Claims) Scopes() []string {
+	if scopes := stringList(c["scope"], true); len(scopes) > 0 {
+		return scopes
+	}
+	return stringList(c["scp"], true)
+}
+
+func stringList(v any, splitSpace bool) []string {
+	switch v := v.(type) {
+	case string:
+		if splitSpace {
+			return strings.Fields(v)
+		}
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Token 解析后的 JWT
+type Token struct {
+	Header Header
+	Claims Claims
+	Raw    string
+}
+
+// Parse 解析 JWT 并用 keyFunc 返回的密钥校验签名，不校验 exp 等声明
+//
+// keyFunc 根据头部的 alg 和 kid 返回密钥：HS256 为 []byte，RS256 为 *rsa.PublicKey，ES256 为 *ecdsa.PublicKey
+func Parse(raw string, keyFunc func(Header) (crypto.PublicKey, error)) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	token := &Token{Raw: raw}
+	if err := decodeSegment(parts[0], &token.Header); err != nil {
+		return nil, err
+	}
+	if err := decodeSegment(parts[1], &token.Claims); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	key, err := keyFunc(token.Header)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(token.Header.Alg, parts[0]+"."+parts[1], signature, key); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+// verify 校验签名，密钥类型必须与算法匹配，防止用公钥当作 HMAC 密钥的算法混淆攻击
+func verify(alg, signingInput string, signature []byte, key crypto.PublicKey) error {
+	digest := sha256.Sum256([]byte(signingInput))
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrKeyNotFound
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrKeyNotFound
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidSignature
+		}
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrKeyNotFound
+		}
+		// JWS 中 ES256 签名为定长的 r||s，各 32 字节
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"sen-golang-study/go-gateway/admin"
+	"sen-golang-study/go-gateway/load_balance"
+	"sen-golang-study/go-gateway/metrics"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/middleware/access_control"
+	"sen-golang-study/go-gateway/middleware/access_log"
+	"sen-golang-study/go-gateway/middleware/concurrency_limit"
+	"sen-golang-study/go-gateway/middleware/cors"
+	"sen-golang-study/go-gateway/middleware/jwt_auth"
+	"sen-golang-study/go-gateway/middleware/rate_limit"
+	"sen-golang-study/go-gateway/middleware/request_id"
+	"sen-golang-study/go-gateway/middleware/tenant_auth"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"sen-golang-study/go-gateway/tracing"
+	"syscall"
+	"time"
+)
+
+// 中间件路由器示例
+//
+// HTTP: 客户端 -> 代理服务器(:2002) -> 中间件链 -> 反向代理 -> 下游真实服务器(:8001、:8002)
+// TCP:  客户端 -> 代理服务器(:7002) -> 中间件链 -> TCP反向代理 -> 下游TCP服务器(:8000)
+// 管理: 管理端口(:9090) 提供管理接口和 /metrics，需要请求头 Authorization: Bearer $GATEWAY_ADMIN_TOKEN
+//
+//	curl -H "Authorization: Bearer $GATEWAY_ADMIN_TOKEN" 127.0.0.1:9090/routes
+//	curl -X POST -H "Authorization: Bearer $GATEWAY_ADMIN_TOKEN" 127.0.0.1:9090/upstreams/127.0.0.1:8002/drain
+func main() {
+	// 日志级别可以通过管理接口调整，log 包的输出也按 INFO 级别经过 slog
+	logLevel := new(slog.LevelVar)
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+
+	// 访问日志异步写入 logs/access.log，单个文件 100MB 或每天切割一次，保留 7 个历史文件
+	accessWriter := access_log.NewAsyncWriter(access_log.NewRotatingFile("logs/access.log", 100<<20, 24*time.Hour, 7), 10000, time.Second)
+	defer accessWriter.Close()
+	accessLog := access_log.New(accessWriter, access_log.JSONFormat{})
+
+	// 网关内置指标，另外注册访问日志因队列满丢弃的条数
+	gatewayMetrics := metrics.NewGateway(metrics.DefaultRegistry)
+	metrics.DefaultRegistry.MustRegister(metrics.NewGaugeFunc("gateway_access_log_dropped",
+		"Access log lines dropped because the write queue was full.", func() float64 { return float64(accessWriter.Dropped()) }))
+
+	// 下游轮询负载均衡，每 5 秒探测一次，不健康或被管理接口摘除的下游不再分配请求
+	httpUpstreams := load_balance.NewRoundRobinBalance("127.0.0.1:8001", "127.0.0.1:8002")
+	tcpUpstreams := load_balance.NewRoundRobinBalance("127.0.0.1:8000")
+	for _, upstreams := range []load_balance.Manager{httpUpstreams, tcpUpstreams} {
+		checker := load_balance.NewHealthChecker(upstreams, 5*time.Second)
+		checker.Start()
+		defer checker.Stop()
+	}
+	tcpServer := &tcp_proxy.TCPServer{Addr: "127.0.0.1:7002"}
+
+	adminServer := admin.NewServer(os.Getenv("GATEWAY_ADMIN_TOKEN"), logLevel)
+	adminServer.Handle("GET /metrics", metrics.DefaultRegistry.Handler())
+	adminServer.AddRoute(
+		admin.Route{Name: "default", Protocol: "http", Match: "/", Upstreams: httpUpstreams},
+		admin.Route{Name: "internal", Protocol: "http", Match: "/internal", Upstreams: httpUpstreams},
+		admin.Route{Name: "realserver", Protocol: "http", Match: "/realserver", Upstreams: httpUpstreams},
+		admin.Route{Name: "partner", Protocol: "http", Match: "/partner", Upstreams: httpUpstreams},
+		admin.Route{Name: "tcp", Protocol: "tcp", Match: tcpServer.Addr, Upstreams: tcpUpstreams},
+	)
+	adminServer.AddTCPServer("tcp", tcpServer)
+	adminServer.SetConfig(func() any {
+		return map[string]any{
+			"http_addr":  "127.0.0.1:2002",
+			"tcp_addr":   tcpServer.Addr,
+			"admin_addr": "127.0.0.1:9090",
+			"access_log": "logs/access.log",
+			"log_level":  logLevel.Level().String(),
+		}
+	})
+	go func() {
+		var addr = "127.0.0.1:9090"
+		log.Println("Starting admin server at " + addr)
+		log.Fatal(http.ListenAndServe(addr, adminServer))
+	}()
+
+	go func() {
+		var addr = "127.0.0.1:2002"
+		// 记录下游地址和拨号、首字节耗时，统计下游错误
+		transport := gatewayMetrics.NewTransport(access_log.NewTransport(http.DefaultTransport))
+
+		router := middleware.NewSliceRouter()
+		// 每个客户端IP每秒 10 个请求，允许突发 20 个
+		router.Group("/").Use(costMiddleware, gatewayMetrics.HTTPMiddleware(), rate_limit.HTTPMiddleware(rate_limit.NewTokenBucket(10, 20), rate_limit.ByClientIP()))
+		// /internal 路由组只允许内网访问，前置 LB(10.0.0.0/8) 追加的 X-Forwarded-For 可信
+		resolver, _ := access_control.NewResolver("10.0.0.0/8")
+		internalACL, _ := access_control.NewACL([]string{"127.0.0.0/8", "10.0.0.0/8", "192.168.0.0/16"}, nil)
+		router.Group("/internal").Use(costMiddleware, gatewayMetrics.HTTPMiddleware(), access_control.HTTPMiddleware(internalACL, resolver))
+		// /realserver 路由组在通用中间件之外，额外校验 JWT 并要求 realserver:read 授权范围，
+		// 并按下游延迟自适应限制并发：10~200 个请求同时执行，最多排队 100 个，排队超过 1 秒返回 503
+		validator := jwt_auth.NewValidator(jwt_auth.NewFileKeySet("jwks.json"))
+		validator.ClaimHeaders = map[string]string{"sub": "X-User-Id"}
+		// 浏览器跨域访问：预检请求在网关应答，不带凭证，因此放在 JWT 认证之前
+		realserverCORS, _ := cors.New(cors.Config{
+			AllowedOrigins:   []string{"https://*.example.com"},
+			AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		})
+		router.Group("/realserver").Use(costMiddleware, gatewayMetrics.HTTPMiddleware(), cors.HTTPMiddleware(realserverCORS),
+			jwt_auth.HTTPMiddleware(validator), jwt_auth.RequireScopes("realserver:read"),
+			concurrency_limit.HTTPMiddleware(
+				concurrency_limit.NewLimiter(concurrency_limit.NewAIMDLimit(50, 10, 200), 100, time.Second),
+			))
+		// /partner 路由组给合作方使用，按 API Key 或 HMAC 签名认证租户，并按租户配额限流
+		tenants := tenant_auth.NewRegistry(&tenant_auth.Tenant{
+			ID: "demo-partner", APIKey: "demo-key", Secret: "demo-secret", AllowedRoutes: []string{"/partner"}, Quota: 600,
+		})
+		router.Group("/partner").Use(costMiddleware, gatewayMetrics.HTTPMiddleware(), tenant_auth.HTTPMiddleware(tenant_auth.NewVerifier(tenants)),
+			rate_limit.HTTPMiddleware(tenant_auth.NewQuotaLimiter(tenants), tenant_auth.ByTenant()))
+		handler := middleware.NewSliceRouterHandler(func(c *middleware.SliceRouterContext) http.Handler {
+			upstream, err := httpUpstreams.Get(c.Req.RemoteAddr)
+			if err != nil {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				})
+			}
+			proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: upstream})
+			proxy.Transport = transport
+			return proxy
+		}, router)
+
+		log.Println("Starting HTTP middleware proxy at " + addr)
+		// 访问日志包在路由器外层，被中间件拒绝的请求也会记录；请求ID在最外层，访问日志才能读到
+		log.Fatal(http.ListenAndServe(addr, request_id.NewAssigner(resolver).Handler(accessLog.Handler(handler))))
+	}()
+
+	go func() {
+		// 每个 TCP 会话一条链路，包含会话和拨号下游两个 span
+		tracer := tracing.NewTracer("go-gateway-tcp", tracing.NewWriterExporter(os.Stdout))
+		router := middleware.NewTCPSliceRouter()
+		router.Group("").Use(request_id.TCPMiddleware(), access_log.TCPMiddleware(accessLog), gatewayMetrics.TCPMiddleware(), tracer.TCPMiddleware(),
+			rate_limit.TCPMiddleware(rate_limit.NewSlidingWindow(5, time.Second)),
+			// 最多 1000 个并发连接，超出的连接最多等待 5 秒
+			concurrency_limit.TCPMiddleware(concurrency_limit.NewLimiter(concurrency_limit.FixedLimit(1000), 100, 5*time.Second)))
+		handler := middleware.NewTCPSliceRouterHandler(func(c *middleware.TCPSliceRouterContext) tcp_proxy.TCPHandler {
+			upstream, err := tcpUpstreams.Get(c.Conn.RemoteAddr().String())
+			proxy := tcp_proxy.NewSingleHostReverseProxy(upstream)
+			dial := (&net.Dialer{KeepAlive: proxy.KeepAlivePeriod}).DialContext
+			if err != nil {
+				// 没有可用下游，按拨号失败处理
+				dial = func(context.Context, string, string) (net.Conn, error) { return nil, err }
+			}
+			proxy.DialContext = access_log.DialContext(tracer.DialContext(dial))
+			return proxy
+		}, router)
+		tcpServer.Handler = handler
+
+		// 监听端口级别的黑白名单：拒绝的连接在 Accept 阶段就被关闭，不会进入中间件链
+		acl, err := access_control.NewACL([]string{"127.0.0.0/8", "10.0.0.0/8"}, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		listener, err := net.Listen("tcp", tcpServer.Addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Starting TCP middleware proxy at " + tcpServer.Addr)
+		log.Fatal(tcpServer.Serve(access_control.NewListener(listener, acl)))
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+}
+
+// costMiddleware 统计请求耗时
+func costMiddleware(c *middleware.SliceRouterContext) {
+	start := time.Now()
+	c.Next()
+	fmt.Printf("%s %s cost %v\n", c.Req.Method, c.Req.URL.Path, time.Since(start))
+}
@@ -0,0 +1,189 @@
+package rate_limit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CounterServer 限流计数服务，实现 tcp_proxy.TCPHandler，挂在网关自己的 TCPServer 上即可对外提供计数
+//
+// 文本行协议，每行一个命令：
+//
+//	ADD <key> <delta> <ttl毫秒>  ->  OK <count>
+//	GET <key>                    ->  OK <count>
+//	出错时返回                    ->  ERR <message>
+//
+// 每行最长 4KB，超出时返回 ERR 并断开连接
+type CounterServer struct {
+	Store Store
+}
+
+// maxLineSize 一条命令的最大字节数，客户端发送前检查，服务端超出时断开连接
+const maxLineSize = 4 << 10
+
+// NewCounterServer 新建限流计数服务，计数保存在进程内存中
+func NewCounterServer() *CounterServer {
+	return &CounterServer{Store: NewMemoryStore()}
+}
+
+func (s *CounterServer) Serve(ctx context.Context, conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, maxLineSize)
+	writer := bufio.NewWriter(conn)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// 超长的行无法再对齐到下一条命令，返回错误后断开连接
+			fmt.Fprintf(writer, "ERR line too long\n")
+			writer.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		count, err := s.execute(strings.Fields(string(line)))
+		if err != nil {
+			fmt.Fprintf(writer, "ERR %s\n", err)
+		} else {
+			fmt.Fprintf(writer, "OK %d\n", count)
+		}
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *CounterServer) execute(fields []string) (int64, error) {
+	switch {
+	case len(fields) == 4 && fields[0] == "ADD":
+		delta, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return 0, errors.New("invalid delta")
+		}
+		ttl, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil || ttl <= 0 {
+			return 0, errors.New("invalid ttl")
+		}
+		return s.Store.Add(fields[1], delta, time.Duration(ttl)*time.Millisecond)
+	case len(fields) == 2 && fields[0] == "GET":
+		return s.Store.Get(fields[1])
+	}
+	return 0, errors.New("unknown command")
+}
+
+// ServerError 计数服务对单个命令返回的 ERR，连接本身是正常的
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "rate_limit: counter server error: " + e.Message
+}
+
+// RemoteStore 访问 CounterServer 的计数存储客户端，多个网关实例指向同一个计数服务即可共享限流额度
+type RemoteStore struct {
+	Addr    string
+	Timeout time.Duration // 拨号及每次命令的超时时间
+
+	conns chan *remoteConn // 空闲连接池
+}
+
+type remoteConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewRemoteStore 新建计数存储客户端，最多保持 poolSize 个空闲连接
+func NewRemoteStore(addr string, poolSize int) *RemoteStore {
+	return &RemoteStore{Addr: addr, Timeout: 200 * time.Millisecond, conns: make(chan *remoteConn, poolSize)}
+}
+
+func (s *RemoteStore) Add(key string, delta int64, ttl time.Duration) (int64, error) {
+	return s.call(fmt.Sprintf("ADD %s %d %d\n", escapeKey(key), delta, max(ttl.Milliseconds(), 1)))
+}
+
+func (s *RemoteStore) Get(key string) (int64, error) {
+	return s.call(fmt.Sprintf("GET %s\n", escapeKey(key)))
+}
+
+// Close 关闭所有空闲连接
+func (s *RemoteStore) Close() {
+	for {
+		select {
+		case conn := <-s.conns:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (s *RemoteStore) call(command string) (int64, error) {
+	// 过长的 key 只影响这一个请求，不能当作存储不可用
+	if len(command) > maxLineSize {
+		return 0, &ServerError{Message: "command too long"}
+	}
+	conn, err := s.get()
+	if err != nil {
+		return 0, err
+	}
+	conn.SetDeadline(time.Now().Add(s.Timeout))
+	if _, err := conn.Write([]byte(command)); err != nil {
+		conn.Close()
+		return 0, err
+	}
+	line, err := conn.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+	s.put(conn)
+
+	status, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if status != "OK" {
+		return 0, &ServerError{Message: value}
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (s *RemoteStore) get() (*remoteConn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	default:
+	}
+	conn, err := net.DialTimeout("tcp", s.Addr, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (s *RemoteStore) put(conn *remoteConn) {
+	select {
+	case s.conns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// escapeKey 服务端用 strings.Fields 拆分命令，key 中的空白字符会破坏行协议；
+// 逐字节转义为 %XX：ASCII 空白和控制字符、% 本身以及所有非 ASCII 字节（避免 U+0085、U+00A0 等 Unicode 空白），
+// 按字节处理不会把不同的非法 UTF-8 序列都变成 U+FFFD，保证不同的 key 转义后仍不相同
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c <= ' ' || c == '%' || c >= 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package rate_limit
+
+import (
+	"net"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware"
+)
+
+// KeyFunc 从请求中提取限流key，返回空字符串表示不限流
+type KeyFunc func(c *middleware.SliceRouterContext) string
+
+// ByClientIP 按客户端IP限流
+func ByClientIP() KeyFunc {
+	return func(c *middleware.SliceRouterContext) string {
+		return "ip:" + ClientIP(c.Req)
+	}
+}
+
+// ByHeader 按请求头限流，如 API Key 头 X-Api-Key，没有该请求头时不限流
+func ByHeader(name string) KeyFunc {
+	return func(c *middleware.SliceRouterContext) string {
+		if v := c.Req.Header.Get(name); v != "" {
+			return "header:" + name + ":" + v
+		}
+		return ""
+	}
+}
+
+// ByRoute 按路由组限流，同一路由组的所有请求共享额度
+func ByRoute() KeyFunc {
+	return func(c *middleware.SliceRouterContext) string {
+		return "route:" + c.Path()
+	}
+}
+
+// ByUpstream 按下游限流，所有经过该中间件的请求共享下游的额度
+func ByUpstream(upstream string) KeyFunc {
+	return func(*middleware.SliceRouterContext) string {
+		return "upstream:" + upstream
+	}
+}
+
+// ClientIP 返回客户端IP
+//
+// 只使用连接的对端地址，不信任客户端可以任意伪造的 X-Forwarded-For
+func ClientIP(req *http.Request) string {
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return ip
+	}
+	return req.RemoteAddr
+}
@@ -0,0 +1,171 @@
+package rate_limit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Result 限流判断结果，用于填充 429 响应和 X-RateLimit-* 响应头
+type Result struct {
+	Allowed    bool
+	Limit      int           // 窗口内（或桶容量）允许的请求数
+	Remaining  int           // 剩余可用请求数
+	RetryAfter time.Duration // 被拒绝时，多久之后可以重试
+	Reset      time.Duration // 多久之后额度完全恢复
+}
+
+// Limiter 限流器，按key（客户端IP、API Key、路由等）独立计数
+type Limiter interface {
+	Allow(key string) Result
+}
+
+// sweepEvery 每处理多少次请求清理一次空闲key，避免key无限增长
+const sweepEvery = 4096
+
+// TokenBucket 令牌桶限流：以固定速率往桶里放令牌，请求消耗令牌，桶容量即突发请求数
+type TokenBucket struct {
+	mu      sync.Mutex
+	rate    float64 // 每秒放入的令牌数
+	burst   int     // 桶容量
+	buckets map[string]*bucket
+	ops     int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket 新建令牌桶限流器
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: burst, buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Update 运行时修改速率和桶容量
+func (tb *TokenBucket) Update(rate float64, burst int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.rate, tb.burst = rate, burst
+}
+
+func (tb *TokenBucket) Allow(key string) Result {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	now := tb.now()
+	tb.sweep(now)
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(tb.burst), last: now}
+		tb.buckets[key] = b
+	}
+	// 按距离上次请求的时间补充令牌
+	b.tokens = math.Min(float64(tb.burst), b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+	b.last = now
+
+	result := Result{Limit: tb.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else if tb.rate > 0 {
+		result.RetryAfter = seconds((1 - b.tokens) / tb.rate)
+	} else {
+		result.RetryAfter = time.Hour
+	}
+	result.Remaining = int(b.tokens)
+	if tb.rate > 0 {
+		result.Reset = seconds((float64(tb.burst) - b.tokens) / tb.rate)
+	}
+	return result
+}
+
+// sweep 清理令牌已经补满的桶，它们与新建的桶没有区别
+func (tb *TokenBucket) sweep(now time.Time) {
+	if tb.ops++; tb.ops < sweepEvery {
+		return
+	}
+	tb.ops = 0
+	for key, b := range tb.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*tb.rate >= float64(tb.burst) {
+			delete(tb.buckets, key)
+		}
+	}
+}
+
+// SlidingWindow 滑动窗口日志限流：记录窗口内每次请求的时间，窗口内请求数达到上限后拒绝
+type SlidingWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	logs   map[string][]time.Time
+	ops    int
+	now    func() time.Time
+}
+
+// NewSlidingWindow 新建滑动窗口限流器，limit <= 0 时拒绝所有请求
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{limit: limit, window: window, logs: make(map[string][]time.Time), now: time.Now}
+}
+
+// Update 运行时修改窗口大小和请求上限
+func (sw *SlidingWindow) Update(limit int, window time.Duration) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.limit, sw.window = limit, window
+}
+
+func (sw *SlidingWindow) Allow(key string) Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := sw.now()
+	sw.sweep(now)
+
+	result := Result{Limit: sw.limit}
+	if sw.limit <= 0 {
+		result.RetryAfter = sw.window
+		return result
+	}
+	log := evict(sw.logs[key], now.Add(-sw.window))
+	if len(log) < sw.limit {
+		log = append(log, now)
+		result.Allowed = true
+	} else {
+		// 最早的一条记录滑出窗口后才有额度
+		result.RetryAfter = log[0].Add(sw.window).Sub(now)
+	}
+	sw.logs[key] = log
+	result.Remaining = sw.limit - len(log)
+	if len(log) > 0 {
+		result.Reset = log[len(log)-1].Add(sw.window).Sub(now)
+	}
+	return result
+}
+
+func (sw *SlidingWindow) sweep(now time.Time) {
+	if sw.ops++; sw.ops < sweepEvery {
+		return
+	}
+	sw.ops = 0
+	for key, log := range sw.logs {
+		if log = evict(log, now.Add(-sw.window)); len(log) == 0 {
+			delete(sw.logs, key)
+		} else {
+			sw.logs[key] = log
+		}
+	}
+}
+
+// evict 移除早于 start 的记录
+func evict(log []time.Time, start time.Time) []time.Time {
+	i := 0
+	for i < len(log) && !log[i].After(start) {
+		i++
+	}
+	return log[i:]
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,89 @@
+package rate_limit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sen-golang-study/go-gateway/middleware"
+	"testing"
+	"time"
+)
+
+// TestTokenBucket 测试令牌桶的突发容量与按速率补充令牌
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := NewTokenBucket(2, 3)
+	tb.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !tb.Allow("a").Allowed {
+			t.Fatalf("request %d should be allowed by burst", i)
+		}
+	}
+	result := tb.Allow("a")
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("want rejected with 500ms retry, got %+v", result)
+	}
+	if !tb.Allow("b").Allowed {
+		t.Errorf("keys should be limited independently")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !tb.Allow("a").Allowed {
+		t.Errorf("token should be refilled after 500ms")
+	}
+
+	tb.Update(100, 3)
+	now = now.Add(10 * time.Millisecond)
+	if !tb.Allow("a").Allowed {
+		t.Errorf("updated rate should take effect")
+	}
+}
+
+// TestSlidingWindow 测试滑动窗口内的请求上限
+func TestSlidingWindow(t *testing.T) {
+	now := time.Now()
+	sw := NewSlidingWindow(2, time.Second)
+	sw.now = func() time.Time { return now }
+
+	sw.Allow("a")
+	now = now.Add(400 * time.Millisecond)
+	sw.Allow("a")
+	result := sw.Allow("a")
+	if result.Allowed || result.RetryAfter != 600*time.Millisecond {
+		t.Fatalf("want rejected with 600ms retry, got %+v", result)
+	}
+	now = now.Add(600 * time.Millisecond)
+	if result := sw.Allow("a"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("first request should slide out of window, got %+v", result)
+	}
+
+	// 上限为 0 时拒绝所有请求
+	sw.Update(0, time.Second)
+	if result := sw.Allow("b"); result.Allowed || result.RetryAfter != time.Second {
+		t.Errorf("want rejected with zero limit, got %+v", result)
+	}
+}
+
+// TestHTTPMiddleware 测试超出限制时返回 429 以及限流响应头
+func TestHTTPMiddleware(t *testing.T) {
+	router := middleware.NewSliceRouter()
+	router.Group("/").Use(HTTPMiddleware(NewSlidingWindow(1, time.Minute), ByHeader("X-Api-Key")))
+	handler := middleware.NewSliceRouterHandler(func(c *middleware.SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	}, router)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Api-Key", "k1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := send(); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("first request got %d, remaining %s", rec.Code, rec.Header().Get("X-RateLimit-Remaining"))
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("second request got %d, retry after %s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,93 @@
+package rate_limit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware"
+	"strconv"
+	"time"
+)
+
+// HTTPMiddleware HTTP限流中间件
+//
+// 所有响应都带上 X-RateLimit-Limit/Remaining/Reset 头，
+// 超出限制时返回 429 和 Retry-After 头，并终止中间件链
+func HTTPMiddleware(limiter Limiter, keyFunc KeyFunc) middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		result := limiter.Allow(key)
+		header := c.Rw.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(max(result.Remaining, 0)))
+		header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			http.Error(c.Rw, fmt.Sprintf("rate limit exceeded, retry after %v", result.RetryAfter.Round(time.Millisecond)),
+				http.StatusTooManyRequests)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// TCPMiddleware TCP连接限流中间件，按客户端IP限制新建连接的速率，超出时直接关闭连接
+func TCPMiddleware(limiter Limiter) middleware.TCPHandlerFunc {
+	return func(c *middleware.TCPSliceRouterContext) {
+		key := "ip:" + hostOf(c.Conn.RemoteAddr())
+		if result := limiter.Allow(key); !result.Allowed {
+			c.Conn.Close()
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Listener 在 Accept 阶段按客户端IP限制连接速率，可直接传给 TCPServer.Serve
+type Listener struct {
+	net.Listener
+	limiter Limiter
+}
+
+// NewListener 包装监听器，超出速率的连接在交给 TCPServer 处理前就被关闭
+func NewListener(l net.Listener, limiter Limiter) *Listener {
+	return &Listener{Listener: l, limiter: limiter}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if result := l.limiter.Allow("ip:" + hostOf(conn.RemoteAddr())); !result.Allowed {
+			log.Printf("rate_limit: reject tcp connection from %v", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,69 @@
+package rate_limit
+
+import (
+	"sync"
+	"time"
+)
+
+// Store 限流计数存储，多个网关实例共享同一个存储即可共享限流额度
+type Store interface {
+	// Add 给 key 的计数加 delta 并返回加后的计数，key 不存在时从 0 开始，ttl 后过期
+	Add(key string, delta int64, ttl time.Duration) (int64, error)
+	// Get 返回 key 的计数，key 不存在或已过期时返回 0
+	Get(key string) (int64, error)
+}
+
+// MemoryStore 进程内的计数存储
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	ops      int
+	now      func() time.Time
+}
+
+type counter struct {
+	value    int64
+	expireAt time.Time
+}
+
+// NewMemoryStore 新建进程内计数存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]*counter), now: time.Now}
+}
+
+func (s *MemoryStore) Add(key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expireAt) {
+		c = &counter{expireAt: now.Add(ttl)}
+		s.counters[key] = c
+	}
+	c.value += delta
+	return c.value, nil
+}
+
+func (s *MemoryStore) Get(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	if !ok || !s.now().Before(c.expireAt) {
+		return 0, nil
+	}
+	return c.value, nil
+}
+
+// sweep 定期清理过期的计数
+func (s *MemoryStore) sweep(now time.Time) {
+	if s.ops++; s.ops < sweepEvery {
+		return
+	}
+	s.ops = 0
+	for key, c := range s.counters {
+		if !now.Before(c.expireAt) {
+			delete(s.counters, key)
+		}
+	}
+}
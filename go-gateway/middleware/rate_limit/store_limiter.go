@@ -0,0 +1,213 @@
+package rate_limit
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// storeRetryInterval 存储访问失败后，在该时间内直接降级，不再访问存储
+const storeRetryInterval = time.Second
+
+// StoreLimiter 基于共享存储的滑动窗口计数限流，每个请求都访问一次存储
+//
+// 用当前窗口计数加上一个窗口按重叠比例折算的计数估算滑动窗口内的请求数，
+// 存储不可用时交给 Fallback 限流器处理，Fallback 为空时放行
+type StoreLimiter struct {
+	Fallback Limiter
+
+	store     Store
+	limit     int
+	window    time.Duration
+	downUntil atomic.Int64 // 存储恢复访问的时间（UnixNano）
+	now       func() time.Time
+}
+
+// NewStoreLimiter 新建基于共享存储的限流器
+func NewStoreLimiter(store Store, limit int, window time.Duration) *StoreLimiter {
+	return &StoreLimiter{store: store, limit: limit, window: window, now: time.Now}
+}
+
+func (l *StoreLimiter) Allow(key string) Result {
+	now := l.now()
+	if now.UnixNano() < l.downUntil.Load() {
+		return l.fallback(key, nil)
+	}
+	index := now.UnixNano() / int64(l.window)
+	elapsed := time.Duration(now.UnixNano() - index*int64(l.window))
+
+	current, err := l.store.Add(windowKey(key, index), 1, 2*l.window)
+	if err != nil {
+		return l.storeFailed(key, now, err)
+	}
+	previous, err := l.store.Get(windowKey(key, index-1))
+	if err != nil {
+		return l.storeFailed(key, now, err)
+	}
+	weight := 1 - float64(elapsed)/float64(l.window)
+	estimated := int(float64(previous)*weight) + int(current)
+
+	result := Result{Limit: l.limit, Remaining: l.limit - estimated, Reset: l.window - elapsed}
+	if estimated <= l.limit {
+		result.Allowed = true
+	} else {
+		// 被拒绝的请求不占用额度，否则持续重试的客户端会一直被限流
+		l.store.Add(windowKey(key, index), -1, 2*l.window)
+		result.Remaining = 0
+		result.RetryAfter = l.window - elapsed
+	}
+	return result
+}
+
+// storeFailed 存储不可用时在 storeRetryInterval 内所有 key 都直接降级；
+// 计数服务只是拒绝了这个 key 的命令时，只降级当前请求
+func (l *StoreLimiter) storeFailed(key string, now time.Time, err error) Result {
+	if storeUnavailable(err) {
+		l.downUntil.Store(now.Add(storeRetryInterval).UnixNano())
+	}
+	return l.fallback(key, err)
+}
+
+func (l *StoreLimiter) fallback(key string, err error) Result {
+	if err != nil {
+		log.Printf("rate_limit: store unavailable, fallback to local limiter: %v", err)
+	}
+	if l.Fallback != nil {
+		return l.Fallback.Allow(key)
+	}
+	return Result{Allowed: true, Limit: l.limit, Remaining: l.limit}
+}
+
+// LeaseLimiter 本地令牌租约限流：每次从共享存储批量申请一批额度在本地消耗，
+// 减少访问存储的次数；存储不可用时按 Fallback（通常是 limit / 实例数 的本地限流）降级
+type LeaseLimiter struct {
+	Fallback Limiter
+
+	store     Store
+	limit     int
+	window    time.Duration
+	leaseSize int
+
+	mu        sync.Mutex
+	leases    map[string]*lease
+	downUntil time.Time // 存储恢复访问的时间
+	now       func() time.Time
+}
+
+type lease struct {
+	index     int64 // 租约所属的固定窗口
+	remaining int   // 本地剩余额度
+	exhausted bool  // 本窗口的全局额度已经用完
+
+	acquiring chan struct{} // 正在向存储申请额度，申请完成时关闭
+}
+
+// NewLeaseLimiter 新建租约限流器，leaseSize 为每次申请的额度
+func NewLeaseLimiter(store Store, limit int, window time.Duration, leaseSize int) *LeaseLimiter {
+	return &LeaseLimiter{
+		store:     store,
+		limit:     limit,
+		window:    window,
+		leaseSize: leaseSize,
+		leases:    make(map[string]*lease),
+		now:       time.Now,
+	}
+}
+
+func (l *LeaseLimiter) Allow(key string) Result {
+	l.mu.Lock()
+	for {
+		now := l.now()
+		index := now.UnixNano() / int64(l.window)
+		reset := time.Duration((index+1)*int64(l.window) - now.UnixNano())
+
+		ls, ok := l.leases[key]
+		if !ok || ls.index != index {
+			// 进入新窗口，丢弃上个窗口的租约
+			for k, old := range l.leases {
+				if old.index < index {
+					delete(l.leases, k)
+				}
+			}
+			ls = &lease{index: index}
+			l.leases[key] = ls
+		}
+		if ls.remaining > 0 || ls.exhausted {
+			result := Result{Limit: l.limit, Reset: reset}
+			if ls.remaining > 0 {
+				ls.remaining--
+				result.Allowed = true
+				result.Remaining = ls.remaining
+			} else {
+				result.RetryAfter = reset
+			}
+			l.mu.Unlock()
+			return result
+		}
+		// 同一个 key 同时只有一个请求去存储申请额度，其余请求等它申请完再重新判断
+		if ls.acquiring != nil {
+			acquiring := ls.acquiring
+			l.mu.Unlock()
+			<-acquiring
+			l.mu.Lock()
+			continue
+		}
+		if now.Before(l.downUntil) {
+			l.mu.Unlock()
+			return l.fallback(key)
+		}
+
+		// 访问存储时不持有锁，存储变慢不会阻塞其他 key 的限流判断
+		acquiring := make(chan struct{})
+		ls.acquiring = acquiring
+		l.mu.Unlock()
+		granted, err := l.acquire(key, index)
+		l.mu.Lock()
+		ls.acquiring = nil
+		close(acquiring)
+		if err != nil {
+			log.Printf("rate_limit: lease from store failed, fallback to local limiter: %v", err)
+			if storeUnavailable(err) {
+				l.downUntil = now.Add(storeRetryInterval)
+			}
+			l.mu.Unlock()
+			return l.fallback(key)
+		}
+		ls.remaining = granted
+		ls.exhausted = granted < l.leaseSize
+	}
+}
+
+func (l *LeaseLimiter) fallback(key string) Result {
+	if l.Fallback != nil {
+		return l.Fallback.Allow(key)
+	}
+	return Result{Allowed: true, Limit: l.limit, Remaining: l.limit}
+}
+
+// acquire 从存储申请一批额度，返回实际获得的额度
+func (l *LeaseLimiter) acquire(key string, index int64) (int, error) {
+	count, err := l.store.Add(windowKey(key, index), int64(l.leaseSize), 2*l.window)
+	if err != nil {
+		return 0, err
+	}
+	over := int(count) - l.limit
+	granted := l.leaseSize
+	if over > 0 {
+		granted -= over
+	}
+	return max(granted, 0), nil
+}
+
+// storeUnavailable 连接失败、超时等说明存储不可用，计数服务返回的 ERR 只与当前命令有关
+func storeUnavailable(err error) bool {
+	var serverErr *ServerError
+	return !errors.As(err, &serverErr)
+}
+
+func windowKey(key string, index int64) string {
+	return key + "@" + strconv.FormatInt(index, 10)
+}
@@ -0,0 +1,214 @@
+package rate_limit
+
+import (
+	"io"
+	"net"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode"
+)
+
+// startCounterServer 在网关自己的 TCPServer 上启动限流计数服务
+func startCounterServer(t *testing.T) (*tcp_proxy.TCPServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &tcp_proxy.TCPServer{Handler: NewCounterServer()}
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+// TestStoreLimiter_MultiInstance 测试两个网关实例通过计数服务共享限流额度
+func TestStoreLimiter_MultiInstance(t *testing.T) {
+	server, addr := startCounterServer(t)
+	defer server.Close()
+
+	now := time.Unix(1000, 0)
+	instances := make([]*StoreLimiter, 2)
+	for i := range instances {
+		store := NewRemoteStore(addr, 2)
+		defer store.Close()
+		instances[i] = NewStoreLimiter(store, 10, time.Minute)
+		instances[i].now = func() time.Time { return now }
+	}
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if instances[i%2].Allow("ip:1.1.1.1").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("want 10 requests allowed across instances, got %d", allowed)
+	}
+}
+
+// TestLeaseLimiter 测试租约模式按批申请额度，以及计数服务不可用时降级为本地限流
+func TestLeaseLimiter(t *testing.T) {
+	server, addr := startCounterServer(t)
+	now := time.Unix(1000, 0)
+
+	newInstance := func() *LeaseLimiter {
+		store := NewRemoteStore(addr, 2)
+		l := NewLeaseLimiter(store, 10, time.Minute, 4)
+		l.Fallback = NewSlidingWindow(2, time.Minute)
+		l.now = func() time.Time { return now }
+		return l
+	}
+	a, b := newInstance(), newInstance()
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		for _, l := range []*LeaseLimiter{a, b} {
+			if l.Allow("route:/api").Allowed {
+				allowed++
+			}
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("want 10 requests allowed across instances, got %d", allowed)
+	}
+
+	// 计数服务宕机，新窗口内降级为每个实例 2 个请求的本地限流
+	server.Close()
+	now = now.Add(time.Minute)
+	c := newInstance()
+	allowed = 0
+	for i := 0; i < 5; i++ {
+		if c.Allow("route:/api").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("want 2 requests allowed by fallback, got %d", allowed)
+	}
+}
+
+// TestStoreLimiter_RejectedNotCounted 测试被拒绝的请求不占用额度，持续重试不会延长限流时间
+func TestStoreLimiter_RejectedNotCounted(t *testing.T) {
+	now := time.Unix(1200, 0) // 窗口起点
+	l := NewStoreLimiter(NewMemoryStore(), 2, time.Minute)
+	l.now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		l.Allow("ip:1.1.1.1")
+	}
+	// 下个窗口过半时，上个窗口只有 2 个被放行的请求，按一半折算后还能放行
+	now = now.Add(90 * time.Second)
+	if !l.Allow("ip:1.1.1.1").Allowed {
+		t.Errorf("want allowed, rejected requests should not use the window")
+	}
+}
+
+// TestStoreLimiter_WhitespaceKey 测试 key 中含 Unicode 空白时计数服务正常处理，不会触发降级
+func TestStoreLimiter_WhitespaceKey(t *testing.T) {
+	server, addr := startCounterServer(t)
+	defer server.Close()
+	store := NewRemoteStore(addr, 2)
+	defer store.Close()
+	l := NewStoreLimiter(store, 1, time.Minute)
+	l.Fallback = NewSlidingWindow(0, time.Minute) // 降级时全部拒绝
+
+	for _, key := range []string{"key:a\u0085b", "key:a\u00a0b", "key:a b", "key:a%20b", "key:a_b"} {
+		if !l.Allow(key).Allowed {
+			t.Errorf("%q: want allowed by store", key)
+		}
+	}
+	if l.downUntil.Load() != 0 {
+		t.Errorf("store should not be marked down")
+	}
+	if _, err := store.Get("a b"); err != nil {
+		t.Errorf("want escaped key accepted, got %v", err)
+	}
+}
+
+// slowStore 对指定 key 的申请阻塞到 release 关闭
+type slowStore struct {
+	*MemoryStore
+	slow    string
+	release chan struct{}
+	adds    atomic.Int32
+}
+
+func (s *slowStore) Add(key string, delta int64, ttl time.Duration) (int64, error) {
+	if strings.HasPrefix(key, s.slow+"@") {
+		s.adds.Add(1)
+		<-s.release
+	}
+	return s.MemoryStore.Add(key, delta, ttl)
+}
+
+// TestLeaseLimiter_SlowStore 测试申请额度时不持有锁，其他 key 不受影响，同一个 key 只申请一次
+func TestLeaseLimiter_SlowStore(t *testing.T) {
+	store := &slowStore{MemoryStore: NewMemoryStore(), slow: "a", release: make(chan struct{})}
+	l := NewLeaseLimiter(store, 10, time.Minute, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Allow("a")
+		}()
+	}
+	for store.adds.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		l.Allow("b")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("key b blocked by slow lease of key a")
+	}
+	close(store.release)
+	wg.Wait()
+	if store.adds.Load() != 1 {
+		t.Errorf("want 1 lease request for key a, got %d", store.adds.Load())
+	}
+}
+
+// TestEscapeKey 测试非法 UTF-8 字节逐字节转义，不同的 key 转义后不相同
+func TestEscapeKey(t *testing.T) {
+	seen := map[string]string{}
+	for _, key := range []string{"a\xffb", "a\xfeb", "a�b", "a b", "a%20b", "a b"} {
+		escaped := escapeKey(key)
+		if strings.ContainsFunc(escaped, unicode.IsSpace) {
+			t.Errorf("%q: escaped key %q contains whitespace", key, escaped)
+		}
+		if other, ok := seen[escaped]; ok {
+			t.Errorf("%q and %q both escape to %q", key, other, escaped)
+		}
+		seen[escaped] = key
+	}
+}
+
+// TestCounterServer_LongLine 测试过长的命令：客户端直接按单个请求的错误处理，服务端返回 ERR 并断开连接
+func TestCounterServer_LongLine(t *testing.T) {
+	server, addr := startCounterServer(t)
+	defer server.Close()
+	store := NewRemoteStore(addr, 2)
+	defer store.Close()
+	if _, err := store.Add(strings.Repeat("k", 8<<10), 1, time.Minute); storeUnavailable(err) {
+		t.Errorf("want per-command error, got %v", err)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go conn.Write([]byte("GET " + strings.Repeat("k", 8<<10) + "\n"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reply, _ := io.ReadAll(conn)
+	if string(reply) != "ERR line too long\n" {
+		t.Errorf("unexpected reply %q", reply)
+	}
+}
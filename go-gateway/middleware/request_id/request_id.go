@@ -0,0 +1,134 @@
+package request_id
+
+import (
+	"context"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/middleware/access_control"
+)
+
+// Header 请求ID的请求头/响应头名称
+const Header = "X-Request-Id"
+
+// maxLength 采信的请求ID最大长度
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext 返回携带请求ID的 context
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext 读取 context 中的请求ID，没有时返回空字符串
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Assigner 为每个请求分配请求ID：放入 context，设置到转发给下游的请求头，并在响应头中返回
+//
+// 只有连接对端是受信任的代理（如前置的 LB）时才采信请求头中的 X-Request-Id，
+// 否则客户端可以伪造请求ID污染日志。采信的请求ID只允许字母、数字和 -_.:/+=，长度不超过 128
+type Assigner struct {
+	resolver *access_control.Resolver
+}
+
+// NewAssigner 新建请求ID分配器，resolver 为空时不采信任何传入的请求ID
+func NewAssigner(resolver *access_control.Resolver) *Assigner {
+	return &Assigner{resolver: resolver}
+}
+
+// Resolve 返回请求的请求ID：采信受信任代理传入的，否则生成新的
+func (a *Assigner) Resolve(req *http.Request) string {
+	if a.resolver != nil && a.resolver.Trusted(access_control.AddrOf(req.RemoteAddr)) {
+		if values := req.Header.Values(Header); len(values) == 1 && valid(values[0]) {
+			return values[0]
+		}
+	}
+	return New()
+}
+
+// Handler 包装 http.Handler，放在访问日志、链路追踪之外，它们才能读到请求ID
+func (a *Assigner) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, req := a.assign(req)
+		next.ServeHTTP(&responseWriter{ResponseWriter: w, id: id}, req)
+	})
+}
+
+// HTTPMiddleware 请求ID中间件，放在中间件链最前面
+func HTTPMiddleware(a *Assigner) middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		id, req := a.assign(c.Req)
+		rw := c.Rw
+		c.Req, c.Ctx, c.Rw = req, req.Context(), &responseWriter{ResponseWriter: rw, id: id}
+		c.Next()
+		c.Rw = rw
+	}
+}
+
+func (a *Assigner) assign(req *http.Request) (string, *http.Request) {
+	id := a.Resolve(req)
+	req = req.WithContext(NewContext(req.Context(), id))
+	req.Header.Set(Header, id)
+	return id, req
+}
+
+// TCPMiddleware TCP会话的请求ID中间件，每个会话生成一个请求ID放入 context，用于日志和链路追踪
+func TCPMiddleware() middleware.TCPHandlerFunc {
+	return func(c *middleware.TCPSliceRouterContext) {
+		c.Ctx = NewContext(c.Ctx, New())
+		c.Next()
+	}
+}
+
+// valid 检查传入的请求ID，防止换行等字符注入日志
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// responseWriter 写响应头时设置请求ID，覆盖下游响应中的同名响应头
+type responseWriter struct {
+	http.ResponseWriter
+	id          string
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.Header().Set(Header, w.id)
+		// 1xx 响应之后还有最终响应
+		w.wroteHeader = code >= http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
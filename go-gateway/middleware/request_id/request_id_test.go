@@ -0,0 +1,125 @@
+package request_id
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/middleware/access_control"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestULID 测试 ULID 的格式，以及同一毫秒内按生成顺序递增
+func TestULID(t *testing.T) {
+	var g ulidGenerator
+	now := time.UnixMilli(1700000000000)
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = g.next(now)
+	}
+	if !sort.StringsAreSorted(ids) || ids[0] == ids[1] {
+		t.Fatalf("want monotonic ids, got %s %s", ids[0], ids[1])
+	}
+	// 时间戳 1700000000000 编码为前 10 个字符
+	if len(ids[0]) != 26 || ids[0][:10] != "01HF7YAT00" {
+		t.Errorf("unexpected ulid %s", ids[0])
+	}
+	// 时钟回拨时不会生成更小的ID
+	if back := g.next(now.Add(-time.Second)); back <= ids[len(ids)-1] {
+		t.Errorf("want %s > %s", back, ids[len(ids)-1])
+	}
+	if later := New(); later <= ids[len(ids)-1] {
+		t.Errorf("want %s > %s", later, ids[len(ids)-1])
+	}
+}
+
+// TestHandler 测试请求ID转发给下游、写入 context、覆盖下游响应头，并只采信受信任代理传入的请求ID
+func TestHandler(t *testing.T) {
+	var upstreamIDs []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamIDs = r.Header.Values(Header)
+		w.Header().Set(Header, "from-upstream")
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+
+	resolver, _ := access_control.NewResolver("10.0.0.0/8")
+	var ctxID string
+	handler := NewAssigner(resolver).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxID = FromContext(r.Context())
+		proxy.ServeHTTP(w, r)
+	}))
+
+	for _, tc := range []struct {
+		remote, inbound string
+		trusted         bool
+	}{
+		{"10.1.2.3:1234", "lb-abc-123", true},
+		{"1.2.3.4:1234", "forged", false},
+		{"10.1.2.3:1234", "bad\nid", false},
+		{"10.1.2.3:1234", "", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		if tc.inbound != "" {
+			req.Header.Set(Header, tc.inbound)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Values(Header)
+		if len(got) != 1 || got[0] != ctxID || len(upstreamIDs) != 1 || upstreamIDs[0] != ctxID {
+			t.Errorf("%s %q: response %v, context %s, upstream %v", tc.remote, tc.inbound, got, ctxID, upstreamIDs)
+		}
+		if (ctxID == tc.inbound) != tc.trusted || (!tc.trusted && len(ctxID) != 26) {
+			t.Errorf("%s %q: want trusted %v, got %s", tc.remote, tc.inbound, tc.trusted, ctxID)
+		}
+	}
+}
+
+// TestMiddleware 测试被后续中间件拒绝的请求也带有请求ID
+func TestMiddleware(t *testing.T) {
+	router := middleware.NewSliceRouter()
+	router.Group("/").Use(HTTPMiddleware(NewAssigner(nil)), func(c *middleware.SliceRouterContext) {
+		c.Rw.WriteHeader(http.StatusForbidden)
+		c.Abort()
+	})
+	handler := middleware.NewSliceRouterHandler(nil, router)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(Header, "client-id")
+	handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get(Header); rec.Code != http.StatusForbidden || len(id) != 26 {
+		t.Errorf("want generated id on 403, got %d %q", rec.Code, id)
+	}
+}
+
+// TestTCPMiddleware 测试每个TCP会话生成一个请求ID
+func TestTCPMiddleware(t *testing.T) {
+	var id string
+	router := middleware.NewTCPSliceRouter()
+	router.Group("").Use(TCPMiddleware())
+	handler := middleware.NewTCPSliceRouterHandler(func(c *middleware.TCPSliceRouterContext) tcp_proxy.TCPHandler {
+		id = FromContext(c.Ctx)
+		return tcp_proxy.DefaultTCPHandler{}
+	}, router)
+
+	client, server := net.Pipe()
+	go func() {
+		buf := make([]byte, 64)
+		client.Read(buf)
+		client.Close()
+	}()
+	handler.Serve(context.Background(), server)
+	if len(id) != 26 {
+		t.Errorf("want ulid in context, got %q", id)
+	}
+}
@@ -0,0 +1,73 @@
+package request_id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// crockford Crockford Base32 字母表，去掉了 I、L、O、U，按字典序排列
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGenerator 单调递增的 ULID 生成器
+//
+// ULID 共 128 位：48 位毫秒时间戳 + 80 位随机数，编码为 26 个字符。
+// 同一毫秒内生成多个时，随机部分在上一个的基础上加一，保证按字符串排序即为生成顺序
+type ulidGenerator struct {
+	mu     sync.Mutex
+	lastMs uint64
+	hi     uint16 // 随机部分高 16 位
+	lo     uint64 // 随机部分低 64 位
+}
+
+var defaultGenerator ulidGenerator
+
+// New 生成一个新的 ULID 作为请求ID
+func New() string {
+	return defaultGenerator.next(time.Now())
+}
+
+func (g *ulidGenerator) next(now time.Time) string {
+	ms := uint64(now.UnixMilli())
+	g.mu.Lock()
+	if ms <= g.lastMs {
+		// 同一毫秒或时钟回拨，沿用上一个时间戳并递增随机部分，溢出时借用下一毫秒
+		ms = g.lastMs
+		g.lo++
+		if g.lo == 0 {
+			g.hi++
+			if g.hi == 0 {
+				ms++
+			}
+		}
+	} else {
+		var buf [10]byte
+		_, _ = rand.Read(buf[:])
+		g.hi = binary.BigEndian.Uint16(buf[:2])
+		g.lo = binary.BigEndian.Uint64(buf[2:])
+	}
+	g.lastMs = ms
+	hi, lo := g.hi, g.lo
+	g.mu.Unlock()
+
+	var id [16]byte
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	binary.BigEndian.PutUint16(id[6:8], hi)
+	binary.BigEndian.PutUint64(id[8:16], lo)
+	return encode(id)
+}
+
+// encode 按 5 位一组编码 128 位，首字符只有 3 位有效
+func encode(id [16]byte) string {
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// abortIndex 中间件链被终止时的索引，中间件数量不能超过该值
+const abortIndex int8 = math.MaxInt8 / 2
+
+// HandlerFunc HTTP中间件
+type HandlerFunc func(*SliceRouterContext)
+
+// SliceRouter HTTP中间件路由器：按路径前缀把请求分发到不同的路由组
+//
+// 与 gin 的 Use/Next/Abort 类似，每个路由组持有一个有序的中间件切片，
+// 请求依次经过中间件，最后由核心处理器（如 httputil.ReverseProxy）处理
+type SliceRouter struct {
+	groups []*SliceGroup
+}
+
+// SliceGroup 路由组
+type SliceGroup struct {
+	*SliceRouter
+	path     string
+	handlers []HandlerFunc
+}
+
+// SliceRouterContext 请求在中间件链中的上下文
+type SliceRouterContext struct {
+	Rw  http.ResponseWriter
+	Req *http.Request
+	Ctx context.Context
+	*SliceGroup
+
+	index int8
+	keys  map[string]any
+}
+
+// NewSliceRouter 新建HTTP中间件路由器
+func NewSliceRouter() *SliceRouter {
+	return &SliceRouter{}
+}
+
+// Group 创建路由组，请求路径以 path 开头时进入该组，多个组匹配时取最长前缀
+func (g *SliceRouter) Group(path string) *SliceGroup {
+	group := &SliceGroup{SliceRouter: g, path: path}
+	g.groups = append(g.groups, group)
+	sort.SliceStable(g.groups, func(i, j int) bool { return len(g.groups[i].path) > len(g.groups[j].path) })
+	return group
+}
+
+// Group 创建子路由组，继承当前组已注册的中间件
+func (g *SliceGroup) Group(path string) *SliceGroup {
+	child := g.SliceRouter.Group(g.path + path)
+	child.handlers = append(child.handlers, g.handlers...)
+	return child
+}
+
+// Path 路由组的路径前缀
+func (g *SliceGroup) Path() string {
+	return g.path
+}
+
+// Use 追加中间件
+func (g *SliceGroup) Use(middlewares ...HandlerFunc) *SliceGroup {
+	g.handlers = append(g.handlers, middlewares...)
+	if len(g.handlers) >= int(abortIndex) {
+		panic("middleware: too many handlers")
+	}
+	return g
+}
+
+// match 返回最长前缀匹配的路由组
+func (g *SliceRouter) match(path string) *SliceGroup {
+	for _, group := range g.groups {
+		if strings.HasPrefix(path, group.path) {
+			return group
+		}
+	}
+	return nil
+}
+
+// Next 执行下一个中间件，返回后继续执行当前中间件的剩余逻辑
+func (c *SliceRouterContext) Next() {
+	c.index++
+	for c.index < int8(len(c.handlers)) {
+		c.handlers[c.index](c)
+		c.index++
+	}
+}
+
+// Abort 终止中间件链，后续中间件及核心处理器都不再执行
+func (c *SliceRouterContext) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted 中间件链是否已被终止
+func (c *SliceRouterContext) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// Reset 重置中间件链的执行位置
+func (c *SliceRouterContext) Reset() {
+	c.index = -1
+}
+
+// Set 保存请求级别的键值，供后续中间件读取
+func (c *SliceRouterContext) Set(key string, value any) {
+	if c.keys == nil {
+		c.keys = make(map[string]any)
+	}
+	c.keys[key] = value
+}
+
+// Get 读取请求级别的键值
+func (c *SliceRouterContext) Get(key string) (any, bool) {
+	value, ok := c.keys[key]
+	return value, ok
+}
+
+// GetString 读取字符串类型的键值
+func (c *SliceRouterContext) GetString(key string) string {
+	value, _ := c.keys[key].(string)
+	return value
+}
+
+// SliceRouterHandler 把中间件路由器适配为 http.Handler
+type SliceRouterHandler struct {
+	coreFunc func(*SliceRouterContext) http.Handler
+	router   *SliceRouter
+}
+
+// NewSliceRouterHandler 新建 http.Handler，coreFunc 返回中间件链执行完毕后的核心处理器，可为空
+func NewSliceRouterHandler(coreFunc func(*SliceRouterContext) http.Handler, router *SliceRouter) *SliceRouterHandler {
+	return &SliceRouterHandler{coreFunc: coreFunc, router: router}
+}
+
+func (w *SliceRouterHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	c := newSliceRouterContext(rw, req, w.router)
+	if c == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	if w.coreFunc != nil {
+		c.handlers = append(c.handlers, func(c *SliceRouterContext) {
+			w.coreFunc(c).ServeHTTP(c.Rw, c.Req)
+		})
+	}
+	c.Reset()
+	c.Next()
+}
+
+func newSliceRouterContext(rw http.ResponseWriter, req *http.Request, r *SliceRouter) *SliceRouterContext {
+	group := r.match(req.URL.Path)
+	if group == nil {
+		return nil
+	}
+	// 拷贝一份路由组，追加核心处理器时不影响其他请求
+	newGroup := &SliceGroup{SliceRouter: r, path: group.path}
+	newGroup.handlers = append(newGroup.handlers, group.handlers...)
+	return &SliceRouterContext{Rw: rw, Req: req, Ctx: req.Context(), SliceGroup: newGroup}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+	"testing"
+)
+
+// TestSliceRouter_Chain 测试中间件的执行顺序、键值传递以及核心处理器
+func TestSliceRouter_Chain(t *testing.T) {
+	var trace []string
+	router := NewSliceRouter()
+	router.Group("/").Use(func(c *SliceRouterContext) {
+		trace = append(trace, "root")
+		c.Next()
+	})
+	api := router.Group("/api").Use(func(c *SliceRouterContext) {
+		trace = append(trace, "mw1-start")
+		c.Set("user", "sen")
+		c.Next()
+		trace = append(trace, "mw1-end")
+	})
+	api.Group("/v1").Use(func(c *SliceRouterContext) {
+		trace = append(trace, "mw2:"+c.GetString("user"))
+	})
+
+	handler := NewSliceRouterHandler(func(c *SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace = append(trace, "core")
+		})
+	}, router)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/orders", nil))
+	want := []string{"mw1-start", "mw2:sen", "core", "mw1-end"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("got %v, want %v", trace, want)
+	}
+
+	trace = nil
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+	if !reflect.DeepEqual(trace, []string{"root", "core"}) {
+		t.Errorf("got %v", trace)
+	}
+}
+
+// TestSliceRouter_Abort 测试 Abort 后不再执行后续中间件和核心处理器
+func TestSliceRouter_Abort(t *testing.T) {
+	called := false
+	router := NewSliceRouter()
+	router.Group("/").Use(func(c *SliceRouterContext) {
+		c.Rw.WriteHeader(http.StatusForbidden)
+		c.Abort()
+	}, func(c *SliceRouterContext) {
+		called = true
+	})
+	handler := NewSliceRouterHandler(func(c *SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+	}, router)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if called || rec.Code != http.StatusForbidden {
+		t.Errorf("chain not aborted, status %d", rec.Code)
+	}
+}
+
+// TestTCPSliceRouter 测试TCP中间件按监听地址匹配路由组
+func TestTCPSliceRouter(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	var trace []string
+	router := NewTCPSliceRouter()
+	router.Group("").Use(func(c *TCPSliceRouterContext) {
+		trace = append(trace, "default")
+		c.Next()
+	})
+	router.Group("pipe").Use(func(c *TCPSliceRouterContext) {
+		trace = append(trace, "pipe")
+		c.Next()
+	})
+	handler := NewTCPSliceRouterHandler(func(c *TCPSliceRouterContext) tcp_proxy.TCPHandler {
+		return tcp_proxy.DefaultTCPHandler{}
+	}, router)
+
+	go func() {
+		buf := make([]byte, 64)
+		client.Read(buf)
+	}()
+	ctx := context.WithValue(context.Background(), tcp_proxy.LocalAddrContextKey, server.LocalAddr())
+	handler.Serve(ctx, server)
+	if !reflect.DeepEqual(trace, []string{"pipe"}) {
+		t.Errorf("got %v", trace)
+	}
+}
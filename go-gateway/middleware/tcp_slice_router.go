@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"sen-golang-study/go-gateway/proxy/tcp_proxy"
+)
+
+// TCPHandlerFunc TCP中间件
+type TCPHandlerFunc func(*TCPSliceRouterContext)
+
+// TCPSliceRouter TCP中间件路由器：按监听地址把连接分发到不同的路由组
+//
+// TCP连接没有路径，路由组以监听地址区分，监听地址为空的组匹配所有连接
+type TCPSliceRouter struct {
+	groups []*TCPSliceGroup
+}
+
+// TCPSliceGroup TCP路由组
+type TCPSliceGroup struct {
+	*TCPSliceRouter
+	addr     string
+	handlers []TCPHandlerFunc
+}
+
+// TCPSliceRouterContext 连接在中间件链中的上下文
+type TCPSliceRouterContext struct {
+	Conn net.Conn
+	Ctx  context.Context
+	*TCPSliceGroup
+
+	index int8
+	keys  map[string]any
+}
+
+// NewTCPSliceRouter 新建TCP中间件路由器
+func NewTCPSliceRouter() *TCPSliceRouter {
+	return &TCPSliceRouter{}
+}
+
+// Group 创建路由组，addr 为 TCPServer 的监听地址，为空时匹配所有连接
+func (g *TCPSliceRouter) Group(addr string) *TCPSliceGroup {
+	group := &TCPSliceGroup{TCPSliceRouter: g, addr: addr}
+	g.groups = append(g.groups, group)
+	return group
+}
+
+// Addr 路由组的监听地址
+func (g *TCPSliceGroup) Addr() string {
+	return g.addr
+}
+
+// Use 追加中间件
+func (g *TCPSliceGroup) Use(middlewares ...TCPHandlerFunc) *TCPSliceGroup {
+	g.handlers = append(g.handlers, middlewares...)
+	if len(g.handlers) >= int(abortIndex) {
+		panic("middleware: too many handlers")
+	}
+	return g
+}
+
+// match 优先匹配监听地址相同的路由组，其次匹配地址为空的路由组
+func (g *TCPSliceRouter) match(localAddr string) *TCPSliceGroup {
+	var fallback *TCPSliceGroup
+	for _, group := range g.groups {
+		if group.addr == localAddr {
+			return group
+		}
+		if group.addr == "" && fallback == nil {
+			fallback = group
+		}
+	}
+	return fallback
+}
+
+// Next 执行下一个中间件
+func (c *TCPSliceRouterContext) Next() {
+	c.index++
+	for c.index < int8(len(c.handlers)) {
+		c.handlers[c.index](c)
+		c.index++
+	}
+}
+
+// Abort 终止中间件链
+func (c *TCPSliceRouterContext) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted 中间件链是否已被终止
+func (c *TCPSliceRouterContext) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// Reset 重置中间件链的执行位置
+func (c *TCPSliceRouterContext) Reset() {
+	c.index = -1
+}
+
+// Set 保存连接级别的键值
+func (c *TCPSliceRouterContext) Set(key string, value any) {
+	if c.keys == nil {
+		c.keys = make(map[string]any)
+	}
+	c.keys[key] = value
+}
+
+// Get 读取连接级别的键值
+func (c *TCPSliceRouterContext) Get(key string) (any, bool) {
+	value, ok := c.keys[key]
+	return value, ok
+}
+
+// GetString 读取字符串类型的键值
+func (c *TCPSliceRouterContext) GetString(key string) string {
+	value, _ := c.keys[key].(string)
+	return value
+}
+
+// TCPSliceRouterHandler 把TCP中间件路由器适配为 tcp_proxy.TCPHandler
+type TCPSliceRouterHandler struct {
+	coreFunc func(*TCPSliceRouterContext) tcp_proxy.TCPHandler
+	router   *TCPSliceRouter
+}
+
+// NewTCPSliceRouterHandler 新建 TCPHandler，coreFunc 返回中间件链执行完毕后的核心处理器，可为空
+func NewTCPSliceRouterHandler(coreFunc func(*TCPSliceRouterContext) tcp_proxy.TCPHandler, router *TCPSliceRouter) *TCPSliceRouterHandler {
+	return &TCPSliceRouterHandler{coreFunc: coreFunc, router: router}
+}
+
+func (w *TCPSliceRouterHandler) Serve(ctx context.Context, conn net.Conn) {
+	localAddr := conn.LocalAddr().String()
+	if addr, ok := ctx.Value(tcp_proxy.LocalAddrContextKey).(net.Addr); ok {
+		localAddr = addr.String()
+	}
+	group := w.router.match(localAddr)
+	if group == nil {
+		return
+	}
+	c := &TCPSliceRouterContext{
+		Conn:          conn,
+		Ctx:           ctx,
+		TCPSliceGroup: &TCPSliceGroup{TCPSliceRouter: w.router, addr: group.addr},
+	}
+	c.handlers = append(c.handlers, group.handlers...)
+	if w.coreFunc != nil {
+		c.handlers = append(c.handlers, func(c *TCPSliceRouterContext) {
+			w.coreFunc(c).Serve(c.Ctx, c.Conn)
+		})
+	}
+	c.Reset()
+	c.Next()
+}
@@ -0,0 +1,116 @@
+package tenant_auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/middleware/rate_limit"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// APIKeyHeader API Key 认证使用的请求头
+	APIKeyHeader = "X-Api-Key"
+	// TenantIDHeader 认证通过后转发给下游的租户ID请求头
+	TenantIDHeader = "X-Tenant-Id"
+	// TenantKey 认证通过后租户保存在 SliceRouterContext 中的键
+	TenantKey = "tenant_auth.tenant"
+)
+
+// HTTPMiddleware 租户认证中间件
+//
+// 请求带 X-Signature 时按 HMAC 签名认证，否则按 X-Api-Key 认证，认证失败返回 401；
+// 租户无权访问当前路由时返回 403。认证通过后租户身份保存到请求上下文和 SliceRouterContext，
+// 并通过 X-Tenant-Id 转发给下游，API Key 和签名头不会转发给下游
+func HTTPMiddleware(verifier *Verifier) middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		c.Req.Header.Del(TenantIDHeader)
+		tenant, err := authenticate(verifier, c.Req)
+		if err != nil {
+			log.Printf("tenant_auth: reject %s %s from %s: %v", c.Req.Method, c.Req.URL.Path, c.Req.RemoteAddr, err)
+			status := http.StatusUnauthorized
+			if errors.Is(err, ErrBodyTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(c.Rw, http.StatusText(status), status)
+			c.Abort()
+			return
+		}
+		if !tenant.AllowRoute(c.Req.URL.Path) {
+			http.Error(c.Rw, ErrRouteForbidden.Error(), http.StatusForbidden)
+			c.Abort()
+			return
+		}
+
+		for _, header := range []string{APIKeyHeader, SignatureHeader} {
+			c.Req.Header.Del(header)
+		}
+		c.Req.Header.Set(TenantIDHeader, tenant.ID)
+		c.Req = c.Req.WithContext(NewContext(c.Req.Context(), tenant))
+		c.Ctx = c.Req.Context()
+		c.Set(TenantKey, tenant)
+		c.Next()
+	}
+}
+
+func authenticate(verifier *Verifier, req *http.Request) (*Tenant, error) {
+	if req.Header.Get(SignatureHeader) != "" {
+		return verifier.Verify(req)
+	}
+	key := req.Header.Get(APIKeyHeader)
+	if key == "" {
+		return nil, ErrSignatureMissing
+	}
+	tenant, ok := verifier.Registry.ByAPIKey(key)
+	if !ok {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+// ByTenant 按认证通过的租户限流，需放在 HTTPMiddleware 之后，未认证的请求不限流
+func ByTenant() rate_limit.KeyFunc {
+	return func(c *middleware.SliceRouterContext) string {
+		if tenant, ok := FromContext(c.Req.Context()); ok {
+			return "tenant:" + tenant.ID
+		}
+		return ""
+	}
+}
+
+// QuotaLimiter 按租户注册表中的 Quota 做每分钟请求配额限制，配合 ByTenant 使用：
+//
+//	rate_limit.HTTPMiddleware(tenant_auth.NewQuotaLimiter(registry), tenant_auth.ByTenant())
+type QuotaLimiter struct {
+	registry *Registry
+
+	mu      sync.Mutex
+	windows map[string]*rate_limit.SlidingWindow // 租户ID -> 该租户的滑动窗口
+}
+
+// NewQuotaLimiter 新建租户配额限流器
+func NewQuotaLimiter(registry *Registry) *QuotaLimiter {
+	return &QuotaLimiter{registry: registry, windows: make(map[string]*rate_limit.SlidingWindow)}
+}
+
+func (l *QuotaLimiter) Allow(key string) rate_limit.Result {
+	id := strings.TrimPrefix(key, "tenant:")
+	tenant, ok := l.registry.Get(id)
+	if !ok || tenant.Quota <= 0 {
+		return rate_limit.Result{Allowed: true}
+	}
+
+	l.mu.Lock()
+	window, ok := l.windows[id]
+	if !ok {
+		window = rate_limit.NewSlidingWindow(tenant.Quota, time.Minute)
+		l.windows[id] = window
+	}
+	l.mu.Unlock()
+	// 配额在运行时调整后立即生效
+	window.Update(tenant.Quota, time.Minute)
+	return window.Allow(key)
+}
@@ -0,0 +1,108 @@
+package tenant_auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownTenant  = errors.New("tenant_auth: unknown tenant")
+	ErrRouteForbidden = errors.New("tenant_auth: route is not allowed for tenant")
+)
+
+// Tenant 接入网关的租户/应用
+type Tenant struct {
+	ID            string
+	APIKey        string   // X-Api-Key 认证使用
+	Secret        string   // HMAC 签名认证使用
+	AllowedRoutes []string // 允许访问的路径前缀，为空时允许所有路由
+	Quota         int      // 每分钟请求配额，0 表示不限制，见 QuotaLimiter
+	Disabled      bool
+}
+
+// AllowRoute 判断租户能否访问 path
+func (t *Tenant) AllowRoute(path string) bool {
+	if len(t.AllowedRoutes) == 0 {
+		return true
+	}
+	for _, prefix := range t.AllowedRoutes {
+		if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry 租户注册表，支持运行时增删租户
+type Registry struct {
+	mu       sync.RWMutex
+	byID     map[string]*Tenant
+	byAPIKey map[string]*Tenant
+}
+
+// NewRegistry 新建租户注册表
+func NewRegistry(tenants ...*Tenant) *Registry {
+	r := &Registry{byID: make(map[string]*Tenant), byAPIKey: make(map[string]*Tenant)}
+	for _, t := range tenants {
+		r.Put(t)
+	}
+	return r
+}
+
+// Put 新增或替换租户
+func (r *Registry) Put(t *Tenant) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.byID[t.ID]; ok {
+		delete(r.byAPIKey, old.APIKey)
+	}
+	r.byID[t.ID] = t
+	if t.APIKey != "" {
+		r.byAPIKey[t.APIKey] = t
+	}
+}
+
+// Remove 删除租户
+func (r *Registry) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.byID[id]; ok {
+		delete(r.byAPIKey, t.APIKey)
+		delete(r.byID, id)
+	}
+}
+
+// Get 按租户ID查找
+func (r *Registry) Get(id string) (*Tenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.byID[id]
+	return t, ok && !t.Disabled
+}
+
+// ByAPIKey 按 API Key 查找，找到后再做一次常量时间比较
+func (r *Registry) ByAPIKey(key string) (*Tenant, bool) {
+	r.mu.RLock()
+	t, ok := r.byAPIKey[key]
+	r.mu.RUnlock()
+	if !ok || t.Disabled || subtle.ConstantTimeCompare([]byte(t.APIKey), []byte(key)) != 1 {
+		return nil, false
+	}
+	return t, true
+}
+
+type contextKey struct{}
+
+// NewContext 把租户身份保存到请求上下文
+func NewContext(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext 从请求上下文取出认证通过的租户
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(*Tenant)
+	return t, ok
+}
@@ -0,0 +1,166 @@
+package tenant_auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HMAC 签名认证使用的请求头
+const (
+	AppIDHeader     = "X-App-Id"
+	TimestampHeader = "X-Timestamp" // Unix 秒
+	NonceHeader     = "X-Nonce"
+	SignatureHeader = "X-Signature" // hex(HMAC-SHA256(secret, StringToSign))
+)
+
+var (
+	ErrSignatureMissing = errors.New("tenant_auth: missing signature headers")
+	ErrClockSkew        = errors.New("tenant_auth: timestamp outside allowed clock skew")
+	ErrReplay           = errors.New("tenant_auth: nonce already used")
+	ErrBadSignature     = errors.New("tenant_auth: signature mismatch")
+	ErrBodyTooLarge     = errors.New("tenant_auth: request body too large to sign")
+)
+
+// StringToSign 待签名字符串，各部分用换行分隔：
+//
+//	METHOD
+//	PATH?QUERY
+//	TIMESTAMP
+//	NONCE
+//	hex(SHA256(BODY))
+func StringToSign(method, requestURI, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// Sign 计算签名，客户端 SDK 和测试使用
+func Sign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest 给请求加上签名头，body 为请求体内容
+func SignRequest(req *http.Request, appID, secret, nonce string, body []byte, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(AppIDHeader, appID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(NonceHeader, nonce)
+	req.Header.Set(SignatureHeader, Sign(secret, StringToSign(req.Method, req.URL.RequestURI(), timestamp, nonce, body)))
+}
+
+// Verifier HMAC 签名校验器
+type Verifier struct {
+	Registry    *Registry
+	ClockSkew   time.Duration // 允许的客户端时钟偏差
+	MaxBodySize int64         // 参与签名的请求体上限
+
+	nonces *NonceCache
+	now    func() time.Time
+}
+
+// NewVerifier 新建签名校验器，默认允许 5 分钟时钟偏差，请求体上限 1MB
+func NewVerifier(registry *Registry) *Verifier {
+	return &Verifier{
+		Registry:    registry,
+		ClockSkew:   5 * time.Minute,
+		MaxBodySize: 1 << 20,
+		nonces:      NewNonceCache(),
+		now:         time.Now,
+	}
+}
+
+// Verify 校验请求签名，读取请求体后会重新放回 req.Body
+//
+// 时间戳超出时钟偏差窗口直接拒绝，窗口内的 nonce 只能使用一次，两者结合防止重放
+func (v *Verifier) Verify(req *http.Request) (*Tenant, error) {
+	appID := req.Header.Get(AppIDHeader)
+	timestamp := req.Header.Get(TimestampHeader)
+	nonce := req.Header.Get(NonceHeader)
+	signature := req.Header.Get(SignatureHeader)
+	if appID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return nil, ErrSignatureMissing
+	}
+	tenant, ok := v.Registry.Get(appID)
+	if !ok {
+		return nil, ErrUnknownTenant
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrClockSkew
+	}
+	now := v.now()
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > v.ClockSkew || skew < -v.ClockSkew {
+		return nil, ErrClockSkew
+	}
+
+	body, err := v.readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	expected := Sign(tenant.Secret, StringToSign(req.Method, req.URL.RequestURI(), timestamp, nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return nil, ErrBadSignature
+	}
+	// 签名通过后再记录 nonce，避免伪造请求占用合法客户端的 nonce
+	if !v.nonces.Add(appID+":"+nonce, now.Add(2*v.ClockSkew), now) {
+		return nil, ErrReplay
+	}
+	return tenant, nil
+}
+
+func (v *Verifier) readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, v.MaxBodySize+1))
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > v.MaxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// NonceCache 记录时钟偏差窗口内已使用的 nonce
+type NonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time // nonce -> 过期时间
+	ops    int
+}
+
+// NewNonceCache 新建 nonce 缓存
+func NewNonceCache() *NonceCache {
+	return &NonceCache{nonces: make(map[string]time.Time)}
+}
+
+// Add 记录 nonce，nonce 已存在且未过期时返回 false
+func (c *NonceCache) Add(nonce string, expireAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ops++; c.ops >= 4096 {
+		c.ops = 0
+		for n, exp := range c.nonces {
+			if !now.Before(exp) {
+				delete(c.nonces, n)
+			}
+		}
+	}
+	if exp, ok := c.nonces[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	c.nonces[nonce] = expireAt
+	return true
+}
@@ -0,0 +1,114 @@
+package tenant_auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/middleware/rate_limit"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRegistry() *Registry {
+	return NewRegistry(
+		&Tenant{ID: "partner-a", APIKey: "key-a", Secret: "secret-a", AllowedRoutes: []string{"/orders"}, Quota: 2},
+		&Tenant{ID: "partner-b", APIKey: "key-b", Secret: "secret-b", Disabled: true},
+	)
+}
+
+// TestVerifier 测试签名校验、时钟偏差窗口和 nonce 防重放
+func TestVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := NewVerifier(newTestRegistry())
+	v.now = func() time.Time { return now }
+
+	newRequest := func(nonce string, signedAt time.Time, secret, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader(body))
+		SignRequest(req, "partner-a", secret, nonce, []byte(body), signedAt)
+		return req
+	}
+
+	req := newRequest("n1", now, "secret-a", `{"sku":1}`)
+	if tenant, err := v.Verify(req); err != nil || tenant.ID != "partner-a" {
+		t.Fatalf("want partner-a verified, got %v %v", tenant, err)
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != `{"sku":1}` {
+		t.Errorf("want body restored for upstream, got %q", body)
+	}
+
+	cases := []struct {
+		name string
+		req  *http.Request
+		want error
+	}{
+		{"replay", newRequest("n1", now, "secret-a", `{"sku":1}`), ErrReplay},
+		{"wrong secret", newRequest("n2", now, "secret-x", ""), ErrBadSignature},
+		{"skew", newRequest("n3", now.Add(-6*time.Minute), "secret-a", ""), ErrClockSkew},
+		{"future", newRequest("n4", now.Add(6*time.Minute), "secret-a", ""), ErrClockSkew},
+	}
+	tampered := newRequest("n5", now, "secret-a", `{"sku":1}`)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"sku":2}`))
+	cases = append(cases, struct {
+		name string
+		req  *http.Request
+		want error
+	}{"tampered body", tampered, ErrBadSignature})
+
+	for _, c := range cases {
+		if _, err := v.Verify(c.req); !errors.Is(err, c.want) {
+			t.Errorf("%s: want %v, got %v", c.name, c.want, err)
+		}
+	}
+
+	// 伪造签名的请求不会占用 nonce
+	if _, err := v.Verify(newRequest("n2", now, "secret-a", "")); err != nil {
+		t.Errorf("want nonce of rejected request reusable, got %v", err)
+	}
+}
+
+// TestHTTPMiddleware 测试 API Key 认证、路由授权、租户身份转发和租户配额
+func TestHTTPMiddleware(t *testing.T) {
+	registry := newTestRegistry()
+	router := middleware.NewSliceRouter()
+	router.Group("/").Use(HTTPMiddleware(NewVerifier(registry)),
+		rate_limit.HTTPMiddleware(NewQuotaLimiter(registry), ByTenant()))
+	handler := middleware.NewSliceRouterHandler(func(c *middleware.SliceRouterContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, _ := FromContext(r.Context())
+			fmt.Fprintf(w, "%s|%s|%s", r.Header.Get(TenantIDHeader), tenant.ID, r.Header.Get(APIKeyHeader))
+		})
+	}, router)
+
+	cases := []struct {
+		path, key string
+		status    int
+		body      string
+	}{
+		{"/orders", "", http.StatusUnauthorized, ""},
+		{"/orders", "wrong", http.StatusUnauthorized, ""},
+		{"/orders", "key-b", http.StatusUnauthorized, ""},
+		{"/users", "key-a", http.StatusForbidden, ""},
+		{"/orders/1", "key-a", http.StatusOK, "partner-a|partner-a|"},
+		{"/orders/2", "key-a", http.StatusOK, "partner-a|partner-a|"},
+		{"/orders/3", "key-a", http.StatusTooManyRequests, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		req.Header.Set(TenantIDHeader, "spoofed")
+		if c.key != "" {
+			req.Header.Set(APIKeyHeader, c.key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s %s: want status %d, got %d", c.path, c.key, c.status, rec.Code)
+		}
+		if c.body != "" && rec.Body.String() != c.body {
+			t.Errorf("%s: want body %q, got %q", c.path, c.body, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package grpc_proxy
+
+import (
+	"fmt"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// Frame 一条未解码的 gRPC 消息，代理只转发字节，不需要知道消息的 protobuf 定义
+type Frame struct {
+	Payload []byte
+}
+
+// rawCodec 透传消息字节的编解码器
+//
+// 代理收发的消息是 *Frame，原样转发；名称为 proto，与客户端、下游协商的 content-subtype 保持一致。
+// 代理自己发起调用时也可能传入普通的 protobuf 消息，此时退回 protobuf 编解码
+type rawCodec struct{}
+
+var _ encoding.Codec = rawCodec{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case *Frame:
+		return m.Payload, nil
+	case proto.Message:
+		return proto.Marshal(m)
+	}
+	return nil, fmt.Errorf("grpc_proxy: cannot marshal %T", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch m := v.(type) {
+	case *Frame:
+		// data 在返回后可能被复用，需要拷贝
+		m.Payload = append(m.Payload[:0], data...)
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+	}
+	return fmt.Errorf("grpc_proxy: cannot unmarshal into %T", v)
+}
+
+func (rawCodec) Name() string { return "proto" }
@@ -0,0 +1,202 @@
+package grpc_proxy
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"io"
+	"net"
+	"sen-golang-study/go-gateway/load_balance"
+	"sen-golang-study/golang/148_net/04_rpc/demo_product/protobufs/compiles"
+	"testing"
+	"time"
+)
+
+// productServer 测试用的产品服务：返回收到的 metadata 和截止时间，id 为 0 时返回 NotFound
+type productServer struct {
+	compiles.UnimplementedProductServer
+}
+
+func (productServer) ProductInfo(ctx context.Context, req *compiles.ProductRequest) (*compiles.ProductResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := metadata.Pairs("x-user", first(md, "x-user"), "x-forwarded-for", first(md, "x-forwarded-for"),
+		"x-request-id", first(md, "x-request-id"))
+	if _, ok := ctx.Deadline(); ok {
+		header.Set("x-deadline", "set")
+	}
+	grpc.SetHeader(ctx, header)
+	grpc.SetTrailer(ctx, metadata.Pairs("x-cost", "1ms"))
+	if req.Id == 0 {
+		return nil, status.Error(codes.NotFound, "no such product")
+	}
+	if req.Id < 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &compiles.ProductResponse{Id: req.Id, Name: "gRPC Product Demo", IsSale: true}, nil
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// echoDesc 双向流服务：把收到的每条消息原样返回
+var echoDesc = grpc.ServiceDesc{
+	ServiceName: "Echo",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Chat",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			for {
+				msg := &wrapperspb.StringValue{}
+				if err := stream.RecvMsg(msg); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				msg.Value = "echo: " + msg.Value
+				if err := stream.SendMsg(msg); err != nil {
+					return err
+				}
+			}
+		},
+	}},
+}
+
+// listen 启动 gRPC 服务器，返回监听地址
+func listen(t *testing.T, server *grpc.Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+	return l.Addr().String()
+}
+
+// setup 启动下游服务和代理，返回连接代理的客户端
+func setup(t *testing.T) *grpc.ClientConn {
+	upstream := grpc.NewServer()
+	compiles.RegisterProductServer(upstream, productServer{})
+	upstream.RegisterService(&echoDesc, nil)
+	upstreamAddr := listen(t, upstream)
+
+	// 关闭的端口，模拟下游不可用
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	downAddr := l.Addr().String()
+	l.Close()
+
+	proxy := NewProxy()
+	t.Cleanup(func() { proxy.Close() })
+	proxy.Route("/Product/ProductInfo", load_balance.NewRoundRobinBalance(upstreamAddr))
+	proxy.Route("/Echo/", load_balance.NewRoundRobinBalance(upstreamAddr))
+	proxy.Route("/Down/", load_balance.NewRoundRobinBalance(downAddr))
+	proxyAddr := listen(t, proxy.NewServer())
+
+	cc, err := grpc.NewClient(proxyAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+// TestUnary 测试一元调用：metadata、截止时间传给下游，下游的 header、trailer 返回给客户端
+func TestUnary(t *testing.T) {
+	client := compiles.NewProductClient(setup(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-user", "alice")
+
+	var header, trailer metadata.MD
+	res, err := client.ProductInfo(ctx, &compiles.ProductRequest{Id: 7}, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Id != 7 || res.Name != "gRPC Product Demo" {
+		t.Errorf("unexpected response %v", res)
+	}
+	if first(header, "x-user") != "alice" || first(header, "x-forwarded-for") != "127.0.0.1" ||
+		len(first(header, "x-request-id")) != 26 || first(header, "x-deadline") != "set" {
+		t.Errorf("unexpected header %v", header)
+	}
+	if first(trailer, "x-cost") != "1ms" {
+		t.Errorf("want trailer forwarded, got %v", trailer)
+	}
+}
+
+// TestStreaming 测试双向流调用
+func TestStreaming(t *testing.T) {
+	cc := setup(t)
+	stream, err := cc.NewStream(context.Background(), &echoDesc.Streams[0], "/Echo/Chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, word := range []string{"a", "b", "c"} {
+		if err := stream.SendMsg(wrapperspb.String(word)); err != nil {
+			t.Fatal(err)
+		}
+		got := &wrapperspb.StringValue{}
+		if err := stream.RecvMsg(got); err != nil || got.Value != "echo: "+word {
+			t.Fatalf("want echo: %s, got %q %v", word, got.Value, err)
+		}
+	}
+	stream.CloseSend()
+	if err := stream.RecvMsg(&wrapperspb.StringValue{}); err != io.EOF {
+		t.Errorf("want io.EOF, got %v", err)
+	}
+}
+
+// TestErrors 测试错误映射：下游状态码透传，无路由为 Unimplemented，下游不可用为 Unavailable，超时为 DeadlineExceeded
+func TestErrors(t *testing.T) {
+	cc := setup(t)
+	client := compiles.NewProductClient(cc)
+	ctx := context.Background()
+
+	if _, err := client.ProductInfo(ctx, &compiles.ProductRequest{Id: 0}); status.Code(err) != codes.NotFound {
+		t.Errorf("want NotFound, got %v", err)
+	}
+	if err := cc.Invoke(ctx, "/Unknown/Method", &compiles.ProductRequest{}, &compiles.ProductResponse{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("want Unimplemented, got %v", err)
+	}
+	if err := cc.Invoke(ctx, "/Down/Method", &compiles.ProductRequest{}, &compiles.ProductResponse{}); status.Code(err) != codes.Unavailable {
+		t.Errorf("want Unavailable, got %v", err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.ProductInfo(timeout, &compiles.ProductRequest{Id: -1}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("want DeadlineExceeded, got %v", err)
+	}
+}
+
+// TestRoute 测试路由匹配的优先级和无效的路由
+func TestRoute(t *testing.T) {
+	exact, service, fallback := load_balance.NewRoundRobinBalance("a:1"), load_balance.NewRoundRobinBalance("b:1"), load_balance.NewRoundRobinBalance("c:1")
+	p := NewProxy()
+	p.Route("/Product/ProductInfo", exact)
+	p.Route("/Product/", service)
+	p.Route("/", fallback)
+	for method, want := range map[string]load_balance.LoadBalance{
+		"/Product/ProductInfo": exact,
+		"/Product/List":        service,
+		"/Order/Create":        fallback,
+	} {
+		if got := p.match(method); got != want {
+			t.Errorf("%s: unexpected route", method)
+		}
+	}
+	for _, invalid := range []string{"Product/", "/a/b/c"} {
+		if err := p.Route(invalid, exact); err == nil {
+			t.Errorf("want %q rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sen-golang-study/go-gateway/load_balance"
+	"sen-golang-study/go-gateway/proxy/grpc_proxy"
+	"sen-golang-study/go-gateway/proxy/grpc_proxy/transcode"
+	_ "sen-golang-study/golang/148_net/04_rpc/demo_product/protobufs/compiles"
+	"syscall"
+	"time"
+)
+
+// gRPC反向代理
+//
+// 客户端 -> 代理服务器(:5052) -> 按方法名路由 -> 产品服务(:5051，golang/148_net/04_rpc/demo_product)
+//
+// 订单服务等客户端把地址改为 127.0.0.1:5052 即可经过网关调用产品服务，不需要产品服务的 proto 定义
+//
+// HTTP 客户端 -> 转换服务器(:8082) -> JSON 转为 gRPC 调用 -> 代理服务器(:5052)
+//
+//	curl http://127.0.0.1:8082/products/7
+func main() {
+	products := load_balance.NewRoundRobinBalance("127.0.0.1:5051")
+	checker := load_balance.NewHealthChecker(products, 5*time.Second)
+	checker.Start()
+	defer checker.Stop()
+
+	proxy := grpc_proxy.NewProxy()
+	defer proxy.Close()
+	if err := proxy.Route("/Product/", products); err != nil {
+		log.Fatal(err)
+	}
+	server := proxy.NewServer()
+
+	go func() {
+		var addr = "127.0.0.1:5052"
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Starting gRPC proxy server at " + addr)
+		log.Fatal(server.Serve(listener))
+	}()
+
+	// 转换器经过 gRPC 代理调用，共用代理的路由和负载均衡
+	conn, err := grpc.NewClient("127.0.0.1:5052", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	transcoder := transcode.NewTranscoder(transcode.GlobalFiles, conn)
+	if err := transcoder.Handle(transcode.Rule{Method: http.MethodGet, Pattern: "/products/{id}", GRPCMethod: "/Product/ProductInfo"}); err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		var addr = "127.0.0.1:8082"
+		log.Println("Starting HTTP transcoding server at " + addr)
+		log.Fatal(http.ListenAndServe(addr, transcoder))
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	server.GracefulStop()
+}
@@ -0,0 +1,258 @@
+package grpc_proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"log"
+	"net"
+	"sen-golang-study/go-gateway/load_balance"
+	"sen-golang-study/go-gateway/middleware/request_id"
+	"strings"
+	"sync"
+)
+
+// Proxy 透明的 gRPC 反向代理
+//
+// 代理服务器不注册任何服务，所有调用都交给 UnknownServiceHandler 处理：
+//  1. 按完整方法名（如 /Product/ProductInfo）匹配路由，选出下游地址池
+//  2. 通过负载均衡器选出下游，复用到该下游的 ClientConn
+//  3. 以双向流的方式发起调用，一元调用和三种流式调用都按流转发，消息以原始字节透传
+//  4. 请求 metadata 和截止时间传给下游，下游的 header、trailer 和状态码原样返回给客户端
+type Proxy struct {
+	// DialOptions 连接下游的额外选项，默认使用明文连接
+	DialOptions []grpc.DialOption
+
+	mu     sync.RWMutex
+	exact  map[string]load_balance.LoadBalance // /Service/Method
+	prefix map[string]load_balance.LoadBalance // /Service/，"/" 为默认路由
+	conns  map[string]*grpc.ClientConn
+}
+
+// NewProxy 新建 gRPC 反向代理
+func NewProxy() *Proxy {
+	return &Proxy{
+		exact:  make(map[string]load_balance.LoadBalance),
+		prefix: make(map[string]load_balance.LoadBalance),
+		conns:  make(map[string]*grpc.ClientConn),
+	}
+}
+
+// Route 添加路由，pattern 支持三种写法，匹配优先级从高到低：
+//
+//	/Product/ProductInfo   完整方法名
+//	/Product/              服务下的所有方法
+//	/                      默认路由
+func (p *Proxy) Route(pattern string, balancer load_balance.LoadBalance) error {
+	if !strings.HasPrefix(pattern, "/") || strings.Count(pattern, "/") > 2 {
+		return fmt.Errorf("grpc_proxy: invalid route pattern %q", pattern)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pattern == "/" || strings.HasSuffix(pattern, "/") {
+		p.prefix[pattern] = balancer
+	} else {
+		p.exact[pattern] = balancer
+	}
+	return nil
+}
+
+// NewServer 新建代理服务器，opts 可以追加拦截器等选项
+func (p *Proxy) NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(p.Handler))
+	return grpc.NewServer(opts...)
+}
+
+// Close 关闭到所有下游的连接
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for addr, conn := range p.conns {
+		errs = append(errs, conn.Close())
+		delete(p.conns, addr)
+	}
+	return errors.Join(errs...)
+}
+
+// Handler 转发一次调用，可直接作为 grpc.UnknownServiceHandler 使用
+func (p *Proxy) Handler(srv any, serverStream grpc.ServerStream) error {
+	method, ok := grpc.MethodFromServerStream(serverStream)
+	if !ok {
+		return status.Error(codes.Internal, "grpc_proxy: method not found in stream")
+	}
+	ctx := serverStream.Context()
+	balancer := p.match(method)
+	if balancer == nil {
+		return status.Errorf(codes.Unimplemented, "grpc_proxy: no route for %s", method)
+	}
+	client := ""
+	if pr, ok := peer.FromContext(ctx); ok {
+		client = pr.Addr.String()
+	}
+	addr, err := balancer.Get(client)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "grpc_proxy: no available upstream for %s: %v", method, err)
+	}
+	conn, err := p.conn(addr)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "grpc_proxy: connect upstream %s: %v", addr, err)
+	}
+
+	// 截止时间随 ctx 传给下游，客户端取消时下游调用也会被取消
+	clientCtx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, outgoingMD(ctx, client)))
+	defer cancel()
+	clientStream, err := grpc.NewClientStream(clientCtx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, conn, method)
+	if err != nil {
+		return upstreamError(addr, method, err)
+	}
+
+	// 客户端 -> 下游：客户端发送完毕时关闭下游的发送方向
+	upErr := make(chan error, 1)
+	go func() { upErr <- forwardToUpstream(serverStream, clientStream) }()
+	// 下游 -> 客户端：下游结束时即为调用结束
+	downErr := make(chan error, 1)
+	go func() { downErr <- forwardToClient(clientStream, serverStream) }()
+
+	for {
+		select {
+		case err := <-upErr:
+			if err == io.EOF {
+				// 客户端发送完毕，或下游已经结束，结果以下游方向为准
+				clientStream.CloseSend()
+				upErr = nil
+				continue
+			}
+			// 读取客户端消息失败，通常是客户端取消了调用
+			cancel()
+			if s, ok := status.FromError(err); ok {
+				return s.Err()
+			}
+			return status.FromContextError(err).Err()
+		case err := <-downErr:
+			serverStream.SetTrailer(clientStream.Trailer())
+			if err == io.EOF {
+				return nil
+			}
+			return upstreamError(addr, method, err)
+		}
+	}
+}
+
+func (p *Proxy) match(method string) load_balance.LoadBalance {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if b, ok := p.exact[method]; ok {
+		return b
+	}
+	if i := strings.LastIndexByte(method, '/'); i > 0 {
+		if b, ok := p.prefix[method[:i+1]]; ok {
+			return b
+		}
+	}
+	return p.prefix["/"]
+}
+
+// conn 返回到下游的连接，同一个下游的所有调用在一个 HTTP/2 连接上多路复用
+func (p *Proxy) conn(addr string) (*grpc.ClientConn, error) {
+	p.mu.RLock()
+	conn, ok := p.conns[addr]
+	p.mu.RUnlock()
+	if ok {
+		return conn, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.conns[addr]; ok {
+		return conn, nil
+	}
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{})),
+	}, p.DialOptions...)
+	conn, err := grpc.NewClient("passthrough:///"+addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[addr] = conn
+	return conn, nil
+}
+
+// outgoingMD 复制客户端的 metadata，去掉伪头部，追加客户端地址，没有请求ID时生成一个
+func outgoingMD(ctx context.Context, client string) metadata.MD {
+	in, _ := metadata.FromIncomingContext(ctx)
+	md := make(metadata.MD, len(in)+2)
+	for k, v := range in {
+		if strings.HasPrefix(k, ":") {
+			continue
+		}
+		md[k] = append([]string(nil), v...)
+	}
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		md.Append("x-forwarded-for", host)
+	}
+	key := strings.ToLower(request_id.Header)
+	if len(md.Get(key)) == 0 {
+		md.Set(key, request_id.New())
+	}
+	return md
+}
+
+func forwardToUpstream(src grpc.ServerStream, dst grpc.ClientStream) error {
+	for {
+		frame := &Frame{}
+		if err := src.RecvMsg(frame); err != nil {
+			return err
+		}
+		// 下游已经结束时返回 io.EOF，真正的错误由 RecvMsg 返回
+		if err := dst.SendMsg(frame); err != nil {
+			return err
+		}
+	}
+}
+
+func forwardToClient(src grpc.ClientStream, dst grpc.ServerStream) error {
+	for i := 0; ; i++ {
+		frame := &Frame{}
+		err := src.RecvMsg(frame)
+		if i == 0 {
+			// 下游的 header 在第一条消息之前到达，出错时可能为空
+			if md, headerErr := src.Header(); headerErr == nil && len(md) > 0 {
+				if sendErr := dst.SendHeader(md); sendErr != nil {
+					return sendErr
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := dst.SendMsg(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// upstreamError 把调用下游的错误转换为返回给客户端的 gRPC 状态：
+// 下游返回的状态码原样透传，连接失败等为 Unavailable，超时为 DeadlineExceeded
+func upstreamError(addr, method string, err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		s = status.FromContextError(err)
+		if s.Code() == codes.Unknown {
+			s = status.New(codes.Unavailable, err.Error())
+		}
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.Internal, codes.Unknown:
+		log.Printf("grpc_proxy: upstream %s %s failed: %v", addr, method, s.Message())
+	}
+	return s.Err()
+}
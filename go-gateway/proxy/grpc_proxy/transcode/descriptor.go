@@ -0,0 +1,62 @@
+package transcode
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"os"
+	"strings"
+)
+
+// Resolver 按全名查找 protobuf 描述符，*protoregistry.Files 实现了该接口
+type Resolver interface {
+	FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// GlobalFiles 编译进网关的 .pb.go 在 init 时注册的描述符，引入生成代码的包即可使用：
+//
+//	import _ "sen-golang-study/golang/148_net/04_rpc/demo_product/protobufs/compiles"
+var GlobalFiles Resolver = protoregistry.GlobalFiles
+
+// LoadDescriptorSet 读取 protoc 生成的描述符集合文件，依赖的文件需要一起打包：
+//
+//	protoc --include_imports --descriptor_set_out=product.pb product.proto
+func LoadDescriptorSet(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("transcode: parse descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("transcode: load descriptor set %s: %w", path, err)
+	}
+	return files, nil
+}
+
+// findMethod 按 gRPC 完整方法名 /package.Service/Method 查找方法描述符
+func findMethod(resolver Resolver, fullMethod string) (protoreflect.MethodDescriptor, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok || service == "" || method == "" || !strings.HasPrefix(fullMethod, "/") {
+		return nil, fmt.Errorf("transcode: invalid grpc method %q", fullMethod)
+	}
+	desc, err := resolver.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("transcode: service %s not found: %w", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("transcode: %s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("transcode: method %s not found in service %s", method, service)
+	}
+	return md, nil
+}
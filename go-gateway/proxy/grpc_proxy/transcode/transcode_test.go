@@ -0,0 +1,163 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sen-golang-study/golang/148_net/04_rpc/demo_product/protobufs/compiles"
+	"strings"
+	"testing"
+)
+
+// productServer 测试用的产品服务，id 为 0 时返回 NotFound
+type productServer struct {
+	compiles.UnimplementedProductServer
+}
+
+func (productServer) ProductInfo(ctx context.Context, req *compiles.ProductRequest) (*compiles.ProductResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs("x-user", strings.Join(md.Get("x-user"), ","), "x-request-id", strings.Join(md.Get("x-request-id"), ",")))
+	if req.Id == 0 {
+		return nil, status.Error(codes.NotFound, "no such product")
+	}
+	return &compiles.ProductResponse{Id: req.Id, Name: "gRPC Product Demo", IsSale: req.Id%2 == 1}, nil
+}
+
+// newTranscoder 启动产品服务，返回连接它的转换器
+func newTranscoder(t *testing.T, resolver Resolver) *Transcoder {
+	server := grpc.NewServer()
+	compiles.RegisterProductServer(server, productServer{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewTranscoder(resolver, cc)
+}
+
+func do(t *testing.T, h http.Handler, method, target, body string) (*httptest.ResponseRecorder, map[string]any) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Grpc-Metadata-X-User", "alice")
+	req.Header.Set("X-Request-Id", "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%s %s: invalid json %q", method, target, rec.Body)
+	}
+	return rec, got
+}
+
+// TestTranscode 测试路径参数、查询参数、请求体映射到请求字段，gRPC 状态码映射到 HTTP 状态码
+func TestTranscode(t *testing.T) {
+	tc := newTranscoder(t, GlobalFiles)
+	for _, rule := range []Rule{
+		{Method: http.MethodGet, Pattern: "/products/{id}", GRPCMethod: "/Product/ProductInfo"},
+		{Method: http.MethodGet, Pattern: "/products", GRPCMethod: "/Product/ProductInfo"},
+		{Method: http.MethodPost, Pattern: "/products:lookup", GRPCMethod: "/Product/ProductInfo", Body: "*"},
+	} {
+		if err := tc.Handle(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec, got := do(t, tc, http.MethodGet, "/products/7", "")
+	if rec.Code != http.StatusOK || got["id"] != "7" || got["name"] != "gRPC Product Demo" || got["is_sale"] != true {
+		t.Errorf("unexpected response %d %v", rec.Code, got)
+	}
+	if rec.Header().Get("Grpc-Metadata-X-User") != "alice" || rec.Header().Get("Grpc-Metadata-X-Request-Id") != "req-1" {
+		t.Errorf("want metadata forwarded, got %v", rec.Header())
+	}
+	// 零值字段也输出
+	if rec, got = do(t, tc, http.MethodGet, "/products?id=8", ""); rec.Code != http.StatusOK || got["is_sale"] != false {
+		t.Errorf("unexpected response %d %v", rec.Code, got)
+	}
+	if rec, got = do(t, tc, http.MethodPost, "/products:lookup", `{"id": "9"}`); rec.Code != http.StatusOK || got["id"] != "9" {
+		t.Errorf("unexpected response %d %v", rec.Code, got)
+	}
+
+	for _, c := range []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, "/products/0", "", http.StatusNotFound},
+		{http.MethodGet, "/products/abc", "", http.StatusBadRequest},
+		{http.MethodGet, "/products?size=1", "", http.StatusBadRequest},
+		{http.MethodPost, "/products:lookup", `{"id":`, http.StatusBadRequest},
+	} {
+		rec, got := do(t, tc, c.method, c.target, c.body)
+		if rec.Code != c.status || got["message"] == "" || got["request_id"] != "req-1" {
+			t.Errorf("%s %s: want %d, got %d %v", c.method, c.target, c.status, rec.Code, got)
+		}
+	}
+}
+
+// TestDescriptorSet 测试从描述符集合文件加载，以及无效的路由配置
+func TestDescriptorSet(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(compiles.File_product_proto),
+	}}
+	data, _ := proto.Marshal(set)
+	path := filepath.Join(t.TempDir(), "product.pb")
+	os.WriteFile(path, data, 0o644)
+	files, err := LoadDescriptorSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := newTranscoder(t, files)
+	if err := tc.Handle(Rule{Method: http.MethodGet, Pattern: "/v2/products/{id}", GRPCMethod: "/Product/ProductInfo"}); err != nil {
+		t.Fatal(err)
+	}
+	if rec, got := do(t, tc, http.MethodGet, "/v2/products/3", ""); rec.Code != http.StatusOK || got["id"] != "3" {
+		t.Errorf("unexpected response %d %v", rec.Code, got)
+	}
+
+	for _, rule := range []Rule{
+		{Pattern: "/a", GRPCMethod: "/Product/Missing"},
+		{Pattern: "/b", GRPCMethod: "/Missing/ProductInfo"},
+		{Pattern: "/c/{sku}", GRPCMethod: "/Product/ProductInfo"},
+		{Pattern: "/d", GRPCMethod: "/Product/ProductInfo", Body: "id"},
+		{Method: http.MethodGet, Pattern: "/v2/products/{id}", GRPCMethod: "/Product/ProductInfo"},
+	} {
+		if err := tc.Handle(rule); err == nil {
+			t.Errorf("want %+v rejected", rule)
+		}
+	}
+}
+
+// TestHTTPStatus 测试常用状态码的映射
+func TestHTTPStatus(t *testing.T) {
+	for code, want := range map[codes.Code]int{
+		codes.OK:                http.StatusOK,
+		codes.InvalidArgument:   http.StatusBadRequest,
+		codes.Unauthenticated:   http.StatusUnauthorized,
+		codes.PermissionDenied:  http.StatusForbidden,
+		codes.ResourceExhausted: http.StatusTooManyRequests,
+		codes.Unavailable:       http.StatusServiceUnavailable,
+		codes.DeadlineExceeded:  http.StatusGatewayTimeout,
+		codes.DataLoss:          http.StatusInternalServerError,
+	} {
+		if got := HTTPStatus(code); got != want {
+			t.Errorf("%s: want %d, got %d", code, want, got)
+		}
+	}
+}
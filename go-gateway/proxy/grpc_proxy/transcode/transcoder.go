@@ -0,0 +1,275 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sen-golang-study/go-gateway/middleware/request_id"
+	"strings"
+	"time"
+)
+
+// MetadataHeaderPrefix 以此为前缀的请求头去掉前缀后作为 gRPC metadata 传给下游，下游返回的 header 也以此为前缀写入响应头
+const MetadataHeaderPrefix = "Grpc-Metadata-"
+
+// forwardHeaders 原样作为 metadata 传给下游的请求头
+var forwardHeaders = []string{"Authorization", request_id.Header, "Traceparent", "Tracestate"}
+
+// Rule 一条 REST 路由到 gRPC 方法的映射
+//
+//	Rule{Method: "GET", Pattern: "/products/{id}", GRPCMethod: "/Product/ProductInfo"}
+//
+// 请求消息按以下顺序填充，后填充的覆盖先填充的：
+//  1. 请求体：Body 为 "*" 时整个 JSON 请求体映射到请求消息，为字段名时映射到该字段，为空时忽略请求体
+//  2. 查询参数：参数名为字段路径（如 page.size），重复字段可以出现多次；未知的参数返回 400
+//  3. 路径参数：{name} 为请求消息的顶层字段名
+type Rule struct {
+	Method     string
+	Pattern    string
+	GRPCMethod string
+	Body       string
+	Timeout    time.Duration // 调用超时时间，为 0 时使用 Transcoder.Timeout
+}
+
+// Transcoder 把 HTTP/JSON 请求转换为 gRPC 调用，调用结果转换为 JSON 响应，实现 http.Handler
+//
+// 请求和响应消息使用 dynamicpb 按描述符动态构造，网关不需要下游服务的生成代码，只需要描述符
+type Transcoder struct {
+	Timeout time.Duration // 默认调用超时时间
+	// MarshalOptions 响应消息的 JSON 编码选项，默认使用 proto 字段名并输出零值字段
+	MarshalOptions protojson.MarshalOptions
+
+	resolver Resolver
+	conn     grpc.ClientConnInterface
+	mux      *http.ServeMux
+}
+
+// NewTranscoder 新建转换器，resolver 提供描述符，conn 为下游服务或 gRPC 代理的连接
+func NewTranscoder(resolver Resolver, conn grpc.ClientConnInterface) *Transcoder {
+	return &Transcoder{
+		Timeout:        10 * time.Second,
+		MarshalOptions: protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+		resolver:       resolver,
+		conn:           conn,
+		mux:            http.NewServeMux(),
+	}
+}
+
+var wildcardRE = regexp.MustCompile(`\{([^}]*)\}`)
+
+// Handle 添加路由，方法不存在、不是一元调用或引用了不存在的字段时返回错误
+func (t *Transcoder) Handle(rule Rule) (err error) {
+	md, err := findMethod(t.resolver, rule.GRPCMethod)
+	if err != nil {
+		return err
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return fmt.Errorf("transcode: %s is a streaming method, only unary methods can be transcoded", rule.GRPCMethod)
+	}
+	input := md.Input()
+	var pathFields []string
+	for _, m := range wildcardRE.FindAllStringSubmatch(rule.Pattern, -1) {
+		name := strings.TrimSuffix(m[1], "...")
+		fields, err := findField(input, name)
+		if err != nil || len(fields) != 1 {
+			return fmt.Errorf("transcode: path parameter {%s} of %s: not a top-level field of %s", m[1], rule.Pattern, input.FullName())
+		}
+		pathFields = append(pathFields, name)
+	}
+	if rule.Body != "" && rule.Body != "*" {
+		fields, err := findField(input, rule.Body)
+		if err != nil || len(fields) != 1 || fields[0].Kind() != protoreflect.MessageKind || fields[0].IsList() || fields[0].IsMap() {
+			return fmt.Errorf("transcode: body %q of %s: not a top-level message field of %s", rule.Body, rule.Pattern, input.FullName())
+		}
+	}
+
+	route := &route{transcoder: t, rule: rule, method: md, pathFields: pathFields}
+	pattern := rule.Pattern
+	if rule.Method != "" {
+		pattern = rule.Method + " " + pattern
+	}
+	// ServeMux 注册冲突的路由时会 panic，转换为错误返回
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("transcode: %v", r)
+		}
+	}()
+	t.mux.Handle(pattern, route)
+	return nil
+}
+
+func (t *Transcoder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	t.mux.ServeHTTP(w, req)
+}
+
+type route struct {
+	transcoder *Transcoder
+	rule       Rule
+	method     protoreflect.MethodDescriptor
+	pathFields []string
+}
+
+func (r *route) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	in := dynamicpb.NewMessage(r.method.Input())
+	if err := r.decode(req, in); err != nil {
+		writeError(w, req, status.New(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	timeout := r.rule.Timeout
+	if timeout == 0 {
+		timeout = r.transcoder.Timeout
+	}
+	ctx := metadata.NewOutgoingContext(req.Context(), outgoingMD(req))
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	out := dynamicpb.NewMessage(r.method.Output())
+	var header, trailer metadata.MD
+	err := r.transcoder.conn.Invoke(ctx, r.rule.GRPCMethod, in, out, grpc.Header(&header), grpc.Trailer(&trailer))
+	writeMetadata(w.Header(), header)
+	writeMetadata(w.Header(), trailer)
+	if err != nil {
+		s, ok := status.FromError(err)
+		if !ok {
+			s = status.FromContextError(err)
+		}
+		writeError(w, req, s)
+		return
+	}
+	data, err := r.transcoder.MarshalOptions.Marshal(out)
+	if err != nil {
+		writeError(w, req, status.New(codes.Internal, err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// decode 按请求体、查询参数、路径参数的顺序填充请求消息
+func (r *route) decode(req *http.Request, in *dynamicpb.Message) error {
+	if r.rule.Body != "" {
+		body, err := io.ReadAll(io.LimitReader(req.Body, 4<<20))
+		if err != nil {
+			return err
+		}
+		if len(body) > 0 {
+			target := protoreflect.Message(in)
+			if r.rule.Body != "*" {
+				target = in.Mutable(in.Descriptor().Fields().ByName(protoreflect.Name(r.rule.Body))).Message()
+			}
+			if err := protojson.Unmarshal(body, target.Interface()); err != nil {
+				return fmt.Errorf("invalid request body: %v", err)
+			}
+		}
+	}
+	for key, values := range req.URL.Query() {
+		if r.rule.Body == "*" {
+			return fmt.Errorf("query parameter %q not allowed, fields are read from body", key)
+		}
+		if err := setField(in, key, values); err != nil {
+			return err
+		}
+	}
+	for _, name := range r.pathFields {
+		if err := setField(in, name, []string{req.PathValue(name)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outgoingMD 转发认证、请求ID、链路上下文请求头，以及以 Grpc-Metadata- 为前缀的请求头
+func outgoingMD(req *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for _, name := range forwardHeaders {
+		if values := req.Header.Values(name); len(values) > 0 {
+			md.Append(name, values...)
+		}
+	}
+	for name, values := range req.Header {
+		if key, ok := strings.CutPrefix(name, MetadataHeaderPrefix); ok && key != "" {
+			md.Append(key, values...)
+		}
+	}
+	if id := request_id.FromContext(req.Context()); id != "" {
+		md.Set(request_id.Header, id)
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		md.Append("x-forwarded-for", host)
+	}
+	return md
+}
+
+func writeMetadata(h http.Header, md metadata.MD) {
+	for key, values := range md {
+		// 二进制 metadata 和 gRPC 保留字段不写入响应头
+		if strings.HasSuffix(key, "-bin") || strings.HasPrefix(key, "grpc-") || strings.HasPrefix(key, ":") ||
+			key == "content-type" {
+			continue
+		}
+		for _, v := range values {
+			h.Add(MetadataHeaderPrefix+key, v)
+		}
+	}
+}
+
+// HTTPStatus gRPC 状态码对应的 HTTP 状态码
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // 客户端关闭连接，nginx 的约定
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorBody 调用失败时的 JSON 响应体
+type ErrorBody struct {
+	Code      int    `json:"code"`   // gRPC 状态码
+	Status    string `json:"status"` // gRPC 状态码名称
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, req *http.Request, s *status.Status) {
+	requestID := request_id.FromContext(req.Context())
+	if requestID == "" {
+		requestID = req.Header.Get(request_id.Header)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(HTTPStatus(s.Code()))
+	json.NewEncoder(w).Encode(ErrorBody{Code: int(s.Code()), Status: s.Code().String(), Message: s.Message(), RequestID: requestID})
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl 解析后的 Cache-Control 指令，指令名小写
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(directive, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds 返回秒数类型指令的值
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheableStatus 默认可缓存的状态码（RFC 9110 15.1）
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// entry 缓存条目，创建后不再修改，重新验证时生成新条目替换
+type entry struct {
+	key        string // 完整缓存键：主键 + Vary 请求头的取值
+	primaryKey string // 主键：下游URL（scheme+主机+请求URI），用于按键/前缀清除
+
+	status int
+	header http.Header
+	body   []byte
+
+	storedAt             time.Time
+	initialAge           time.Duration // 下游返回的 Age 头
+	lifetime             time.Duration // 新鲜期
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	mustRevalidate       bool // no-cache 或 must-revalidate：过期后必须重新验证
+}
+
+func (e *entry) size() int64 {
+	size := int64(len(e.key) + len(e.body))
+	for k, vv := range e.header {
+		size += int64(len(k))
+		for _, v := range vv {
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	return e.initialAge + now.Sub(e.storedAt)
+}
+
+func (e *entry) fresh(now time.Time) bool {
+	return e.age(now) < e.lifetime
+}
+
+// withinStale 判断过期的时间是否在允许的窗口内
+func (e *entry) withinStale(now time.Time, window time.Duration) bool {
+	return !e.mustRevalidate && e.age(now) < e.lifetime+window
+}
+
+// response 用缓存条目构造响应
+func (e *entry) response(req *http.Request, now time.Time, status string) *http.Response {
+	header := e.header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	header.Set(StatusHeader, status)
+	res := &http.Response{
+		Status:        strconv.Itoa(e.status) + " " + http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+	if notModified(req, e.header) {
+		res.StatusCode = http.StatusNotModified
+		res.Status = "304 Not Modified"
+		res.Body = http.NoBody
+		res.ContentLength = 0
+		res.Header.Del("Content-Length")
+	}
+	return res
+}
+
+// notModified 客户端携带的条件请求与缓存的校验器匹配
+func notModified(req *http.Request, header http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" {
+		since, err1 := http.ParseTime(ims)
+		modified, err2 := http.ParseTime(header.Get("Last-Modified"))
+		return err1 == nil && err2 == nil && !modified.After(since)
+	}
+	return false
+}
+
+// hopHeaders 不能缓存的逐跳头
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// newEntry 根据下游响应创建缓存条目，不可缓存时返回 nil
+func newEntry(key, primaryKey string, req *http.Request, res *http.Response, now time.Time) *entry {
+	if !cacheableStatus[res.StatusCode] || res.Header.Get("Vary") == "*" {
+		return nil
+	}
+	resCC := parseCacheControl(res.Header)
+	// 带 Set-Cookie 的响应是针对单个用户的，不能共享
+	if resCC.has("no-store") || resCC.has("private") || res.Header.Get("Set-Cookie") != "" {
+		return nil
+	}
+	// 共享缓存不能缓存带认证信息的请求，除非下游明确允许
+	if req.Header.Get("Authorization") != "" &&
+		!resCC.has("public") && !resCC.has("s-maxage") && !resCC.has("must-revalidate") {
+		return nil
+	}
+
+	e := &entry{
+		key:            key,
+		primaryKey:     primaryKey,
+		status:         res.StatusCode,
+		header:         res.Header.Clone(),
+		storedAt:       now,
+		mustRevalidate: resCC.has("no-cache") || resCC.has("must-revalidate") || resCC.has("proxy-revalidate"),
+	}
+	for _, h := range hopHeaders {
+		e.header.Del(h)
+	}
+	e.header.Del(StatusHeader)
+	if age, err := strconv.ParseInt(res.Header.Get("Age"), 10, 64); err == nil && age > 0 {
+		e.initialAge = time.Duration(age) * time.Second
+	}
+
+	explicit := true
+	if d, ok := resCC.seconds("s-maxage"); ok {
+		e.lifetime = d
+	} else if d, ok := resCC.seconds("max-age"); ok {
+		e.lifetime = d
+	} else if expires := res.Header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		date, err2 := http.ParseTime(res.Header.Get("Date"))
+		if err2 != nil {
+			date = now
+		}
+		if err == nil && expiresAt.After(date) {
+			e.lifetime = expiresAt.Sub(date)
+		}
+	} else {
+		explicit = false
+	}
+	if resCC.has("no-cache") {
+		e.lifetime = 0
+	}
+	// 没有新鲜期，也没有可用于重新验证的校验器，缓存没有意义
+	if !explicit && res.Header.Get("ETag") == "" && res.Header.Get("Last-Modified") == "" {
+		return nil
+	}
+	e.staleWhileRevalidate, _ = resCC.seconds("stale-while-revalidate")
+	e.staleIfError, _ = resCC.seconds("stale-if-error")
+	return e
+}
+
+// refreshed 下游返回 304 后，用新响应头更新缓存条目的新鲜期
+func (e *entry) refreshed(req *http.Request, res *http.Response, now time.Time) *entry {
+	merged := &http.Response{StatusCode: e.status, Header: e.header.Clone()}
+	for k, vv := range res.Header {
+		if k == "Content-Length" {
+			continue
+		}
+		merged.Header[k] = vv
+	}
+	next := newEntry(e.key, e.primaryKey, req, merged, now)
+	if next == nil {
+		return nil
+	}
+	next.body = e.body
+	return next
+}
+
+// varyKey 根据 Vary 头列出的请求头计算完整缓存键
+func varyKey(primaryKey string, vary []string, req *http.Request) string {
+	if len(vary) == 0 {
+		return primaryKey
+	}
+	var b strings.Builder
+	b.WriteString(primaryKey)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// parseVary 解析 Vary 头，返回规范化后的请求头名称
+func parseVary(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// lru 按字节数限制容量的LRU缓存，容量超出时淘汰最久未使用的条目
+type lru struct {
+	mu       sync.Mutex
+	maxBytes int64
+	curBytes int64
+	ll       *list.List               // 链表头部为最近使用的条目
+	items    map[string]*list.Element // 完整缓存键 -> 链表节点
+
+	// primaries 主键 -> 该主键下各个 Vary 变体的链表节点，清除时不必遍历整个链表
+	primaries map[string]map[*list.Element]struct{}
+}
+
+func newLRU(maxBytes int64) *lru {
+	return &lru{
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		items:     make(map[string]*list.Element),
+		primaries: make(map[string]map[*list.Element]struct{}),
+	}
+}
+
+func (c *lru) get(key string) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		return el.Value.(*entry), true
+	}
+	return nil, false
+}
+
+// add 添加或替换条目，单个条目超过容量时不缓存
+func (c *lru) add(e *entry) bool {
+	size := e.size()
+	if size > c.maxBytes {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[e.key]; ok {
+		c.curBytes -= el.Value.(*entry).size()
+		el.Value = e
+		c.ll.MoveToFront(el)
+	} else {
+		el := c.ll.PushFront(e)
+		c.items[e.key] = el
+		variants := c.primaries[e.primaryKey]
+		if variants == nil {
+			variants = make(map[*list.Element]struct{})
+			c.primaries[e.primaryKey] = variants
+		}
+		variants[el] = struct{}{}
+	}
+	c.curBytes += size
+	for c.curBytes > c.maxBytes {
+		c.removeElement(c.ll.Back())
+	}
+	return true
+}
+
+// removePrimary 删除主键下的所有条目，返回删除的条目数
+func (c *lru) removePrimary(primaryKey string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.removeVariants(primaryKey)
+}
+
+// removePrefix 删除主键以 prefix 开头的所有条目，只遍历主键，返回删除的条目数
+func (c *lru) removePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for primaryKey := range c.primaries {
+		if strings.HasPrefix(primaryKey, prefix) {
+			removed += c.removeVariants(primaryKey)
+		}
+	}
+	return removed
+}
+
+func (c *lru) removeVariants(primaryKey string) int {
+	variants := c.primaries[primaryKey]
+	removed := len(variants)
+	for el := range variants {
+		c.removeElement(el)
+	}
+	return removed
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	if variants := c.primaries[e.primaryKey]; variants != nil {
+		delete(variants, el)
+		if len(variants) == 0 {
+			delete(c.primaries, e.primaryKey)
+		}
+	}
+	c.curBytes -= e.size()
+}
+
+// stats 返回条目数和占用字节数
+func (c *lru) stats() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len(), c.curBytes
+}
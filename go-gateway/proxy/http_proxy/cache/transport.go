@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusHeader 缓存状态响应头
+const StatusHeader = "X-Cache"
+
+// 缓存状态
+const (
+	StatusHit         = "HIT"         // 命中新鲜的缓存
+	StatusMiss        = "MISS"        // 未命中，请求了下游
+	StatusStale       = "STALE"       // 返回了过期缓存（stale-while-revalidate / stale-if-error）
+	StatusRevalidated = "REVALIDATED" // 缓存过期，下游确认未修改（304）
+	StatusBypass      = "BYPASS"      // 不走缓存的请求
+)
+
+// revalidateTimeout 后台重新验证请求的超时时间
+const revalidateTimeout = 30 * time.Second
+
+// Transport 缓存 http.RoundTripper，作为 httputil.ReverseProxy 的 Transport 使用
+//
+// 缓存规则：
+//  1. 只缓存 GET 请求，遵循 Cache-Control、Expires、Vary
+//  2. 过期后带 If-None-Match / If-Modified-Since 向下游重新验证
+//  3. stale-while-revalidate：在窗口内直接返回过期缓存，后台重新验证
+//  4. stale-if-error：在窗口内下游出错或返回 5xx 时返回过期缓存
+//  5. 同一缓存键同时只有一个请求发往下游，其余请求等待并共享结果
+type Transport struct {
+	Base         http.RoundTripper // 实际发送请求的 Transport，为空时使用 http.DefaultTransport
+	MaxEntrySize int64             // 单个响应体可缓存的最大字节数
+
+	store *lru
+	now   func() time.Time
+
+	varyMu sync.RWMutex
+	vary   map[string][]string // 主键 -> 下游 Vary 头列出的请求头
+
+	flightMu sync.Mutex
+	flights  map[string]*flight // 完整缓存键 -> 正在进行的下游请求
+}
+
+// flight 正在进行的下游请求，等待者共享其缓存结果
+type flight struct {
+	done   chan struct{}
+	entry  *entry
+	status string
+}
+
+// NewTransport 新建缓存 Transport，maxBytes 为缓存占用的最大字节数
+func NewTransport(base http.RoundTripper, maxBytes int64) *Transport {
+	return &Transport{
+		Base:         base,
+		MaxEntrySize: maxBytes / 8,
+		store:        newLRU(maxBytes),
+		now:          time.Now,
+		vary:         make(map[string][]string),
+		flights:      make(map[string]*flight),
+	}
+}
+
+// Purge 清除指定下游URL的所有缓存变体，返回清除的条目数
+//
+// 缓存键是 Director 改写之后发往下游的完整URL，包含下游地址和合并进来的目标查询参数，
+// 如客户端请求 /realserver?id=1 对应 http://127.0.0.1:8001/realserver/?a=1&b=2&id=1
+func (t *Transport) Purge(key string) int {
+	t.setVaryNames(key, nil)
+	return t.store.removePrimary(key)
+}
+
+// PurgePrefix 清除下游URL以 prefix 开头的所有缓存，如 http://127.0.0.1:8001/realserver，返回清除的条目数
+func (t *Transport) PurgePrefix(prefix string) int {
+	t.varyMu.Lock()
+	for primary := range t.vary {
+		if strings.HasPrefix(primary, prefix) {
+			delete(t.vary, primary)
+		}
+	}
+	t.varyMu.Unlock()
+	return t.store.removePrefix(prefix)
+}
+
+// Stats 返回缓存的条目数与占用字节数
+func (t *Transport) Stats() (entries int, bytes int64) {
+	return t.store.stats()
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	primary := cacheKey(req)
+	if req.Method != http.MethodGet {
+		res, err := t.base().RoundTrip(req)
+		// 非安全方法修改成功后，对应资源的缓存失效
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && res.StatusCode < 400 {
+			t.store.removePrimary(primary)
+		}
+		return res, err
+	}
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") {
+		return t.bypass(req)
+	}
+
+	key := varyKey(primary, t.varyNames(primary), req)
+	now := t.now()
+	cached, ok := t.store.get(key)
+	if !ok {
+		return t.fetch(req, key, primary, nil)
+	}
+	maxAge, hasMaxAge := reqCC.seconds("max-age")
+	forceRevalidate := reqCC.has("no-cache") || (hasMaxAge && cached.age(now) >= maxAge)
+	if forceRevalidate {
+		return t.fetch(req, key, primary, cached)
+	}
+	if cached.fresh(now) {
+		return cached.response(req, now, StatusHit), nil
+	}
+	if cached.staleWhileRevalidate > 0 && cached.withinStale(now, cached.staleWhileRevalidate) {
+		go t.revalidate(req, key, primary, cached)
+		return cached.response(req, now, StatusStale), nil
+	}
+	return t.fetch(req, key, primary, cached)
+}
+
+// cacheKey 缓存主键：下游的 scheme、地址加请求URI，不同下游的同名路径不共享缓存
+func cacheKey(req *http.Request) string {
+	return req.URL.Scheme + "://" + req.URL.Host + req.URL.RequestURI()
+}
+
+func (t *Transport) bypass(req *http.Request) (*http.Response, error) {
+	res, err := t.base().RoundTrip(req)
+	if err == nil {
+		res.Header.Set(StatusHeader, StatusBypass)
+	}
+	return res, err
+}
+
+// revalidate 后台重新验证，与客户端请求的生命周期解绑
+func (t *Transport) revalidate(req *http.Request, key, primary string, cached *entry) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), revalidateTimeout)
+	defer cancel()
+	res, err := t.fetch(req.Clone(ctx), key, primary, cached)
+	if err == nil {
+		res.Body.Close()
+	}
+}
+
+// fetch 合并同一缓存键的并发请求，只有第一个请求发往下游
+func (t *Transport) fetch(req *http.Request, key, primary string, cached *entry) (*http.Response, error) {
+	t.flightMu.Lock()
+	if f, ok := t.flights[key]; ok {
+		t.flightMu.Unlock()
+		select {
+		case <-f.done:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		if f.entry != nil {
+			return f.entry.response(req, t.now(), f.status), nil
+		}
+		// 下游结果不可共享（不可缓存或出错），自己请求下游
+		res, _, _, err := t.fetchUpstream(req, primary, cached)
+		return res, err
+	}
+	f := &flight{done: make(chan struct{})}
+	t.flights[key] = f
+	t.flightMu.Unlock()
+
+	res, shared, status, err := t.fetchUpstream(req, primary, cached)
+	f.entry, f.status = shared, status
+	t.flightMu.Lock()
+	delete(t.flights, key)
+	t.flightMu.Unlock()
+	close(f.done)
+	return res, err
+}
+
+// fetchUpstream 请求下游并更新缓存，返回给当前请求的响应以及可与等待者共享的缓存条目
+func (t *Transport) fetchUpstream(req *http.Request, primary string, cached *entry) (*http.Response, *entry, string, error) {
+	out := req.Clone(req.Context())
+	// 客户端自己的条件请求由缓存应答，向下游请求完整响应或使用缓存的校验器
+	out.Header.Del("If-None-Match")
+	out.Header.Del("If-Modified-Since")
+	if cached != nil {
+		if etag := cached.header.Get("ETag"); etag != "" {
+			out.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.header.Get("Last-Modified"); lastModified != "" {
+			out.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	res, err := t.base().RoundTrip(out)
+	now := t.now()
+	if err != nil || res.StatusCode >= 500 {
+		if cached != nil && cached.staleIfError > 0 && cached.withinStale(now, cached.staleIfError) {
+			if res != nil {
+				res.Body.Close()
+			}
+			return cached.response(req, now, StatusStale), cached, StatusStale, nil
+		}
+		if err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		res.Body.Close()
+		e := cached.refreshed(out, res, now)
+		if e == nil {
+			t.store.removePrimary(primary)
+			return cached.response(req, now, StatusRevalidated), nil, "", nil
+		}
+		t.store.add(e)
+		return e.response(req, now, StatusRevalidated), e, StatusRevalidated, nil
+	}
+
+	vary := parseVary(res.Header)
+	t.setVaryNames(primary, vary)
+	e := newEntry(varyKey(primary, vary, req), primary, req, res, now)
+	if e == nil || res.ContentLength > t.MaxEntrySize {
+		res.Header.Set(StatusHeader, StatusMiss)
+		return res, nil, "", nil
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, t.MaxEntrySize+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, nil, "", err
+	}
+	if int64(len(body)) > t.MaxEntrySize {
+		// 响应体过大，已读取的部分拼接剩余部分继续流式返回
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		res.Header.Set(StatusHeader, StatusMiss)
+		return res, nil, "", nil
+	}
+	res.Body.Close()
+	e.body = body
+	t.store.add(e)
+	return e.response(req, now, StatusMiss), e, StatusMiss, nil
+}
+
+func (t *Transport) varyNames(primary string) []string {
+	t.varyMu.RLock()
+	defer t.varyMu.RUnlock()
+	return t.vary[primary]
+}
+
+func (t *Transport) setVaryNames(primary string, names []string) {
+	t.varyMu.Lock()
+	defer t.varyMu.Unlock()
+	if len(names) == 0 {
+		delete(t.vary, primary)
+		return
+	}
+	t.vary[primary] = names
+}
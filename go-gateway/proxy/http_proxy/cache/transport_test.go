@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripFunc 用函数模拟下游
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func get(t *testing.T, transport http.RoundTripper, target string, header http.Header) (*http.Response, string) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, vv := range header {
+		req.Header[k] = vv
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip failed: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return res, string(body)
+}
+
+// TestTransport_HitAndRevalidate 测试缓存命中，以及过期后用 ETag 重新验证
+func TestTransport_HitAndRevalidate(t *testing.T) {
+	var calls, conditional atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	now := time.Now()
+	transport := NewTransport(http.DefaultTransport, 1<<20)
+	transport.now = func() time.Time { return now }
+
+	if res, body := get(t, transport, upstream.URL+"/a", nil); res.Header.Get(StatusHeader) != StatusMiss || body != "hello" {
+		t.Fatalf("first request got %s %q", res.Header.Get(StatusHeader), body)
+	}
+	if res, body := get(t, transport, upstream.URL+"/a", nil); res.Header.Get(StatusHeader) != StatusHit || body != "hello" {
+		t.Fatalf("second request got %s %q", res.Header.Get(StatusHeader), body)
+	}
+	if res, _ := get(t, transport, upstream.URL+"/a", http.Header{"If-None-Match": {`"v1"`}}); res.StatusCode != http.StatusNotModified {
+		t.Errorf("client conditional request got %d, want 304", res.StatusCode)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if res, body := get(t, transport, upstream.URL+"/a", nil); res.Header.Get(StatusHeader) != StatusRevalidated || body != "hello" {
+		t.Fatalf("expired request got %s %q", res.Header.Get(StatusHeader), body)
+	}
+	if calls.Load() != 2 || conditional.Load() != 1 {
+		t.Errorf("upstream calls %d, conditional %d", calls.Load(), conditional.Load())
+	}
+}
+
+// TestTransport_Vary 测试按 Vary 头区分缓存变体
+func TestTransport_Vary(t *testing.T) {
+	var calls atomic.Int32
+	transport := NewTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", "max-age=60")
+		rec.Header().Set("Vary", "Accept-Language")
+		rec.Write([]byte(req.Header.Get("Accept-Language")))
+		return rec.Result(), nil
+	}), 1<<20)
+
+	for _, lang := range []string{"zh", "en", "zh", "en"} {
+		if _, body := get(t, transport, "http://gateway/v", http.Header{"Accept-Language": {lang}}); body != lang {
+			t.Errorf("got %q, want %q", body, lang)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("want 2 upstream calls, got %d", calls.Load())
+	}
+	if removed := transport.PurgePrefix("http://gateway/v"); removed != 2 {
+		t.Errorf("want 2 entries purged, got %d", removed)
+	}
+}
+
+// TestTransport_Hosts 测试不同下游的同名路径分别缓存
+func TestTransport_Hosts(t *testing.T) {
+	transport := NewTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", "max-age=60")
+		rec.Write([]byte(req.URL.Host))
+		return rec.Result(), nil
+	}), 1<<20)
+
+	for _, host := range []string{"a", "b", "a"} {
+		if _, body := get(t, transport, "http://"+host+"/p?id=1", nil); body != host {
+			t.Errorf("got %q, want %q", body, host)
+		}
+	}
+	if transport.Purge("http://a/p?id=1") != 1 || transport.Purge("/p?id=1") != 0 {
+		t.Errorf("want purge by upstream URL")
+	}
+}
+
+// TestTransport_Coalescing 测试并发未命中只发送一次下游请求
+func TestTransport_Coalescing(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	transport := NewTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		<-release
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", "max-age=60")
+		rec.Write([]byte("shared"))
+		return rec.Result(), nil
+	}), 1<<20)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, body := get(t, transport, "http://gateway/hot", nil); body != "shared" {
+				t.Errorf("got %q", body)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("want 1 upstream call, got %d", calls.Load())
+	}
+}
+
+// TestTransport_StaleIfError 测试下游出错时返回过期缓存
+func TestTransport_StaleIfError(t *testing.T) {
+	fail := false
+	transport := NewTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Cache-Control", "max-age=1, stale-if-error=60")
+		rec.Write([]byte("old"))
+		return rec.Result(), nil
+	}), 1<<20)
+	now := time.Now()
+	transport.now = func() time.Time { return now }
+
+	get(t, transport, "http://gateway/s", nil)
+	fail = true
+	now = now.Add(10 * time.Second)
+	if res, body := get(t, transport, "http://gateway/s", nil); res.Header.Get(StatusHeader) != StatusStale || body != "old" {
+		t.Errorf("got %s %q", res.Header.Get(StatusHeader), body)
+	}
+	if transport.Purge("http://gateway/s") != 1 {
+		t.Errorf("purge failed")
+	}
+}
+
+// TestLRU_Primaries 测试淘汰、替换和清除时主键索引保持一致
+func TestLRU_Primaries(t *testing.T) {
+	newEntry := func(key, primaryKey string) *entry {
+		return &entry{key: key, primaryKey: primaryKey, body: make([]byte, 100)}
+	}
+	c := newLRU(newEntry("a|zh", "a").size() * 3)
+	c.add(newEntry("a|zh", "a"))
+	c.add(newEntry("a|en", "a"))
+	c.add(newEntry("a|en", "a"))
+	c.add(newEntry("b", "b"))
+	c.add(newEntry("c", "c")) // 淘汰 a|zh
+
+	if len(c.primaries["a"]) != 1 || len(c.primaries) != 3 {
+		t.Errorf("unexpected index after eviction %v", c.primaries)
+	}
+	if removed := c.removePrimary("a"); removed != 1 {
+		t.Errorf("want 1 entry removed, got %d", removed)
+	}
+	if removed := c.removePrefix("b"); removed != 1 {
+		t.Errorf("want 1 entry removed, got %d", removed)
+	}
+	if n, _ := c.stats(); n != 1 || len(c.primaries) != 1 || len(c.items) != 1 {
+		t.Errorf("want only c left, got %d entries, index %v", n, c.primaries)
+	}
+}
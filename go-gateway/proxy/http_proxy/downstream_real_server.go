@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"sen-golang-study/go-gateway/load_balance/service_discovery/zookeeper"
+	"sen-golang-study/go-gateway/proxy/http_proxy/h2"
 	"syscall"
 	"time"
 )
@@ -52,7 +53,7 @@ func (r *RealServer) Run() {
 	mux.HandleFunc("/realserver/error", r.ErrorHandler)
 	server := &http.Server{
 		Addr:         r.Addr,
-		Handler:      mux,
+		Handler:      h2.Handler(mux), // 同时接受 HTTP/1.1 和 h2c，网关以 HTTP/2 prior knowledge 访问
 		WriteTimeout: time.Second * 3,
 	}
 	// 以新的协程的方式启动服务
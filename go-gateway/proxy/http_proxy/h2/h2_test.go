@@ -0,0 +1,143 @@
+package h2
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// h2cClient 以 prior knowledge 方式发送明文 HTTP/2 请求的客户端
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// TestH2CEndToEnd 测试客户端 h2c -> 网关 -> 下游 h2c 全程 HTTP/2，响应流式转发并保留 trailer
+func TestH2CEndToEnd(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Header().Set("X-Upstream-Proto", r.Proto)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "first")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprintln(w, "second")
+		w.Header().Set("Grpc-Status", "0")
+	})))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+
+	transport := NewTransport(nil)
+	transport.SetProtocol(target.Host, ProtocolH2C)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	gateway := httptest.NewUnstartedServer(nil)
+	gateway.Config = NewServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Gateway-Proto", r.Proto)
+		proxy.ServeHTTP(w, r)
+	}))
+	gateway.Start()
+	defer gateway.Close()
+
+	res, err := h2cClient().Get(gateway.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("X-Gateway-Proto") != "HTTP/2.0" || res.Header.Get("X-Upstream-Proto") != "HTTP/2.0" {
+		t.Fatalf("want HTTP/2 end to end, got %v", res.Header)
+	}
+	// 下游还没写完时客户端已经能读到第一段
+	reader := bufio.NewReader(res.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "first\n" {
+		t.Fatalf("want first chunk streamed, got %q %v", line, err)
+	}
+	close(release)
+	if line, _ := reader.ReadString('\n'); line != "second\n" {
+		t.Fatalf("want second chunk, got %q", line)
+	}
+	reader.ReadString('\n')
+	if got := res.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("want trailer forwarded, got %v", res.Trailer)
+	}
+
+	// 普通 HTTP/1.1 客户端仍然可以访问
+	res1, err := http.Get(gateway.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res1.Body.Close()
+	if res1.Header.Get("X-Gateway-Proto") != "HTTP/1.1" || res1.Header.Get("X-Upstream-Proto") != "HTTP/2.0" {
+		t.Errorf("want HTTP/1.1 client proxied over h2c, got %v", res1.Header)
+	}
+}
+
+// TestProtocolSelection 测试按下游选择协议
+func TestProtocolSelection(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	transport := NewTransport(&http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}})
+	host := strings.TrimPrefix(upstream.URL, "https://")
+	get := func(rawURL string) (string, error) {
+		req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		return res.Proto, nil
+	}
+
+	for _, tc := range []struct {
+		protocol Protocol
+		want     string
+	}{
+		{ProtocolAuto, "HTTP/2.0"},
+		{ProtocolH2, "HTTP/2.0"},
+		{ProtocolHTTP1, "HTTP/1.1"},
+	} {
+		transport.SetProtocol(host, tc.protocol)
+		if got, err := get(upstream.URL); err != nil || got != tc.want {
+			t.Errorf("%s: want %s, got %s %v", tc.protocol, tc.want, got, err)
+		}
+	}
+
+	// 只支持 HTTP/1.1 的明文下游配置为 h2c 时请求失败
+	transport.SetProtocol(strings.TrimPrefix(plain.URL, "http://"), ProtocolH2C)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, plain.URL, nil)
+	if res, err := transport.RoundTrip(req); err == nil {
+		res.Body.Close()
+		t.Error("want h2c to HTTP/1.1 only upstream failed")
+	}
+
+	if _, err := ParseProtocol("h3"); err == nil {
+		t.Error("want unknown protocol rejected")
+	}
+	if p, _ := ParseProtocol(""); p != ProtocolAuto {
+		t.Errorf("want auto, got %s", p)
+	}
+}
@@ -0,0 +1,39 @@
+package h2
+
+import (
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net/http"
+	"time"
+)
+
+// NewServer 新建同时支持 HTTP/1.1 和 HTTP/2 的服务器
+//
+//   - ListenAndServeTLS：通过 ALPN 协商 h2 或 http/1.1
+//   - ListenAndServe：明文连接同时接受 HTTP/1.1、h2c prior knowledge 和 Upgrade: h2c
+//
+// 不设置 WriteTimeout，否则 gRPC 流、SSE 等长时间的流式响应会被中断
+func NewServer(addr string, handler http.Handler) *http.Server {
+	h2s := newHTTP2Server()
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h2c.NewHandler(handler, h2s),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	// 显式配置 HTTP/2，设置 TLSNextProto 等字段后标准库不会再自动启用
+	_ = http2.ConfigureServer(srv, h2s)
+	return srv
+}
+
+// Handler 包装 handler，使普通的明文 http.Server 也能接受 h2c 请求
+func Handler(handler http.Handler) http.Handler {
+	return h2c.NewHandler(handler, newHTTP2Server())
+}
+
+func newHTTP2Server() *http2.Server {
+	return &http2.Server{
+		MaxConcurrentStreams: 250,
+		IdleTimeout:          2 * time.Minute,
+	}
+}
@@ -0,0 +1,173 @@
+package h2
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Protocol 与下游通信使用的协议
+type Protocol string
+
+const (
+	// ProtocolAuto https 下游通过 ALPN 协商 HTTP/2，不支持时降级为 HTTP/1.1；http 下游使用 HTTP/1.1
+	ProtocolAuto Protocol = "auto"
+	// ProtocolHTTP1 只使用 HTTP/1.1
+	ProtocolHTTP1 Protocol = "http1"
+	// ProtocolH2 只使用 HTTP/2 over TLS，下游不支持 HTTP/2 时请求失败
+	ProtocolH2 Protocol = "h2"
+	// ProtocolH2C 明文 HTTP/2，不经过 Upgrade 协商直接发送 HTTP/2 连接序言（prior knowledge），gRPC 下游一般使用这种方式
+	ProtocolH2C Protocol = "h2c"
+)
+
+// ParseProtocol 解析协议名，空字符串为 ProtocolAuto
+func ParseProtocol(s string) (Protocol, error) {
+	switch p := Protocol(s); p {
+	case "":
+		return ProtocolAuto, nil
+	case ProtocolAuto, ProtocolHTTP1, ProtocolH2, ProtocolH2C:
+		return p, nil
+	}
+	return "", fmt.Errorf("h2: unknown protocol %q", s)
+}
+
+// Transport 按下游地址选择协议的 http.RoundTripper，替换代理服务器最内层的 http.Transport
+//
+// 四种协议各自维护连接池：HTTP/1.1 每个连接同时只处理一个请求，HTTP/2 在一个连接上多路复用，
+// 连接空闲 ReadIdleTimeout 后发送 PING 探测，PingTimeout 内没有响应则关闭连接，避免请求发到已失效的连接上
+type Transport struct {
+	Auto  *http.Transport
+	HTTP1 *http.Transport
+	H2    *http2.Transport
+	H2C   *http2.Transport
+
+	mu        sync.RWMutex
+	protocols map[string]Protocol // 下游地址 -> 协议
+	fallback  Protocol
+}
+
+// NewTransport 以 base 的拨号、超时和 TLS 配置新建按下游选择协议的 Transport，base 为空时使用 http.DefaultTransport 的配置
+func NewTransport(base *http.Transport) *Transport {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	auto := base.Clone()
+	auto.ForceAttemptHTTP2 = true
+	// 已经配置过 HTTP/2 的 Transport，Clone 后需要重新配置
+	h2Auto, _ := http2.ConfigureTransports(auto)
+
+	http1 := base.Clone()
+	http1.ForceAttemptHTTP2 = false
+	// 非空的 TLSNextProto 禁用 HTTP/2
+	http1.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	if http1.TLSClientConfig != nil {
+		http1.TLSClientConfig.NextProtos = nil
+	}
+
+	dial := base.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t := &Transport{
+		Auto:  auto,
+		HTTP1: http1,
+		H2: &http2.Transport{
+			TLSClientConfig: base.TLSClientConfig.Clone(),
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return dialTLS(ctx, dial, network, addr, cfg)
+			},
+		},
+		H2C: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		},
+		protocols: make(map[string]Protocol),
+		fallback:  ProtocolAuto,
+	}
+	for _, h2t := range []*http2.Transport{h2Auto, t.H2, t.H2C} {
+		if h2t != nil {
+			h2t.ReadIdleTimeout = 30 * time.Second
+			h2t.PingTimeout = 15 * time.Second
+		}
+	}
+	return t
+}
+
+// SetProtocol 设置下游使用的协议，addr 为 host:port
+func (t *Transport) SetProtocol(addr string, protocol Protocol) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocols[addr] = protocol
+}
+
+// SetDefault 设置没有单独配置的下游使用的协议，默认为 ProtocolAuto
+func (t *Transport) SetDefault(protocol Protocol) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fallback = protocol
+}
+
+// Protocol 返回下游使用的协议
+func (t *Transport) Protocol(addr string) Protocol {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if p, ok := t.protocols[addr]; ok {
+		return p
+	}
+	return t.fallback
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch t.Protocol(req.URL.Host) {
+	case ProtocolHTTP1:
+		return t.HTTP1.RoundTrip(req)
+	case ProtocolH2:
+		if req.URL.Scheme != "https" {
+			return nil, fmt.Errorf("h2: upstream %s requires https, use h2c for cleartext HTTP/2", req.URL.Host)
+		}
+		return t.H2.RoundTrip(req)
+	case ProtocolH2C:
+		if req.URL.Scheme != "http" {
+			return nil, fmt.Errorf("h2: upstream %s uses h2c, scheme must be http", req.URL.Host)
+		}
+		return t.H2C.RoundTrip(req)
+	}
+	return t.Auto.RoundTrip(req)
+}
+
+// CloseIdleConnections 关闭所有协议的空闲连接
+func (t *Transport) CloseIdleConnections() {
+	t.Auto.CloseIdleConnections()
+	t.HTTP1.CloseIdleConnections()
+	t.H2.CloseIdleConnections()
+	t.H2C.CloseIdleConnections()
+}
+
+// dialTLS 使用 base 的拨号函数建立 TLS 连接，只协商 h2
+func dialTLS(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), network, addr string, cfg *tls.Config) (net.Conn, error) {
+	rawConn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	conn := tls.Client(rawConn, cfg)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		rawConn.Close()
+		return nil, err
+	}
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+		conn.Close()
+		return nil, fmt.Errorf("h2: upstream %s negotiated %q instead of h2", addr, proto)
+	}
+	return conn, nil
+}
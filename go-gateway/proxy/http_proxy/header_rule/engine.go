@@ -0,0 +1,182 @@
+package header_rule
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Op 请求头操作
+type Op string
+
+const (
+	OpSet    Op = "set"    // 设置请求头，覆盖原有值
+	OpAdd    Op = "add"    // 追加一个值
+	OpRemove Op = "remove" // 删除请求头
+	OpRename Op = "rename" // 重命名请求头，保留原有值
+)
+
+// Rule 一条请求头规则
+type Rule struct {
+	Op    Op
+	Name  string
+	Value string // set/add 的取值模板，见 Template
+	To    string // rename 的新名称
+}
+
+// Route 一个路由的请求头规则，按路径前缀匹配，最长前缀优先
+type Route struct {
+	Name     string
+	Prefix   string
+	Host     string // 非空时改写发往下游的 Host 请求头，支持模板，如 "${upstream}"
+	Request  []Rule // 发往下游前对请求头执行的规则
+	Response []Rule // 返回客户端前对响应头执行的规则
+}
+
+// Engine 声明式请求头规则引擎
+//
+// Director 包装 ReverseProxy 的 Director，在 URL 改写后执行请求规则；
+// Engine 实现 modifier.Transformer，加入响应改写链即可执行响应规则
+type Engine struct {
+	routes []*compiledRoute
+}
+
+type compiledRoute struct {
+	Route
+	host     *Template
+	request  []compiledRule
+	response []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	value *Template
+}
+
+// NewEngine 新建规则引擎，规则无效时返回错误
+func NewEngine(routes ...Route) (*Engine, error) {
+	e := &Engine{}
+	for _, route := range routes {
+		compiled := &compiledRoute{Route: route}
+		var err error
+		if route.Host != "" {
+			if compiled.host, err = ParseTemplate(route.Host); err != nil {
+				return nil, err
+			}
+		}
+		if compiled.request, err = compileRules(route.Name, route.Request); err != nil {
+			return nil, err
+		}
+		if compiled.response, err = compileRules(route.Name, route.Response); err != nil {
+			return nil, err
+		}
+		e.routes = append(e.routes, compiled)
+	}
+	sort.SliceStable(e.routes, func(i, j int) bool { return len(e.routes[i].Prefix) > len(e.routes[j].Prefix) })
+	return e, nil
+}
+
+func compileRules(route string, rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRule{Rule: rule}
+		switch rule.Op {
+		case OpSet, OpAdd:
+			value, err := ParseTemplate(rule.Value)
+			if err != nil {
+				return nil, err
+			}
+			c.value = value
+		case OpRename:
+			if rule.To == "" {
+				return nil, fmt.Errorf("header_rule: route %q: rename %s without target", route, rule.Name)
+			}
+		case OpRemove:
+		default:
+			return nil, fmt.Errorf("header_rule: route %q: unknown op %q", route, rule.Op)
+		}
+		if rule.Name == "" {
+			return nil, fmt.Errorf("header_rule: route %q: empty header name", route)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+type contextKey struct{}
+
+// matched 请求匹配到的路由及改写前的信息，供响应规则使用
+type matched struct {
+	route    *compiledRoute
+	path     string
+	clientIP string
+}
+
+// Director 包装 Director：先按改写前的路径匹配路由，执行 next 后再执行请求规则
+func (e *Engine) Director(next func(*http.Request)) func(*http.Request) {
+	return func(req *http.Request) {
+		route := e.match(req.URL.Path)
+		m := &matched{route: route, path: req.URL.Path, clientIP: clientIP(req.RemoteAddr)}
+		next(req)
+		if route == nil {
+			return
+		}
+		// Director 不能替换请求指针，只能原地替换为带新上下文的请求
+		*req = *req.WithContext(context.WithValue(req.Context(), contextKey{}, m))
+
+		vars := m.vars(req)
+		apply(req.Header, route.request, vars)
+		if route.host != nil {
+			req.Host = route.host.Execute(vars)
+		}
+	}
+}
+
+// Transform 执行响应规则，实现 modifier.Transformer
+func (e *Engine) Transform(res *http.Response) error {
+	if res.Request == nil {
+		return nil
+	}
+	m, ok := res.Request.Context().Value(contextKey{}).(*matched)
+	if !ok || len(m.route.response) == 0 {
+		return nil
+	}
+	apply(res.Header, m.route.response, m.vars(res.Request))
+	return nil
+}
+
+func (e *Engine) match(path string) *compiledRoute {
+	for _, route := range e.routes {
+		if strings.HasPrefix(path, route.Prefix) {
+			return route
+		}
+	}
+	return nil
+}
+
+func (m *matched) vars(req *http.Request) *Vars {
+	return &Vars{Request: req, Route: m.route.Name, Path: m.path, ClientIP: m.clientIP}
+}
+
+// apply 按顺序执行规则，模板取值时看到的是之前规则执行后的请求头
+func apply(header http.Header, rules []compiledRule, vars *Vars) {
+	for _, rule := range rules {
+		switch rule.Op {
+		case OpSet:
+			header.Set(rule.Name, rule.value.Execute(vars))
+		case OpAdd:
+			header.Add(rule.Name, rule.value.Execute(vars))
+		case OpRemove:
+			header.Del(rule.Name)
+		case OpRename:
+			if values := header.Values(rule.Name); len(values) > 0 {
+				header.Del(rule.Name)
+				for _, v := range values {
+					header.Add(rule.To, v)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package header_rule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+)
+
+// TestEngine 测试请求规则、Host 改写和响应规则在 ReverseProxy 中生效
+func TestEngine(t *testing.T) {
+	var got *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("Server", "backend/1.0")
+		w.Header().Set("X-Internal-Trace", "abc")
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	engine, err := NewEngine(
+		Route{Name: "default", Prefix: "/"},
+		Route{
+			Name:   "orders",
+			Prefix: "/api/orders",
+			Host:   "orders.internal",
+			Request: []Rule{
+				{Op: OpSet, Name: "X-Real-IP", Value: "${client_ip}"},
+				{Op: OpSet, Name: "X-Gateway-Route", Value: "${route}@${upstream}"},
+				{Op: OpSet, Name: "X-Original", Value: "${method} ${host}${path} ${request_id}"},
+				{Op: OpRename, Name: "X-Token", To: "X-Upstream-Token"},
+				{Op: OpRemove, Name: "Cookie"},
+				{Op: OpAdd, Name: "X-Tag", Value: "gw"},
+			},
+			Response: []Rule{
+				{Op: OpRemove, Name: "X-Internal-Trace"},
+				{Op: OpRename, Name: "Server", To: "X-Upstream-Server"},
+				{Op: OpSet, Name: "X-Served-By", Value: "${route} ${header.X-Real-IP}"},
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Director = engine.Director(proxy.Director)
+	proxy.ModifyResponse = engine.Transform
+
+	req := httptest.NewRequest(http.MethodGet, "http://gw.example.com/api/orders/1", nil)
+	req.RemoteAddr = "203.0.113.7:5555"
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-Token", "t1")
+	req.Header.Set("X-Tag", "client")
+	req.Header.Set("Cookie", "session=1")
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	wantRequest := map[string]string{
+		"X-Real-IP":        "203.0.113.7",
+		"X-Gateway-Route":  "orders@" + target.Host,
+		"X-Original":       "GET gw.example.com/api/orders/1 req-1",
+		"X-Upstream-Token": "t1",
+		"X-Token":          "",
+		"Cookie":           "",
+	}
+	for name, want := range wantRequest {
+		if v := got.Header.Get(name); v != want {
+			t.Errorf("request header %s: want %q, got %q", name, want, v)
+		}
+	}
+	if tags := got.Header.Values("X-Tag"); len(tags) != 2 {
+		t.Errorf("want X-Tag appended, got %v", tags)
+	}
+	if got.Host != "orders.internal" {
+		t.Errorf("want Host rewritten, got %q", got.Host)
+	}
+
+	wantResponse := map[string]string{
+		"X-Internal-Trace":  "",
+		"Server":            "",
+		"X-Upstream-Server": "backend/1.0",
+		"X-Served-By":       "orders 203.0.113.7",
+	}
+	for name, want := range wantResponse {
+		if v := rec.Header().Get(name); v != want {
+			t.Errorf("response header %s: want %q, got %q", name, want, v)
+		}
+	}
+}
+
+// TestNewEngine_Invalid 测试无效规则在加载时报错
+func TestNewEngine_Invalid(t *testing.T) {
+	invalid := []Route{
+		{Name: "a", Request: []Rule{{Op: OpSet, Name: "X", Value: "${unknown}"}}},
+		{Name: "b", Request: []Rule{{Op: OpSet, Name: "X", Value: "${client_ip"}}},
+		{Name: "c", Response: []Rule{{Op: OpRename, Name: "X"}}},
+		{Name: "d", Request: []Rule{{Op: "append", Name: "X"}}},
+	}
+	for _, route := range invalid {
+		if _, err := NewEngine(route); err == nil {
+			t.Errorf("route %s: want error", route.Name)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package header_rule
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Template 请求头取值模板，${变量} 在请求时替换，其余部分原样保留：
+//
+//	${client_ip}      客户端IP（连接对端地址）
+//	${request_id}     X-Request-Id 请求头
+//	${route}          匹配到的路由名称
+//	${upstream}       下游地址 host:port
+//	${host}           客户端请求的 Host
+//	${method}         请求方法
+//	${path}           客户端请求的原始路径
+//	${header.名称}    客户端请求头
+//	${$}              字面量 $
+type Template struct {
+	raw   string
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal  string
+	variable string // 为空表示字面量
+}
+
+// Vars 模板变量的取值来源
+type Vars struct {
+	Request  *http.Request // 客户端请求，已经过 Director 改写
+	Route    string
+	Path     string // 改写前的原始路径
+	ClientIP string
+}
+
+var knownVars = map[string]bool{
+	"client_ip": true, "request_id": true, "route": true, "upstream": true,
+	"host": true, "method": true, "path": true, "$": true,
+}
+
+// ParseTemplate 解析模板，未知变量或未闭合的 ${ 返回错误
+func ParseTemplate(raw string) (*Template, error) {
+	t := &Template{raw: raw}
+	rest := raw
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("header_rule: unclosed variable in %q", raw)
+		}
+		name := rest[start+2 : start+end]
+		if !knownVars[name] && !strings.HasPrefix(name, "header.") {
+			return nil, fmt.Errorf("header_rule: unknown variable ${%s} in %q", name, raw)
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: rest[:start]})
+		}
+		t.parts = append(t.parts, templatePart{variable: name})
+		rest = rest[start+end+1:]
+	}
+	if rest != "" {
+		t.parts = append(t.parts, templatePart{literal: rest})
+	}
+	return t, nil
+}
+
+// MustParseTemplate 同 ParseTemplate，解析失败时 panic，用于初始化固定配置
+func MustParseTemplate(raw string) *Template {
+	t, err := ParseTemplate(raw)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t *Template) String() string { return t.raw }
+
+// Execute 按请求替换模板中的变量
+func (t *Template) Execute(vars *Vars) string {
+	if len(t.parts) == 1 && t.parts[0].variable == "" {
+		return t.parts[0].literal
+	}
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.variable == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		b.WriteString(vars.lookup(part.variable))
+	}
+	return b.String()
+}
+
+func (v *Vars) lookup(name string) string {
+	req := v.Request
+	switch name {
+	case "client_ip":
+		return v.ClientIP
+	case "request_id":
+		return req.Header.Get("X-Request-Id")
+	case "route":
+		return v.Route
+	case "upstream":
+		return req.URL.Host
+	case "host":
+		return req.Host
+	case "method":
+		return req.Method
+	case "path":
+		return v.Path
+	case "$":
+		return "$"
+	}
+	return req.Header.Get(strings.TrimPrefix(name, "header."))
+}
+
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -0,0 +1,60 @@
+package hedge
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindowSize = 1000 // 统计p95时保留的最近样本数
+	minLatencySamples = 20   // 样本数不足时使用默认对冲延迟
+	recomputeEvery    = 50   // 每新增多少个样本重新计算一次p95
+)
+
+// latencyWindow 最近若干次请求的延迟环形缓冲区，用于估算路由的p95延迟
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+	dirty   int
+	p95     time.Duration
+}
+
+func newLatencyWindow() *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, latencyWindowSize)}
+}
+
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.next] = d
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+	w.dirty++
+}
+
+// percentile95 返回p95延迟，样本不足时 ok 为 false
+func (w *latencyWindow) percentile95() (p95 time.Duration, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	count := w.next
+	if w.full {
+		count = len(w.samples)
+	}
+	if count < minLatencySamples {
+		return 0, false
+	}
+	if w.dirty >= recomputeEvery || w.p95 == 0 {
+		sorted := make([]time.Duration, count)
+		copy(sorted, w.samples[:count])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		w.p95 = sorted[(count*95-1)/100]
+		w.dirty = 0
+	}
+	return w.p95, true
+}
@@ -0,0 +1,263 @@
+package hedge
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sen-golang-study/go-gateway/load_balance"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RouteConfig 路由的对冲请求配置
+type RouteConfig struct {
+	DefaultDelay time.Duration // 延迟样本不足时使用的对冲延迟
+	MinDelay     time.Duration // 对冲延迟下限，避免p95过小时对冲请求过多
+	MaxDelay     time.Duration // 对冲延迟上限，0 表示不限制
+}
+
+// Route 开启了对冲请求的路由，按路径前缀匹配
+type Route struct {
+	Prefix  string
+	config  atomic.Pointer[RouteConfig] // EnableRoute 可在运行时替换配置
+	enabled atomic.Bool
+	latency *latencyWindow
+
+	requests  atomic.Uint64 // 可对冲的请求数
+	hedged    atomic.Uint64 // 发出了对冲请求的次数
+	hedgeWins atomic.Uint64 // 对冲请求先于原请求返回的次数
+}
+
+// SetEnabled 运行时开启或关闭该路由的对冲请求
+func (r *Route) SetEnabled(enabled bool) { r.enabled.Store(enabled) }
+
+// delay 对冲延迟：取路由的p95延迟，并限制在 [MinDelay, MaxDelay] 之间
+func (r *Route) delay() time.Duration {
+	config := r.config.Load()
+	d, ok := r.latency.percentile95()
+	if !ok {
+		d = config.DefaultDelay
+	}
+	if d < config.MinDelay {
+		d = config.MinDelay
+	}
+	if config.MaxDelay > 0 && d > config.MaxDelay {
+		d = config.MaxDelay
+	}
+	return d
+}
+
+// Stats 路由的对冲统计
+type Stats struct {
+	Prefix    string        `json:"prefix"`
+	Enabled   bool          `json:"enabled"`
+	Requests  uint64        `json:"requests"`
+	Hedged    uint64        `json:"hedged"`
+	HedgeWins uint64        `json:"hedge_wins"`
+	WinRate   float64       `json:"win_rate"` // 对冲请求的胜率：HedgeWins / Hedged
+	Delay     time.Duration `json:"delay"`
+}
+
+// Stats 返回路由当前的对冲统计
+func (r *Route) Stats() Stats {
+	s := Stats{
+		Prefix:    r.Prefix,
+		Enabled:   r.enabled.Load(),
+		Requests:  r.requests.Load(),
+		Hedged:    r.hedged.Load(),
+		HedgeWins: r.hedgeWins.Load(),
+		Delay:     r.delay(),
+	}
+	if s.Hedged > 0 {
+		s.WinRate = float64(s.HedgeWins) / float64(s.Hedged)
+	}
+	return s
+}
+
+// Transport 对冲请求 http.RoundTripper，包装代理服务器共用的 http.Transport
+//
+// 对于开启了对冲的路由上的 GET/HEAD 请求：
+//  1. 先向原下游发送请求
+//  2. 超过路由的p95延迟仍未响应，从负载均衡器中选另一个下游再发送一份
+//  3. 哪个先成功返回就用哪个，另一个通过取消其上下文中断
+type Transport struct {
+	Base     http.RoundTripper        // 实际发送请求的 Transport，为空时使用 http.DefaultTransport
+	Balancer load_balance.LoadBalance // 选择对冲请求的下游，为空时对冲到原下游
+
+	mu     sync.RWMutex
+	routes []*Route // 按前缀长度降序排列，优先匹配最长前缀
+}
+
+// NewTransport 新建对冲请求 Transport
+func NewTransport(base http.RoundTripper, balancer load_balance.LoadBalance) *Transport {
+	return &Transport{Base: base, Balancer: balancer}
+}
+
+// EnableRoute 为路径前缀开启对冲请求，已存在时更新配置
+func (t *Transport) EnableRoute(prefix string, config RouteConfig) *Route {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, route := range t.routes {
+		if route.Prefix == prefix {
+			route.config.Store(&config)
+			route.SetEnabled(true)
+			return route
+		}
+	}
+	route := &Route{Prefix: prefix, latency: newLatencyWindow()}
+	route.config.Store(&config)
+	route.SetEnabled(true)
+	t.routes = append(t.routes, route)
+	sort.Slice(t.routes, func(i, j int) bool { return len(t.routes[i].Prefix) > len(t.routes[j].Prefix) })
+	return route
+}
+
+// Stats 返回所有路由的对冲统计
+func (t *Transport) Stats() []Stats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	stats := make([]Stats, 0, len(t.routes))
+	for _, route := range t.routes {
+		stats = append(stats, route.Stats())
+	}
+	return stats
+}
+
+func (t *Transport) match(path string) *Route {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, route := range t.routes {
+		if strings.HasPrefix(path, route.Prefix) {
+			return route
+		}
+	}
+	return nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+type attempt struct {
+	index  int
+	res    *http.Response
+	err    error
+	hedged bool
+	cancel context.CancelFunc
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	route := t.match(req.URL.Path)
+	if route == nil || !route.enabled.Load() || !hedgeable(req) {
+		return t.base().RoundTrip(req)
+	}
+	route.requests.Add(1)
+
+	results := make(chan attempt, 2)
+	var cancels []context.CancelFunc
+	launch := func(host string, hedged bool) {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		out := req.Clone(ctx)
+		out.URL.Host = host
+		go func() {
+			res, err := t.base().RoundTrip(out)
+			results <- attempt{index: index, res: res, err: err, hedged: hedged, cancel: cancel}
+		}()
+	}
+
+	start := time.Now()
+	launch(req.URL.Host, false)
+	timer := time.NewTimer(route.delay())
+	defer timer.Stop()
+	var lastErr error
+	for pending := 1; pending > 0; {
+		select {
+		case <-timer.C:
+			launch(t.hedgeHost(req), true)
+			route.hedged.Add(1)
+			pending++
+		case a := <-results:
+			pending--
+			if a.err != nil {
+				a.cancel()
+				lastErr = a.err
+				continue
+			}
+			// 从原请求发出时开始计时：对冲请求胜出时若只记录它自己的耗时，慢的原请求永远不会被采样，
+			// p95 会越算越低，对冲延迟随之变短，对冲请求越来越多
+			route.latency.observe(time.Since(start))
+			if a.hedged {
+				route.hedgeWins.Add(1)
+			}
+			// 取消落后的请求，并在后台回收其结果
+			for i, cancel := range cancels {
+				if i != a.index {
+					cancel()
+				}
+			}
+			go discard(results, pending)
+			a.res.Body = &cancelBody{ReadCloser: a.res.Body, cancel: a.cancel}
+			return a.res, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// hedgeHost 从负载均衡器中选一个与原请求不同的下游
+func (t *Transport) hedgeHost(req *http.Request) string {
+	if t.Balancer == nil {
+		return req.URL.Host
+	}
+	key, _, _ := net.SplitHostPort(req.RemoteAddr)
+	host := req.URL.Host
+	for i := 0; i < 3; i++ {
+		addr, err := t.Balancer.Get(key)
+		if err != nil {
+			break
+		}
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+		if addr != req.URL.Host {
+			return addr
+		}
+	}
+	return host
+}
+
+// hedgeable 只有没有请求体的 GET/HEAD 请求可以安全地对冲
+func hedgeable(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0
+}
+
+// discard 回收被取消的请求结果，关闭其响应体
+func discard(results <-chan attempt, pending int) {
+	for ; pending > 0; pending-- {
+		a := <-results
+		if a.res != nil {
+			a.res.Body.Close()
+		}
+		a.cancel()
+	}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,111 @@
+package hedge
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sen-golang-study/go-gateway/load_balance"
+	"testing"
+	"time"
+)
+
+// TestTransport_HedgeWins 测试原下游响应慢时，对冲请求先返回，且慢请求被取消
+func TestTransport_HedgeWins(t *testing.T) {
+	canceled := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+	slowURL, _ := url.Parse(slow.URL)
+	fastURL, _ := url.Parse(fast.URL)
+
+	transport := NewTransport(http.DefaultTransport, load_balance.NewRoundRobinBalance(slowURL.Host, fastURL.Host))
+	route := transport.EnableRoute("/realserver", RouteConfig{DefaultDelay: 20 * time.Millisecond})
+
+	req := httptest.NewRequest(http.MethodGet, slow.URL+"/realserver", nil)
+	req.RequestURI = ""
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip failed: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "fast" {
+		t.Errorf("want hedged response, got %q", body)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("slow request was not canceled")
+	}
+	stats := route.Stats()
+	if stats.Hedged != 1 || stats.HedgeWins != 1 || stats.WinRate != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	// 延迟从原请求发出时算起，至少包含对冲延迟
+	if d := route.latency.samples[0]; d < 20*time.Millisecond {
+		t.Errorf("want latency measured from the primary launch, got %v", d)
+	}
+}
+
+// TestTransport_NotHedged 测试未开启对冲的路由和非 GET 请求直接透传
+func TestTransport_NotHedged(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer upstream.Close()
+	transport := NewTransport(http.DefaultTransport, nil)
+	route := transport.EnableRoute("/realserver", RouteConfig{DefaultDelay: time.Millisecond})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, upstream.URL+"/other", nil),
+		httptest.NewRequest(http.MethodDelete, upstream.URL+"/realserver", nil),
+	} {
+		req.RequestURI = ""
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip failed: %v", err)
+		}
+		res.Body.Close()
+	}
+	if stats := route.Stats(); stats.Requests != 0 || stats.Hedged != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// TestTransport_Reconfigure 测试请求进行中更新路由配置，配合 -race 检查数据竞争
+func TestTransport_Reconfigure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	transport := NewTransport(http.DefaultTransport, nil)
+	transport.EnableRoute("/realserver", RouteConfig{DefaultDelay: time.Second})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			transport.EnableRoute("/realserver", RouteConfig{DefaultDelay: time.Duration(i+1) * time.Second})
+			transport.Stats()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, upstream.URL+"/realserver", nil)
+		req.RequestURI = ""
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	<-done
+}
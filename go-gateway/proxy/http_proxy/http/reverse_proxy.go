@@ -3,9 +3,9 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
+	"sen-golang-study/go-gateway/proxy/http_proxy/proxy_error"
 )
 
 // HTTP反向代理基本功能
@@ -32,24 +32,30 @@ func main() {
 }
 
 var (
-	proxyAddr = "http://127.0.0.1:8001"
+	proxyAddr         = "http://127.0.0.1:8001"
+	proxyErrorHandler = proxy_error.NewHandler() // 下游请求失败时返回结构化的网关错误页
 )
 
 func handler(w http.ResponseWriter, r *http.Request) {
 	// 1.解析下游服务器地址，更改请求地址
 	// 被代理的下游真实服务器地址.应该通过一定的负载均衡算法获取
 	realServer, err := url.Parse(proxyAddr)
+	if err != nil {
+		proxyErrorHandler.ServeError(w, r, err)
+		return
+	}
 	r.URL.Scheme = realServer.Scheme // http
 	r.URL.Host = realServer.Host     // 127.0.0.1:8001
 
 	// 2.请求下游(真实服务器)，并获取返回内容
 	transport := http.DefaultTransport
 	resp, err := transport.RoundTrip(r) // 得到下游服务器响应
-	defer resp.Body.Close()
 	if err != nil {
-		log.Print(err)
+		// 下游不可用时 resp 为 nil，必须先判断错误再关闭响应体
+		proxyErrorHandler.ServeError(w, r, err)
 		return
 	}
+	defer resp.Body.Close()
 
 	// 3.把下游请求内容做一些处理，然后返回给上游(客户端)
 	for k, vv := range resp.Header { // 修改上游响应头
@@ -57,5 +63,6 @@ func handler(w http.ResponseWriter, r *http.Request) {
 			w.Header().Add(k, v)
 		}
 	}
+	w.WriteHeader(resp.StatusCode)
 	bufio.NewReader(resp.Body).WriteTo(w) // 将下游响应体写回上游客户端
 }
@@ -1,13 +1,27 @@
 package main
 
 import (
-	"bytes"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"sen-golang-study/go-gateway/circuit_breaker"
+	"sen-golang-study/go-gateway/load_balance"
+	"sen-golang-study/go-gateway/middleware/access_control"
+	"sen-golang-study/go-gateway/middleware/access_log"
+	"sen-golang-study/go-gateway/middleware/request_id"
+	"sen-golang-study/go-gateway/proxy/http_proxy/cache"
+	"sen-golang-study/go-gateway/proxy/http_proxy/h2"
+	"sen-golang-study/go-gateway/proxy/http_proxy/header_rule"
+	"sen-golang-study/go-gateway/proxy/http_proxy/hedge"
+	"sen-golang-study/go-gateway/proxy/http_proxy/mirror"
+	"sen-golang-study/go-gateway/proxy/http_proxy/modifier"
+	"sen-golang-study/go-gateway/proxy/http_proxy/proxy_error"
+	"sen-golang-study/go-gateway/proxy/http_proxy/retry"
+	"sen-golang-study/go-gateway/proxy/http_proxy/url_rewrite"
+	"sen-golang-study/go-gateway/tracing"
 	"strconv"
 	"strings"
 	"time"
@@ -16,7 +30,7 @@ import (
 // HTTP反向代理完整版：用ReverseProxy实现
 //
 // 支持功能：
-//	URL重写、更改请求或响应内容、错误信息回调、连接池
+//	URL重写（正则改写、重定向）、更改请求或响应内容、错误信息回调、连接池、访问日志、链路追踪、HTTP/2（TLS 与 h2c）、流量镜像
 
 func main() {
 	// 真实服务地址的URL [protocol]://[IP]:[port]/?[query parameter1]&[query parameter2]#[Fragment Identifier]
@@ -30,11 +44,60 @@ func main() {
 
 	proxy := NewSingleHostReverseProxy(serverURL)
 
+	// 转发前先按规则改写客户端请求的URL，命中重定向规则时直接返回，不访问下游
+	rewriter, err := url_rewrite.NewRewriter(
+		url_rewrite.Rule{Pattern: "^/api/v1/(.*)$", Replacement: "/$1", Last: true},
+		url_rewrite.Rule{Pattern: "^/real$", Replacement: "/realserver", Redirect: http.StatusMovedPermanently},
+	)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// 为每个请求生成请求ID，只采信本机前置代理传入的 X-Request-Id
+	resolver, err := access_control.NewResolver("127.0.0.1")
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	requestIDs := request_id.NewAssigner(resolver)
+
+	// 请求ID放在最外层，访问日志、链路追踪和网关错误页都能读到
+	handler := requestIDs.Handler(accessLog.Handler(tracer.Handler(rewriter.Handler(proxy))))
+
+	// 有证书时同时监听 HTTPS，通过 ALPN 协商 HTTP/2；证书生成方式见 downstream_real_server.go
+	if _, err := os.Stat("server.crt"); err == nil {
+		go func() {
+			var tlsAddr = "127.0.0.1:8443"
+			log.Println("Starting https proxy server at " + tlsAddr)
+			log.Fatalln(h2.NewServer(tlsAddr, handler).ListenAndServeTLS("server.crt", "server.key"))
+		}()
+	}
+	// 明文端口同时接受 HTTP/1.1 和 h2c
 	var addr = "127.0.0.1:8081"
 	log.Println("Starting http proxy server at " + addr)
-	log.Fatalln(http.ListenAndServe(addr, proxy))
+	log.Fatalln(h2.NewServer(addr, handler).ListenAndServe())
 }
 
+// tracer 链路追踪，继续客户端传入的 traceparent，span 以 JSON 行输出到标准输出；
+// 接入 collector 时改用 tracing.NewOTLPExporter("http://127.0.0.1:4318/v1/traces")
+var tracer = tracing.NewTracer("go-gateway", tracing.NewWriterExporter(os.Stdout))
+
+// accessLog 访问日志，以 combined 格式异步输出到标准输出
+var accessLog = access_log.New(access_log.NewAsyncWriter(os.Stdout, 10000, time.Second), access_log.CombinedFormat{})
+
+// errorHandler 下游请求失败或 ModifyResponse 返回错误时，按错误分类返回 502/503/504 错误页
+var errorHandler = proxy_error.NewHandler()
+
+// breakers 按下游地址熔断，可通过 breakers.States() 查看各下游的熔断状态
+var breakers = circuit_breaker.NewGroup(circuit_breaker.DefaultConfig())
+
+// responseCache 响应缓存，可通过 Purge/PurgePrefix 按下游URL清除，如 responseCache.Purge("http://127.0.0.1:8001/realserver/?a=1&b=2&id=1")
+var responseCache *cache.Transport
+
+// mirrorTransport 流量镜像，可通过 mirrorTransport.Stats() 查看原请求与镜像请求的状态码差异
+var mirrorTransport *mirror.Transport
+
 var transport = &http.Transport{
 	DialContext: (&net.Dialer{
 		Timeout:   30 * time.Second, // 拨号超时时间
@@ -44,17 +107,52 @@ var transport = &http.Transport{
 	IdleConnTimeout:       90 * time.Second, //空闲连接超时时间
 	TLSHandshakeTimeout:   10 * time.Second, //TLS握手超时时间
 	ExpectContinueTimeout: time.Second,      //
+	ForceAttemptHTTP2:     true,             //自定义了DialContext时，需要显式开启才会与https下游协商HTTP/2
 }
 
+// upstreamTransport 按下游选择协议：下游真实服务器同时支持 h2c，直接以 HTTP/2 prior knowledge 访问；
+// 没有单独配置的下游，https 协商 HTTP/2，http 使用 HTTP/1.1
+var upstreamTransport = func() *h2.Transport {
+	t := h2.NewTransport(transport)
+	t.SetProtocol("127.0.0.1:8001", h2.ProtocolH2C)
+	return t
+}()
+
 func NewSingleHostReverseProxy(target *url.URL) *httputil.ReverseProxy {
-	// 重写请求的URL
-	director := func(req *http.Request) {
+	// 重写请求的URL，再按路由规则改写请求头
+	director := headerRules.Director(func(req *http.Request) {
 		rewriteRequestURL(req, target)
-	}
+	})
 
+	balancer := load_balance.NewRoundRobinBalance(target.Host)
+	// 最内层按下游地址熔断：下游熔断时直接返回错误，由重试换到其他下游，全部熔断时返回 503
+	breakerTransport := circuit_breaker.NewTransport(upstreamTransport, breakers)
+	// 每次尝试都经过访问日志的 Transport，记录最终的下游地址、重试次数和耗时分解
+	logTransport := access_log.NewTransport(breakerTransport)
+	// 每次尝试一个客户端 span，并把 traceparent 传给下游
+	traceTransport := tracer.NewTransport(logTransport)
+	// 读多写少的路由开启对冲请求：超过路由p95延迟仍未响应时，向另一个下游再发一份
+	hedgeTransport := hedge.NewTransport(traceTransport, balancer)
+	hedgeTransport.EnableRoute("/realserver", hedge.RouteConfig{
+		DefaultDelay: 100 * time.Millisecond,
+		MinDelay:     10 * time.Millisecond,
+		MaxDelay:     time.Second,
+	})
+	// 幂等请求失败时，从负载均衡器中选择其他下游重试
+	retryTransport := retry.NewTransport(hedgeTransport, balancer, retry.DefaultConfig())
+	// 迁移前把部分线上流量复制一份发给新版本下游，镜像请求只经过熔断，不重试也不记入访问日志
+	mirrorTransport = mirror.NewTransport(retryTransport, breakerTransport)
+	mirrorTransport.EnableRoute("/realserver", mirror.RouteConfig{
+		Upstream: load_balance.NewRoundRobinBalance("127.0.0.1:8002"),
+		Percent:  10,
+	})
+	// 最外层是响应缓存，命中时不会访问下游
+	responseCache = cache.NewTransport(mirrorTransport, 64<<20)
 	return &httputil.ReverseProxy{
 		Director:       director,
-		ModifyResponse: modifyResponse,
+		Transport:      responseCache,
+		ModifyResponse: proxy_error.WrapModifyResponse(modifyResponse),
+		ErrorHandler:   serveError,
 	}
 }
 
@@ -115,20 +213,43 @@ func singleJoiningSlash(a, b string) string {
 	return a + b
 }
 
-func modifyResponse(res *http.Response) error {
-	log.Println("Start modify response")
-	if res.StatusCode == http.StatusOK {
-		srcBody, err := io.ReadAll(res.Body)
-		if err != nil {
-			panic(err)
+// headerRules 按路由改写请求头和响应头：在 Director 中执行请求规则，在响应改写链中执行响应规则
+var headerRules = func() *header_rule.Engine {
+	engine, err := header_rule.NewEngine(header_rule.Route{
+		Name:   "realserver",
+		Prefix: "/realserver",
+		Request: []header_rule.Rule{
+			{Op: header_rule.OpSet, Name: "X-Real-IP", Value: "${client_ip}"},
+			{Op: header_rule.OpSet, Name: "X-Gateway-Route", Value: "${route}"},
+		},
+		Response: []header_rule.Rule{
+			{Op: header_rule.OpRename, Name: "Server", To: "X-Upstream-Server"},
+			{Op: header_rule.OpSet, Name: "X-Gateway-Route", Value: "${route}"},
+		},
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return engine
+}()
+
+// responseChain 响应改写链：头部、状态码转换器不读取响应体，响应体转换器会透明处理 gzip/br 压缩
+var responseChain = modifier.NewChain().
+	Use(modifier.RemoveHeader("X-Powered-By"), headerRules).
+	UseBody(modifier.BodyFunc(func(res *http.Response, body []byte) ([]byte, error) {
+		if res.StatusCode != http.StatusOK {
+			return body, nil
 		}
-		newBody := []byte(string(srcBody) + " modify response demo")
-		res.Body = io.NopCloser(bytes.NewBuffer(newBody))
+		return append(body, " modify response demo"...), nil
+	}))
 
-		// 注意修改了HTTP的Body后要同时修改表示内容长度的 Content-Length 头
-		length := int64(len(newBody))
-		res.ContentLength = length
-		res.Header.Set("Content-Length", strconv.FormatInt(length, 10))
-	}
-	return nil
+// serveError 所有重试都失败时，把尝试次数通过响应头告诉客户端
+func serveError(w http.ResponseWriter, req *http.Request, err error) {
+	w.Header().Set(retry.AttemptsHeader, strconv.Itoa(retry.Attempts(err)))
+	errorHandler.ServeError(w, req, err)
+}
+
+func modifyResponse(res *http.Response) error {
+	log.Println("Start modify response")
+	return responseChain.ModifyResponse(res)
 }
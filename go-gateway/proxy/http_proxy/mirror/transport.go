@@ -0,0 +1,316 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sen-golang-study/go-gateway/load_balance"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Header 镜像请求带上该请求头，影子下游可以据此跳过扣款、发消息等有副作用的操作
+const Header = "X-Gateway-Mirror"
+
+// RouteConfig 路由的流量镜像配置
+type RouteConfig struct {
+	Upstream    load_balance.LoadBalance // 影子下游
+	Percent     float64                  // 镜像的请求比例，0~100
+	MaxBodySize int64                    // 可缓冲的最大请求体字节数，超出的请求不镜像，为 0 时为 64KB
+	Timeout     time.Duration            // 镜像请求的超时时间，为 0 时为 5s
+	MaxInFlight int64                    // 同时进行的最大镜像请求数，超出时丢弃，为 0 时为 100
+}
+
+// Route 开启了流量镜像的路由，按路径前缀匹配
+type Route struct {
+	Prefix   string
+	config   atomic.Pointer[RouteConfig] // EnableRoute 可在运行时替换配置
+	enabled  atomic.Bool
+	inFlight atomic.Int64
+
+	requests   atomic.Uint64 // 命中路由的请求数
+	mirrored   atomic.Uint64 // 发出了镜像请求的次数
+	dropped    atomic.Uint64 // 请求体过大或镜像请求过多而放弃镜像的次数
+	errors     atomic.Uint64 // 镜像请求失败的次数
+	matched    atomic.Uint64 // 原请求和镜像请求状态码相同的次数
+	mismatched atomic.Uint64 // 原请求和镜像请求状态码不同的次数
+
+	mu    sync.Mutex
+	diffs map[string]uint64 // 状态码不同的组合，键为 "原请求状态码 -> 镜像请求状态码"
+}
+
+// SetEnabled 运行时开启或关闭该路由的流量镜像
+func (r *Route) SetEnabled(enabled bool) { r.enabled.Store(enabled) }
+
+// Stats 路由的镜像统计
+type Stats struct {
+	Prefix     string            `json:"prefix"`
+	Enabled    bool              `json:"enabled"`
+	Percent    float64           `json:"percent"`
+	Requests   uint64            `json:"requests"`
+	Mirrored   uint64            `json:"mirrored"`
+	Dropped    uint64            `json:"dropped"`
+	Errors     uint64            `json:"errors"`
+	Matched    uint64            `json:"matched"`
+	Mismatched uint64            `json:"mismatched"`
+	MatchRate  float64           `json:"match_rate"` // 状态码一致率：Matched / (Matched + Mismatched)
+	Diffs      map[string]uint64 `json:"diffs"`
+}
+
+// Stats 返回路由当前的镜像统计
+func (r *Route) Stats() Stats {
+	s := Stats{
+		Prefix:     r.Prefix,
+		Enabled:    r.enabled.Load(),
+		Percent:    r.config.Load().Percent,
+		Requests:   r.requests.Load(),
+		Mirrored:   r.mirrored.Load(),
+		Dropped:    r.dropped.Load(),
+		Errors:     r.errors.Load(),
+		Matched:    r.matched.Load(),
+		Mismatched: r.mismatched.Load(),
+		Diffs:      map[string]uint64{},
+	}
+	if total := s.Matched + s.Mismatched; total > 0 {
+		s.MatchRate = float64(s.Matched) / float64(total)
+	}
+	r.mu.Lock()
+	for k, v := range r.diffs {
+		s.Diffs[k] = v
+	}
+	r.mu.Unlock()
+	return s
+}
+
+// record 对比原请求和镜像请求的状态码，请求失败时状态码记为 error
+func (r *Route) record(primary, shadow int) {
+	if primary == shadow {
+		r.matched.Add(1)
+		return
+	}
+	r.mismatched.Add(1)
+	key := statusText(primary) + " -> " + statusText(shadow)
+	r.mu.Lock()
+	r.diffs[key]++
+	r.mu.Unlock()
+}
+
+func statusText(code int) string {
+	if code == 0 {
+		return "error"
+	}
+	return strconv.Itoa(code)
+}
+
+// Transport 流量镜像 http.RoundTripper，包装代理服务器共用的 http.Transport
+//
+// 对于开启了镜像的路由，按比例抽样的请求：
+//  1. 缓冲请求体，超过 MaxBodySize 的请求只发给原下游
+//  2. 原请求照常同步发送，同时在后台向影子下游发送一份副本，丢弃其响应体
+//  3. 镜像请求不继承原请求的上下文，原请求结束或被取消不影响镜像请求，镜像请求也不会拖慢原请求
+//  4. 两边都返回后，对比状态码记入路由的统计
+type Transport struct {
+	Base   http.RoundTripper // 发送原请求的 Transport，为空时使用 http.DefaultTransport
+	Shadow http.RoundTripper // 发送镜像请求的 Transport，为空时使用 Base
+
+	mu     sync.RWMutex
+	routes []*Route // 按前缀长度降序排列，优先匹配最长前缀
+	wg     sync.WaitGroup
+}
+
+// NewTransport 新建流量镜像 Transport
+func NewTransport(base, shadow http.RoundTripper) *Transport {
+	return &Transport{Base: base, Shadow: shadow}
+}
+
+// EnableRoute 为路径前缀开启流量镜像，已存在时更新配置
+func (t *Transport) EnableRoute(prefix string, config RouteConfig) *Route {
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 64 << 10
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.MaxInFlight == 0 {
+		config.MaxInFlight = 100
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, route := range t.routes {
+		if route.Prefix == prefix {
+			route.config.Store(&config)
+			route.SetEnabled(true)
+			return route
+		}
+	}
+	route := &Route{Prefix: prefix, diffs: map[string]uint64{}}
+	route.config.Store(&config)
+	route.SetEnabled(true)
+	t.routes = append(t.routes, route)
+	sort.Slice(t.routes, func(i, j int) bool { return len(t.routes[i].Prefix) > len(t.routes[j].Prefix) })
+	return route
+}
+
+// Stats 返回所有路由的镜像统计
+func (t *Transport) Stats() []Stats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	stats := make([]Stats, 0, len(t.routes))
+	for _, route := range t.routes {
+		stats = append(stats, route.Stats())
+	}
+	return stats
+}
+
+// Wait 等待进行中的镜像请求结束，用于优雅退出
+func (t *Transport) Wait() { t.wg.Wait() }
+
+func (t *Transport) match(path string) *Route {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, route := range t.routes {
+		if strings.HasPrefix(path, route.Prefix) {
+			return route
+		}
+	}
+	return nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+func (t *Transport) shadow() http.RoundTripper {
+	if t.Shadow == nil {
+		return t.base()
+	}
+	return t.Shadow
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	route := t.match(req.URL.Path)
+	if route == nil || !route.enabled.Load() || !mirrorable(req) {
+		return t.base().RoundTrip(req)
+	}
+	route.requests.Add(1)
+	config := route.config.Load()
+	if rand.Float64()*100 >= config.Percent {
+		return t.base().RoundTrip(req)
+	}
+
+	body, ok, err := bufferBody(req, config.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || route.inFlight.Add(1) > config.MaxInFlight {
+		if ok {
+			route.inFlight.Add(-1)
+		}
+		route.dropped.Add(1)
+		return t.base().RoundTrip(req)
+	}
+	route.mirrored.Add(1)
+
+	primary := make(chan int, 1)
+	shadowReq := shadowRequest(req, body)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer route.inFlight.Add(-1)
+		status := t.sendShadow(shadowReq, route, config)
+		route.record(<-primary, status)
+	}()
+
+	res, err := t.base().RoundTrip(req)
+	if err != nil {
+		primary <- 0
+	} else {
+		primary <- res.StatusCode
+	}
+	return res, err
+}
+
+// shadowRequest 在发送原请求之前复制请求，副本不继承原请求的上下文
+func shadowRequest(req *http.Request, body []byte) *http.Request {
+	out := req.Clone(context.Background())
+	out.Header.Set(Header, "1")
+	if body == nil {
+		out.Body, out.GetBody = nil, nil
+		return out
+	}
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	out.ContentLength = int64(len(body))
+	return out
+}
+
+// sendShadow 向影子下游发送镜像请求，丢弃响应体，返回状态码，失败时返回 0
+//
+// 目标地址从影子下游中选出，Host 头保持原请求的值
+func (t *Transport) sendShadow(req *http.Request, route *Route, config *RouteConfig) int {
+	key, _, _ := net.SplitHostPort(req.RemoteAddr)
+	addr, err := config.Upstream.Get(key)
+	if err != nil {
+		route.errors.Add(1)
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), config.Timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	req.URL.Host = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+	res, err := t.shadow().RoundTrip(req)
+	if err != nil {
+		route.errors.Add(1)
+		return 0
+	}
+	// 读完响应体以便复用连接，过大的响应直接关闭
+	io.Copy(io.Discard, io.LimitReader(res.Body, 256<<10))
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// mirrorable 协议升级和 gRPC 等流式请求不镜像
+func mirrorable(req *http.Request) bool {
+	if req.Header.Get("Upgrade") != "" {
+		return false
+	}
+	return !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+// bufferBody 缓冲请求体，ok 为 false 表示请求体超过 limit，此时原请求的请求体保持完整
+func bufferBody(req *http.Request, limit int64) (body []byte, ok bool, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if req.ContentLength > limit {
+		return nil, false, nil
+	}
+	body, err = io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		req.Body.Close()
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		req.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(body), req.Body), Closer: req.Body}
+		return nil, false, nil
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return body, true, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
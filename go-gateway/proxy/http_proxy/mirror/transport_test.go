@@ -0,0 +1,129 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sen-golang-study/go-gateway/load_balance"
+	"strings"
+	"testing"
+	"time"
+)
+
+type received struct {
+	body   string
+	header string
+}
+
+func newServers(t *testing.T, shadowStatus int, shadowDelay time.Duration) (primary *httptest.Server, shadowHost string, shadowReqs chan received) {
+	primary = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	t.Cleanup(primary.Close)
+	shadowReqs = make(chan received, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		time.Sleep(shadowDelay)
+		select {
+		case shadowReqs <- received{body: string(body), header: r.Header.Get(Header)}:
+		default:
+		}
+		w.WriteHeader(shadowStatus)
+	}))
+	t.Cleanup(shadow.Close)
+	u, _ := url.Parse(shadow.URL)
+	return primary, u.Host, shadowReqs
+}
+
+func roundTrip(t *testing.T, transport http.RoundTripper, method, target, body string) string {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RequestURI = ""
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip failed: %v", err)
+	}
+	defer res.Body.Close()
+	got, _ := io.ReadAll(res.Body)
+	return string(got)
+}
+
+// TestTransport_Mirror 测试镜像请求带上请求体和标记头，影子下游响应慢不影响原请求，并记录状态码差异
+func TestTransport_Mirror(t *testing.T) {
+	primary, shadowHost, shadowReqs := newServers(t, http.StatusInternalServerError, 300*time.Millisecond)
+	transport := NewTransport(http.DefaultTransport, nil)
+	route := transport.EnableRoute("/orders", RouteConfig{
+		Upstream: load_balance.NewRoundRobinBalance(shadowHost),
+		Percent:  100,
+	})
+
+	start := time.Now()
+	if got := roundTrip(t, transport, http.MethodPost, primary.URL+"/orders", "order-1"); got != "order-1" {
+		t.Errorf("want primary body, got %q", got)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("primary request waited for the shadow: %v", elapsed)
+	}
+	select {
+	case r := <-shadowReqs:
+		if r.body != "order-1" || r.header != "1" {
+			t.Errorf("unexpected shadow request %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shadow request not sent")
+	}
+	transport.Wait()
+
+	stats := route.Stats()
+	if stats.Requests != 1 || stats.Mirrored != 1 || stats.Mismatched != 1 || stats.Diffs["200 -> 500"] != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// TestTransport_NotMirrored 测试未命中路由、抽样比例为 0、请求体过大时只发给原下游
+func TestTransport_NotMirrored(t *testing.T) {
+	primary, shadowHost, shadowReqs := newServers(t, http.StatusOK, 0)
+	transport := NewTransport(http.DefaultTransport, nil)
+	upstream := load_balance.NewRoundRobinBalance(shadowHost)
+	sampled := transport.EnableRoute("/orders", RouteConfig{Upstream: upstream, Percent: 100, MaxBodySize: 4})
+	transport.EnableRoute("/orders/none", RouteConfig{Upstream: upstream, Percent: 0})
+
+	roundTrip(t, transport, http.MethodGet, primary.URL+"/users", "")
+	roundTrip(t, transport, http.MethodGet, primary.URL+"/orders/none", "")
+	if got := roundTrip(t, transport, http.MethodPost, primary.URL+"/orders", "too large body"); got != "too large body" {
+		t.Errorf("want full body forwarded, got %q", got)
+	}
+	roundTrip(t, transport, http.MethodGet, primary.URL+"/orders", "")
+	transport.Wait()
+
+	if len(shadowReqs) != 1 {
+		t.Errorf("want 1 shadow request, got %d", len(shadowReqs))
+	}
+	stats := sampled.Stats()
+	if stats.Requests != 2 || stats.Mirrored != 1 || stats.Dropped != 1 || stats.Matched != 1 || stats.MatchRate != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// TestTransport_Reconfigure 测试请求进行中更新路由配置，配合 -race 检查数据竞争
+func TestTransport_Reconfigure(t *testing.T) {
+	primary, shadowHost, _ := newServers(t, http.StatusOK, 0)
+	transport := NewTransport(http.DefaultTransport, nil)
+	upstream := load_balance.NewRoundRobinBalance(shadowHost)
+	transport.EnableRoute("/orders", RouteConfig{Upstream: upstream, Percent: 100})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			transport.EnableRoute("/orders", RouteConfig{Upstream: upstream, Percent: float64(i % 2 * 100)})
+			transport.Stats()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		roundTrip(t, transport, http.MethodPost, primary.URL+"/orders", "order")
+	}
+	<-done
+	transport.Wait()
+}
@@ -0,0 +1,223 @@
+package modifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxBufferSize 改写响应体时默认允许缓冲的最大字节数（解压后）
+const DefaultMaxBufferSize = 4 << 20
+
+var (
+	// ErrBodyTooLarge 解压后的响应体超过了允许缓冲的最大字节数
+	ErrBodyTooLarge = errors.New("modifier: response body exceeds max buffer size")
+	// ErrUnsupportedEncoding 响应体使用了未注册编解码器的 Content-Encoding，无法改写
+	ErrUnsupportedEncoding = errors.New("modifier: unsupported content encoding")
+)
+
+// Transformer 响应头、状态码等元信息的转换器，不读取响应体，因此不会破坏流式传输
+type Transformer interface {
+	Transform(res *http.Response) error
+}
+
+// TransformerFunc 函数适配器，让普通函数实现 Transformer
+type TransformerFunc func(res *http.Response) error
+
+func (f TransformerFunc) Transform(res *http.Response) error { return f(res) }
+
+// BodyTransformer 响应体转换器
+//
+// 只有 Match 返回 true 时才会缓冲并解压响应体，然后把明文交给 TransformBody 改写
+type BodyTransformer interface {
+	Match(res *http.Response) bool
+	TransformBody(res *http.Response, body []byte) ([]byte, error)
+}
+
+// BodyFunc 函数适配器，匹配所有响应
+type BodyFunc func(res *http.Response, body []byte) ([]byte, error)
+
+func (f BodyFunc) Match(*http.Response) bool { return true }
+
+func (f BodyFunc) TransformBody(res *http.Response, body []byte) ([]byte, error) { return f(res, body) }
+
+// Chain 响应转换链，可直接作为 httputil.ReverseProxy 的 ModifyResponse 使用
+//
+// 执行顺序：
+//  1. 依次执行所有 Transformer（响应头、状态码）
+//  2. 若有 BodyTransformer 匹配当前响应，则按 Content-Encoding 解压响应体，
+//     依次执行匹配的 BodyTransformer，再用原编码重新压缩并修正 Content-Length
+//  3. 没有 BodyTransformer 匹配时，响应体保持原样流式返回；gRPC、SSE 和带 trailer 的流式响应不会缓冲
+//
+// 任一步骤返回的错误会交给 ReverseProxy 的 ErrorHandler 处理
+type Chain struct {
+	MaxBufferSize int64 // 解压后响应体允许缓冲的最大字节数，<=0 时使用 DefaultMaxBufferSize
+
+	transformers     []Transformer
+	bodyTransformers []BodyTransformer
+}
+
+// NewChain 新建响应转换链
+func NewChain() *Chain {
+	return &Chain{MaxBufferSize: DefaultMaxBufferSize}
+}
+
+// Use 追加响应头/状态码转换器
+func (c *Chain) Use(transformers ...Transformer) *Chain {
+	c.transformers = append(c.transformers, transformers...)
+	return c
+}
+
+// UseBody 追加响应体转换器
+func (c *Chain) UseBody(transformers ...BodyTransformer) *Chain {
+	c.bodyTransformers = append(c.bodyTransformers, transformers...)
+	return c
+}
+
+// ModifyResponse 执行转换链，签名与 httputil.ReverseProxy.ModifyResponse 一致
+func (c *Chain) ModifyResponse(res *http.Response) error {
+	for _, t := range c.transformers {
+		if err := t.Transform(res); err != nil {
+			return err
+		}
+	}
+	if !hasBody(res) || isStreaming(res) {
+		return nil
+	}
+
+	var matched []BodyTransformer
+	for _, t := range c.bodyTransformers {
+		if t.Match(res) {
+			matched = append(matched, t)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return c.rewriteBody(res, matched)
+}
+
+func (c *Chain) rewriteBody(res *http.Response, transformers []BodyTransformer) error {
+	encodings := contentEncodings(res.Header)
+	codecList := make([]Codec, 0, len(encodings))
+	for _, encoding := range encodings {
+		codec, ok := lookupCodec(encoding)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+		}
+		if codec != nil {
+			codecList = append(codecList, codec)
+		}
+	}
+
+	body, err := c.readBody(res.Body, codecList)
+	if err != nil {
+		return err
+	}
+	for _, t := range transformers {
+		if body, err = t.TransformBody(res, body); err != nil {
+			return err
+		}
+	}
+	encoded, err := encodeBody(body, codecList)
+	if err != nil {
+		return err
+	}
+
+	// 注意修改了HTTP的Body后要同时修改表示内容长度的 Content-Length 头
+	res.Body = io.NopCloser(bytes.NewReader(encoded))
+	res.ContentLength = int64(len(encoded))
+	res.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+	res.Header.Del("Content-MD5")
+	// 内容已经变化，强校验的 ETag 不再成立，降级为弱校验
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		res.Header.Set("ETag", "W/"+etag)
+	}
+	return nil
+}
+
+// readBody 按编码的逆序逐层解压，并限制解压后的最大长度
+func (c *Chain) readBody(body io.ReadCloser, codecList []Codec) ([]byte, error) {
+	defer body.Close()
+	var reader io.Reader = body
+	for i := len(codecList) - 1; i >= 0; i-- {
+		decoded, err := codecList[i].NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("modifier: decode response body: %w", err)
+		}
+		defer decoded.Close()
+		reader = decoded
+	}
+
+	limit := c.MaxBufferSize
+	if limit <= 0 {
+		limit = DefaultMaxBufferSize
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("modifier: read response body: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+// encodeBody 按编码顺序逐层重新压缩
+func encodeBody(body []byte, codecList []Codec) ([]byte, error) {
+	for _, codec := range codecList {
+		var buf bytes.Buffer
+		w := codec.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, fmt.Errorf("modifier: encode response body: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("modifier: encode response body: %w", err)
+		}
+		body = buf.Bytes()
+	}
+	return body, nil
+}
+
+// contentEncodings 解析 Content-Encoding，可能是逗号分隔的多层编码
+func contentEncodings(header http.Header) []string {
+	var encodings []string
+	for _, v := range header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(v, ",") {
+			if encoding = strings.TrimSpace(encoding); encoding != "" {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+	return encodings
+}
+
+// isStreaming 流式响应缓冲后客户端要等到下游写完才能收到，trailer 也会丢失
+func isStreaming(res *http.Response) bool {
+	if len(res.Trailer) > 0 || res.Header.Get("Trailer") != "" {
+		return true
+	}
+	contentType := res.Header.Get("Content-Type")
+	return strings.HasPrefix(contentType, "application/grpc") || strings.HasPrefix(contentType, "text/event-stream")
+}
+
+// hasBody HEAD请求以及 1xx/204/304 响应没有响应体
+func hasBody(res *http.Response) bool {
+	if res.Body == nil || res.Body == http.NoBody {
+		return false
+	}
+	if res.Request != nil && res.Request.Method == http.MethodHead {
+		return false
+	}
+	switch {
+	case res.StatusCode >= 100 && res.StatusCode < 200,
+		res.StatusCode == http.StatusNoContent,
+		res.StatusCode == http.StatusNotModified:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package modifier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newResponse(contentType, encoding string, body []byte) *http.Response {
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    &http.Request{Method: http.MethodGet},
+	}
+	res.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		res.Header.Set("Content-Encoding", encoding)
+	}
+	return res
+}
+
+func gzipBytes(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestChain_GzipJSONMask 测试 gzip 压缩的 JSON 响应能被解压、脱敏并重新压缩
+func TestChain_GzipJSONMask(t *testing.T) {
+	res := newResponse("application/json; charset=utf-8", "gzip",
+		gzipBytes(t, `{"user":{"name":"sen","password":"123456"},"list":[{"Token":"abc"}]}`))
+	res.Header.Set("ETag", `"v1"`)
+
+	chain := NewChain().Use(RemapStatus(map[int]int{http.StatusOK: http.StatusAccepted})).
+		UseBody(MaskJSONFields("password", "token"))
+	if err := chain.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("status not remapped, got %d", res.StatusCode)
+	}
+	if got := res.Header.Get("ETag"); got != `W/"v1"` {
+		t.Errorf("etag not weakened, got %s", got)
+	}
+
+	reader, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip encoded: %v", err)
+	}
+	body, _ := io.ReadAll(reader)
+	want := `{"list":[{"Token":"******"}],"user":{"name":"sen","password":"******"}}`
+	if string(body) != want {
+		t.Errorf("masked body got %s, want %s", body, want)
+	}
+}
+
+// TestChain_Deflate 测试 deflate 编码按 zlib 格式解压和重新压缩
+func TestChain_Deflate(t *testing.T) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte("hello realserver"))
+	w.Close()
+	res := newResponse("text/plain", "deflate", buf.Bytes())
+
+	if err := NewChain().UseBody(Substitute("realserver", "gateway")).ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	reader, err := zlib.NewReader(res.Body)
+	if err != nil {
+		t.Fatalf("body is not zlib encoded: %v", err)
+	}
+	if body, _ := io.ReadAll(reader); string(body) != "hello gateway" {
+		t.Errorf("got %q", body)
+	}
+}
+
+// TestChain_Substitute 测试文本替换以及 Content-Length 修正
+func TestChain_Substitute(t *testing.T) {
+	res := newResponse("text/plain", "", []byte("hello realserver"))
+	chain := NewChain().UseBody(Substitute("realserver", "gateway"))
+	if err := chain.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "hello gateway" || res.ContentLength != int64(len(body)) {
+		t.Errorf("got body %q with length %d", body, res.ContentLength)
+	}
+}
+
+// TestChain_Streaming 测试没有匹配的响应体转换器时不读取响应体
+func TestChain_Streaming(t *testing.T) {
+	original := io.NopCloser(strings.NewReader("binary"))
+	res := newResponse("image/png", "", nil)
+	res.Body = original
+	chain := NewChain().Use(AddHeader("X-Gateway", "sen")).UseBody(Substitute("a", "b"))
+	if err := chain.ModifyResponse(res); err != nil {
+		t.Fatalf("ModifyResponse failed: %v", err)
+	}
+	if res.Body != original {
+		t.Errorf("body should be streamed untouched")
+	}
+	if res.Header.Get("X-Gateway") != "sen" {
+		t.Errorf("header not added")
+	}
+
+	// 匹配所有响应的转换器也不会缓冲 gRPC 响应
+	grpcBody := io.NopCloser(strings.NewReader("frames"))
+	res = newResponse("application/grpc", "", nil)
+	res.Body = grpcBody
+	all := NewChain().UseBody(BodyFunc(func(res *http.Response, body []byte) ([]byte, error) { return body, nil }))
+	if err := all.ModifyResponse(res); err != nil || res.Body != grpcBody {
+		t.Errorf("grpc body should be streamed untouched, err %v", err)
+	}
+}
+
+// TestChain_Errors 测试超出缓冲上限和不支持的编码返回错误而不是 panic
+func TestChain_Errors(t *testing.T) {
+	chain := NewChain().UseBody(Substitute("a", "b"))
+	chain.MaxBufferSize = 4
+	res := newResponse("text/plain", "", []byte("too large"))
+	if err := chain.ModifyResponse(res); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("want ErrBodyTooLarge, got %v", err)
+	}
+
+	res = newResponse("text/plain", "zstd", []byte("data"))
+	if err := chain.ModifyResponse(res); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("want ErrUnsupportedEncoding, got %v", err)
+	}
+}
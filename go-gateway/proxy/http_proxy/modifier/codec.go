@@ -0,0 +1,70 @@
+package modifier
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Codec 响应体的压缩编解码器，对应 Content-Encoding 中的一种编码
+type Codec interface {
+	// NewReader 包装压缩数据流，返回解压后的数据流
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	// NewWriter 包装输出流，写入的数据会被压缩后再输出
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]Codec{
+		"gzip":    gzipCodec{},
+		"x-gzip":  gzipCodec{},
+		"deflate": deflateCodec{},
+		"br":      brotliCodec{},
+	}
+)
+
+// RegisterCodec 注册（或覆盖）指定 Content-Encoding 的编解码器
+func RegisterCodec(encoding string, codec Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[strings.ToLower(encoding)] = codec
+}
+
+// lookupCodec 根据 Content-Encoding 查找编解码器
+// 空编码和 identity 返回 nil, true 表示无需解压
+func lookupCodec(encoding string) (Codec, bool) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" || encoding == "identity" {
+		return nil, true
+	}
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	codec, ok := codecs[encoding]
+	return codec, ok
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+
+func (gzipCodec) NewWriter(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+
+// deflateCodec HTTP 的 deflate 编码是 zlib 格式（RFC 9110 8.4.1.2），不是裸的 DEFLATE 数据流
+type deflateCodec struct{}
+
+func (deflateCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return zlib.NewReader(r) }
+
+func (deflateCodec) NewWriter(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+
+type brotliCodec struct{}
+
+func (brotliCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+func (brotliCodec) NewWriter(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }
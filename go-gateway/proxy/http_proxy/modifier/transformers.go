@@ -0,0 +1,137 @@
+package modifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// JSONMask 脱敏后字段的替换值
+const JSONMask = "******"
+
+// AddHeader 追加响应头
+func AddHeader(key, value string) Transformer {
+	return TransformerFunc(func(res *http.Response) error {
+		res.Header.Add(key, value)
+		return nil
+	})
+}
+
+// SetHeader 设置响应头，覆盖已有值
+func SetHeader(key, value string) Transformer {
+	return TransformerFunc(func(res *http.Response) error {
+		res.Header.Set(key, value)
+		return nil
+	})
+}
+
+// RemoveHeader 删除响应头
+func RemoveHeader(keys ...string) Transformer {
+	return TransformerFunc(func(res *http.Response) error {
+		for _, key := range keys {
+			res.Header.Del(key)
+		}
+		return nil
+	})
+}
+
+// RemapStatus 状态码映射，如把下游的 404 统一改写为 200
+func RemapStatus(mapping map[int]int) Transformer {
+	return TransformerFunc(func(res *http.Response) error {
+		if code, ok := mapping[res.StatusCode]; ok {
+			res.StatusCode = code
+			res.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		}
+		return nil
+	})
+}
+
+// substitution 响应体文本替换
+type substitution struct {
+	old, new []byte
+}
+
+// Substitute 把文本类响应体中的 old 全部替换为 new
+func Substitute(old, new string) BodyTransformer {
+	return &substitution{old: []byte(old), new: []byte(new)}
+}
+
+func (s *substitution) Match(res *http.Response) bool {
+	return isTextual(res.Header.Get("Content-Type"))
+}
+
+func (s *substitution) TransformBody(_ *http.Response, body []byte) ([]byte, error) {
+	return bytes.ReplaceAll(body, s.old, s.new), nil
+}
+
+// jsonMasker JSON字段脱敏
+type jsonMasker struct {
+	fields map[string]struct{}
+}
+
+// MaskJSONFields 把 JSON 响应中任意层级名为 fields 的字段值替换为 JSONMask，字段名不区分大小写
+func MaskJSONFields(fields ...string) BodyTransformer {
+	m := &jsonMasker{fields: make(map[string]struct{}, len(fields))}
+	for _, field := range fields {
+		m.fields[strings.ToLower(field)] = struct{}{}
+	}
+	return m
+}
+
+func (m *jsonMasker) Match(res *http.Response) bool {
+	return isJSON(res.Header.Get("Content-Type"))
+}
+
+func (m *jsonMasker) TransformBody(_ *http.Response, body []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // 保持数字原样，避免大整数丢失精度
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("modifier: decode json body: %w", err)
+	}
+	return json.Marshal(m.mask(doc))
+}
+
+func (m *jsonMasker) mask(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			if _, ok := m.fields[strings.ToLower(k)]; ok {
+				val[k] = JSONMask
+				continue
+			}
+			val[k] = m.mask(child)
+		}
+	case []any:
+		for i, child := range val {
+			val[i] = m.mask(child)
+		}
+	}
+	return v
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isTextual(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || isJSON(contentType) ||
+		strings.HasSuffix(mediaType, "xml") || strings.HasSuffix(mediaType, "javascript")
+}
@@ -0,0 +1,133 @@
+package proxy_error
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sen-golang-study/go-gateway/circuit_breaker"
+	"strings"
+	"syscall"
+)
+
+// Class 网关错误分类
+type Class string
+
+const (
+	ClassDialRefused    Class = "dial_refused"    // 下游拒绝连接，或地址不可达
+	ClassTimeout        Class = "timeout"         // 拨号、读写或整体请求超时
+	ClassTLS            Class = "tls_error"       // TLS握手、证书校验失败
+	ClassUpstreamReset  Class = "upstream_reset"  // 下游在响应完成前断开连接
+	ClassCanceled       Class = "canceled"        // 客户端取消了请求
+	ClassResponseModify Class = "response_modify" // ModifyResponse 改写响应失败
+	ClassCircuitOpen    Class = "circuit_open"    // 下游熔断，请求未发出
+	ClassUnknown        Class = "unknown"
+)
+
+// StatusCode 错误分类对应返回给客户端的HTTP状态码
+func (c Class) StatusCode() int {
+	switch c {
+	case ClassDialRefused, ClassCircuitOpen:
+		return http.StatusServiceUnavailable
+	case ClassTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// Message 返回给客户端的错误描述，不暴露下游地址等内部信息
+func (c Class) Message() string {
+	switch c {
+	case ClassDialRefused:
+		return "upstream service is unavailable"
+	case ClassTimeout:
+		return "upstream service timed out"
+	case ClassTLS:
+		return "failed to establish a secure connection to upstream"
+	case ClassUpstreamReset:
+		return "upstream closed the connection unexpectedly"
+	case ClassCanceled:
+		return "request canceled by client"
+	case ClassResponseModify:
+		return "failed to process upstream response"
+	case ClassCircuitOpen:
+		return "upstream service is temporarily unavailable"
+	default:
+		return "bad gateway"
+	}
+}
+
+// ModifyResponseError 标记 ModifyResponse 阶段返回的错误，便于与传输错误区分
+type ModifyResponseError struct {
+	Err error
+}
+
+func (e *ModifyResponseError) Error() string { return "modify response: " + e.Err.Error() }
+
+func (e *ModifyResponseError) Unwrap() error { return e.Err }
+
+// WrapModifyResponse 包装 ModifyResponse，使其返回的错误被归类为 ClassResponseModify
+func WrapModifyResponse(modify func(*http.Response) error) func(*http.Response) error {
+	return func(res *http.Response) error {
+		if err := modify(res); err != nil {
+			return &ModifyResponseError{Err: err}
+		}
+		return nil
+	}
+}
+
+// Classify 对 ReverseProxy 回调给 ErrorHandler 的错误进行分类
+func Classify(err error) Class {
+	var modifyErr *ModifyResponseError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+
+	switch {
+	case err == nil:
+		return ClassUnknown
+	case errors.As(err, &modifyErr):
+		return ClassResponseModify
+	case errors.Is(err, circuit_breaker.ErrOpen), errors.Is(err, circuit_breaker.ErrTooManyTrials):
+		return ClassCircuitOpen
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ClassTimeout
+	case errors.As(err, &recordErr), errors.As(err, &certErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return ClassTLS
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EHOSTUNREACH),
+		errors.Is(err, syscall.ENETUNREACH), errors.As(err, &dnsErr):
+		return ClassDialRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ClassUpstreamReset
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ClassDialRefused
+	}
+
+	// 部分错误只有字符串形式，例如 http.Transport 的 "tls: ..." 和 "connection reset"
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "tls:") || strings.Contains(msg, "x509:"):
+		return ClassTLS
+	case strings.Contains(msg, "connection reset") || strings.Contains(msg, "server closed"):
+		return ClassUpstreamReset
+	case strings.Contains(msg, "timeout"):
+		return ClassTimeout
+	}
+	return ClassUnknown
+}
@@ -0,0 +1,188 @@
+package proxy_error
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"sen-golang-study/go-gateway/middleware/request_id"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RequestIDHeader 请求ID的请求头/响应头名称
+const RequestIDHeader = request_id.Header
+
+// ErrorBody 网关生成的错误响应体
+type ErrorBody struct {
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	Class     Class  `json:"class"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Error}}</title></head>
+<body>
+<h1>{{.Status}} {{.Error}}</h1>
+<p>{{.Message}}</p>
+<hr><p>request id: {{.RequestID}}</p>
+</body>
+</html>
+`))
+
+// Handler 网关错误处理器，ServeError 可直接作为 httputil.ReverseProxy 的 ErrorHandler
+//
+// 处理流程：
+//  1. 对错误分类，得到 502/503/504 状态码
+//  2. 按下游地址、错误分类计数
+//  3. 根据请求的 Accept 头返回 JSON 或 HTML 错误页，并带上请求ID
+type Handler struct {
+	Stats *Stats
+	// RequestID 获取请求ID，为空时依次使用 context 中的请求ID、请求头 X-Request-Id，都没有则生成新的
+	RequestID func(req *http.Request) string
+}
+
+// NewHandler 新建网关错误处理器
+func NewHandler() *Handler {
+	return &Handler{Stats: NewStats()}
+}
+
+// ServeError 处理代理错误
+func (h *Handler) ServeError(w http.ResponseWriter, req *http.Request, err error) {
+	class := Classify(err)
+	upstream := req.URL.Host
+	if h.Stats != nil {
+		h.Stats.Inc(upstream, class)
+	}
+	requestID := h.requestID(req)
+	log.Printf("proxy error: request_id=%s upstream=%s class=%s err=%v", requestID, upstream, class, err)
+
+	// 客户端已经断开，写回响应没有意义
+	if class == ClassCanceled {
+		return
+	}
+	WriteError(w, req, class.StatusCode(), class, requestID)
+}
+
+func (h *Handler) requestID(req *http.Request) string {
+	if h.RequestID != nil {
+		return h.RequestID(req)
+	}
+	if id := request_id.FromContext(req.Context()); id != "" {
+		return id
+	}
+	if id := req.Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	return request_id.New()
+}
+
+// WriteError 按 Accept 协商的格式写出网关错误页
+func WriteError(w http.ResponseWriter, req *http.Request, status int, class Class, requestID string) {
+	body := ErrorBody{
+		Status:    status,
+		Error:     http.StatusText(status),
+		Class:     class,
+		Message:   class.Message(),
+		RequestID: requestID,
+	}
+	header := w.Header()
+	header.Set(RequestIDHeader, requestID)
+	header.Set("Cache-Control", "no-store")
+	header.Del("Content-Length")
+	if prefersHTML(req.Header.Get("Accept")) {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_ = errorPage.Execute(w, body)
+		return
+	}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// prefersHTML 比较 Accept 中 HTML 与 JSON 的权重，权重相同或都未声明时返回 JSON
+func prefersHTML(accept string) bool {
+	var htmlQ, jsonQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch {
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return htmlQ > jsonQ
+}
+
+// Stats 按下游地址、错误分类统计的错误计数
+type Stats struct {
+	mu     sync.Mutex
+	counts map[string]map[Class]uint64
+}
+
+// NewStats 新建错误计数器
+func NewStats() *Stats {
+	return &Stats{counts: make(map[string]map[Class]uint64)}
+}
+
+// Inc 指定下游、指定分类的错误数加一
+func (s *Stats) Inc(upstream string, class Class) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byClass, ok := s.counts[upstream]
+	if !ok {
+		byClass = make(map[Class]uint64)
+		s.counts[upstream] = byClass
+	}
+	byClass[class]++
+}
+
+// Count 返回指定下游、指定分类的错误数
+func (s *Stats) Count(upstream string, class Class) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[upstream][class]
+}
+
+// StatEntry 错误计数快照中的一项
+type StatEntry struct {
+	Upstream string `json:"upstream"`
+	Class    Class  `json:"class"`
+	Count    uint64 `json:"count"`
+}
+
+// Snapshot 返回按下游地址、分类排序的错误计数快照
+func (s *Stats) Snapshot() []StatEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []StatEntry
+	for upstream, byClass := range s.counts {
+		for class, count := range byClass {
+			entries = append(entries, StatEntry{Upstream: upstream, Class: class, Count: count})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Upstream != entries[j].Upstream {
+			return entries[i].Upstream < entries[j].Upstream
+		}
+		return entries[i].Class < entries[j].Class
+	})
+	return entries
+}
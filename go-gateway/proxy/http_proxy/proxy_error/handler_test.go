@@ -0,0 +1,99 @@
+package proxy_error
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sen-golang-study/go-gateway/circuit_breaker"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClassify 测试常见代理错误的分类
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err  error
+		want Class
+	}{
+		{context.Canceled, ClassCanceled},
+		{context.DeadlineExceeded, ClassTimeout},
+		{&ModifyResponseError{Err: errors.New("too large")}, ClassResponseModify},
+		{errors.New("read tcp: connection reset by peer"), ClassUpstreamReset},
+		{fmt.Errorf("roundtrip: %w", circuit_breaker.ErrOpen), ClassCircuitOpen},
+		{errors.New("something else"), ClassUnknown},
+	}
+	for _, c := range cases {
+		if got := Classify(c.err); got != c.want {
+			t.Errorf("Classify(%v) got %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+// TestHandler_DialRefused 测试下游端口未监听时返回 503 JSON 错误页并计数
+func TestHandler_DialRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close() // 关闭监听，让下游拒绝连接
+
+	target, _ := url.Parse("http://" + addr)
+	handler := NewHandler()
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = handler.ServeError
+
+	req := httptest.NewRequest(http.MethodGet, "/realserver", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503", rec.Code)
+	}
+	var body ErrorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not json: %v", err)
+	}
+	if body.Class != ClassDialRefused || body.RequestID != "req-1" {
+		t.Errorf("unexpected body %+v", body)
+	}
+	if handler.Stats.Count(addr, ClassDialRefused) != 1 {
+		t.Errorf("error not counted, stats %+v", handler.Stats.Snapshot())
+	}
+}
+
+// TestHandler_TimeoutHTML 测试下游超时返回 504，浏览器请求返回 HTML 错误页
+func TestHandler_TimeoutHTML(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond}
+	proxy.ErrorHandler = NewHandler().ServeError
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/json;q=0.9")
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("got status %d, want 504", rec.Code)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("want html error page, got %s", rec.Header().Get("Content-Type"))
+	}
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Errorf("request id missing")
+	}
+}
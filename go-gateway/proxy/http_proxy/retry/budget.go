@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// Budget 重试预算：在滑动时间窗口内，重试次数不能超过总请求数的一定比例，
+// 避免下游故障时所有请求都重试，把流量放大成重试风暴
+type Budget struct {
+	Ratio         float64 // 重试数占请求数的最大比例，如 0.2 表示最多额外 20% 的重试流量
+	MinPerSecond  int     // 每秒最少允许的重试次数，保证低流量时也能重试
+	windowSeconds int     // 滑动窗口的秒数
+
+	mu      sync.Mutex
+	buckets []budgetBucket // 按秒划分的环形桶
+	now     func() time.Time
+}
+
+type budgetBucket struct {
+	second   int64
+	requests int
+	retries  int
+}
+
+// NewBudget 新建重试预算，窗口为 10 秒
+func NewBudget(ratio float64, minPerSecond int) *Budget {
+	const windowSeconds = 10
+	return &Budget{
+		Ratio:         ratio,
+		MinPerSecond:  minPerSecond,
+		windowSeconds: windowSeconds,
+		buckets:       make([]budgetBucket, windowSeconds),
+		now:           time.Now,
+	}
+}
+
+// Deposit 记录一次请求
+func (b *Budget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current().requests++
+}
+
+// Withdraw 申请一次重试，预算不足时返回 false
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := b.current()
+	requests, retries := b.sum()
+	allowed := int(float64(requests)*b.Ratio) + b.MinPerSecond*b.windowSeconds
+	if retries >= allowed {
+		return false
+	}
+	cur.retries++
+	return true
+}
+
+// current 返回当前秒对应的桶，桶过期时清零
+func (b *Budget) current() *budgetBucket {
+	second := b.now().Unix()
+	bucket := &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		*bucket = budgetBucket{second: second}
+	}
+	return bucket
+}
+
+// sum 统计窗口内的请求数与重试数
+func (b *Budget) sum() (requests, retries int) {
+	oldest := b.now().Unix() - int64(len(b.buckets)) + 1
+	for _, bucket := range b.buckets {
+		if bucket.second >= oldest {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return
+}
@@ -0,0 +1,276 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sen-golang-study/go-gateway/load_balance"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttemptsHeader 告诉客户端网关一共向下游发送了几次请求
+const AttemptsHeader = "X-Gateway-Attempts"
+
+// Config 重试配置
+type Config struct {
+	MaxAttempts   int           // 最大尝试次数（包含第一次），<=1 表示不重试
+	PerTryTimeout time.Duration // 每次尝试等待响应头的超时时间，0 表示不限制；不会重试的请求不限制
+	BaseBackoff   time.Duration // 退避基准时间
+	MaxBackoff    time.Duration // 退避上限
+	MaxBodySize   int64         // 可缓冲重放的最大请求体字节数，超出的请求不重试
+	RetryOn       []int         // 可重试的下游状态码
+}
+
+// DefaultConfig 默认重试配置
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:   3,
+		PerTryTimeout: 5 * time.Second,
+		BaseBackoff:   25 * time.Millisecond,
+		MaxBackoff:    250 * time.Millisecond,
+		MaxBodySize:   64 << 10,
+		RetryOn:       []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+// Error 所有尝试均失败时返回的错误，Unwrap 为最后一次尝试的错误
+type Error struct {
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("retry: %d attempts failed: %v", e.Attempts, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Attempts 返回错误中记录的尝试次数，没有经过重试的错误返回 1
+func Attempts(err error) int {
+	var retryErr *Error
+	if errors.As(err, &retryErr) {
+		return retryErr.Attempts
+	}
+	return 1
+}
+
+// Transport 带重试的 http.RoundTripper，包装代理服务器使用的 http.Transport
+//
+// 重试流程：
+//  1. 只有幂等方法、且请求体能在 MaxBodySize 内缓冲的请求才会重试
+//  2. 拨号失败等传输错误，或下游返回 RetryOn 中的状态码时重试
+//  3. 重试前从负载均衡器中选出一个尚未尝试过的下游，并按指数退避加随机抖动等待
+//  4. 每次重试都要向重试预算申请额度，预算耗尽时直接返回最后一次的结果
+type Transport struct {
+	Base     http.RoundTripper        // 实际发送请求的 Transport，为空时使用 http.DefaultTransport
+	Balancer load_balance.LoadBalance // 重试时选择其他下游，为空时重试原下游
+	Budget   *Budget                  // 重试预算，为空时不限制
+	Config   Config
+}
+
+// NewTransport 新建带重试的 Transport，默认重试预算为请求数的 20%，每秒最少 1 次
+func NewTransport(base http.RoundTripper, balancer load_balance.LoadBalance, config Config) *Transport {
+	return &Transport{
+		Base:     base,
+		Balancer: balancer,
+		Budget:   NewBudget(0.2, 1),
+		Config:   config,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Budget != nil {
+		t.Budget.Deposit()
+	}
+	maxAttempts := t.Config.MaxAttempts
+	if !isIdempotent(req) || maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	// 不会重试的请求不缓冲请求体，gRPC 等流式请求边读边转发
+	var body []byte
+	if maxAttempts > 1 {
+		var replayable bool
+		var err error
+		if body, replayable, err = t.bufferBody(req); err != nil {
+			return nil, err
+		}
+		if !replayable {
+			maxAttempts = 1
+		}
+	}
+
+	tried := map[string]bool{}
+	host := req.URL.Host
+	for attempt := 1; ; attempt++ {
+		tried[host] = true
+		res, err := t.roundTrip(req, host, body, maxAttempts > 1)
+		last := attempt >= maxAttempts || req.Context().Err() != nil
+		if !last && t.shouldRetry(res, err) && (t.Budget == nil || t.Budget.Withdraw()) {
+			if res != nil {
+				drain(res.Body)
+			}
+			if !t.backoff(req.Context(), attempt) {
+				return nil, &Error{Attempts: attempt, Err: req.Context().Err()}
+			}
+			host = t.nextHost(req, host, tried)
+			continue
+		}
+		if err != nil {
+			return nil, &Error{Attempts: attempt, Err: err}
+		}
+		res.Header.Set(AttemptsHeader, strconv.Itoa(attempt))
+		return res, nil
+	}
+}
+
+// roundTrip 向指定下游发送一次请求
+//
+// 可重试的请求，每次尝试等待响应头的时间不超过 PerTryTimeout，超时后换下游重试；
+// 拿到响应头后不再限制，流式响应体的读取时间不受 PerTryTimeout 影响
+func (t *Transport) roundTrip(req *http.Request, host string, body []byte, retryable bool) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	var timer *time.Timer
+	if retryable && t.Config.PerTryTimeout > 0 {
+		timer = time.AfterFunc(t.Config.PerTryTimeout, cancel)
+	}
+	out := req.Clone(ctx)
+	out.URL.Host = host
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	res, err := base.RoundTrip(out)
+	if timer != nil && !timer.Stop() && req.Context().Err() == nil {
+		// 定时器已经触发：即使刚拿到响应，其上下文也已取消，按超时处理
+		if err == nil {
+			res.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("retry: no response within per-try timeout %v: %w", t.Config.PerTryTimeout, context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 响应体读取完毕关闭时才能取消上下文，否则会中断响应体的读取
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+func (t *Transport) shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	for _, code := range t.Config.RetryOn {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 指数退避 + 全随机抖动：等待 [0, min(MaxBackoff, BaseBackoff*2^(attempt-1))) 的随机时间
+func (t *Transport) backoff(ctx context.Context, attempt int) bool {
+	if t.Config.BaseBackoff <= 0 {
+		return ctx.Err() == nil
+	}
+	ceiling := t.Config.BaseBackoff << (attempt - 1)
+	if t.Config.MaxBackoff > 0 && (ceiling > t.Config.MaxBackoff || ceiling <= 0) {
+		ceiling = t.Config.MaxBackoff
+	}
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(ceiling) + 1)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// nextHost 从负载均衡器中选出一个尚未尝试过的下游，全部尝试过时返回负载均衡器的结果
+func (t *Transport) nextHost(req *http.Request, current string, tried map[string]bool) string {
+	if t.Balancer == nil {
+		return current
+	}
+	key, _, _ := net.SplitHostPort(req.RemoteAddr)
+	next := current
+	for i := 0; i < 2*len(tried)+1; i++ {
+		addr, err := t.Balancer.Get(key)
+		if err != nil {
+			return next
+		}
+		next = hostOf(addr)
+		if !tried[next] {
+			return next
+		}
+	}
+	return next
+}
+
+// bufferBody 缓冲请求体以便重放，超出 MaxBodySize 的请求体恢复原样并标记为不可重放
+func (t *Transport) bufferBody(req *http.Request) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if req.ContentLength > t.Config.MaxBodySize {
+		return nil, false, nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(req.Body, t.Config.MaxBodySize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(buf)) > t.Config.MaxBodySize {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return nil, false, nil
+	}
+	req.Body.Close()
+	return buf, true, nil
+}
+
+// isIdempotent RFC 9110 定义的幂等方法，或携带了 Idempotency-Key 的请求
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// hostOf 负载均衡器中的地址可能带协议，如 http://127.0.0.1:8001
+func hostOf(addr string) string {
+	addr = strings.TrimPrefix(addr, "http://")
+	return strings.TrimPrefix(addr, "https://")
+}
+
+func drain(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 4<<10))
+	body.Close()
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
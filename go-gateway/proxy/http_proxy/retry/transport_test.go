@@ -0,0 +1,127 @@
+package retry
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sen-golang-study/go-gateway/load_balance"
+	"strings"
+	"testing"
+	"time"
+)
+
+func closedAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+// TestTransport_RetryOtherUpstream 测试第一个下游拒绝连接时，重试到负载均衡器中的另一个下游
+func TestTransport_RetryOtherUpstream(t *testing.T) {
+	var gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	down := closedAddr(t)
+
+	config := DefaultConfig()
+	config.BaseBackoff = time.Millisecond
+	transport := NewTransport(http.DefaultTransport, load_balance.NewRoundRobinBalance(down, upstreamURL.Host), config)
+
+	req := httptest.NewRequest(http.MethodPut, "http://"+down+"/realserver", strings.NewReader("payload"))
+	req.RequestURI = ""
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get(AttemptsHeader) != "2" {
+		t.Errorf("want 2 attempts, got %s", res.Header.Get(AttemptsHeader))
+	}
+	if gotBody != "payload" {
+		t.Errorf("body not replayed, got %q", gotBody)
+	}
+}
+
+// TestTransport_NonIdempotent 测试 POST 请求不重试
+func TestTransport_NonIdempotent(t *testing.T) {
+	down := closedAddr(t)
+	transport := NewTransport(http.DefaultTransport, load_balance.NewRoundRobinBalance(down), DefaultConfig())
+	req := httptest.NewRequest(http.MethodPost, "http://"+down+"/", strings.NewReader("x"))
+	req.RequestURI = ""
+	_, err := transport.RoundTrip(req)
+	if err == nil || Attempts(err) != 1 {
+		t.Errorf("want single failed attempt, got %v", err)
+	}
+}
+
+// TestTransport_PerTryTimeout 测试 PerTryTimeout 只限制等待响应头的时间，不中断流式响应体
+func TestTransport_PerTryTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	streaming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a"))
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("b"))
+	}))
+	defer streaming.Close()
+	slowURL, _ := url.Parse(slow.URL)
+	streamingURL, _ := url.Parse(streaming.URL)
+
+	config := DefaultConfig()
+	config.PerTryTimeout = 50 * time.Millisecond
+	config.BaseBackoff = time.Millisecond
+	transport := NewTransport(http.DefaultTransport, load_balance.NewRoundRobinBalance(streamingURL.Host), config)
+	transport.Budget = nil
+
+	for _, c := range []struct{ method, host string }{
+		{http.MethodGet, slowURL.Host}, // 等待响应头超时，重试到 streaming
+		{http.MethodGet, streamingURL.Host},
+		{http.MethodPost, streamingURL.Host}, // 不重试的请求不限制
+	} {
+		req := httptest.NewRequest(c.method, "http://"+c.host+"/", nil)
+		req.RequestURI = ""
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.method, c.host, err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || string(body) != "ab" {
+			t.Errorf("%s %s: want full body, got %q %v", c.method, c.host, body, err)
+		}
+	}
+}
+
+// TestBudget 测试重试预算按请求数比例限制重试次数
+func TestBudget(t *testing.T) {
+	budget := NewBudget(0.1, 0)
+	for i := 0; i < 20; i++ {
+		budget.Deposit()
+	}
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if budget.Withdraw() {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("want 2 retries allowed, got %d", allowed)
+	}
+}
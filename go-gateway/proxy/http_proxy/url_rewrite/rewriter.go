@@ -0,0 +1,197 @@
+package url_rewrite
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sen-golang-study/go-gateway/middleware"
+	"strings"
+)
+
+// Condition 规则生效的前提条件：请求头匹配正则，Header 为 "Host" 时匹配请求的 Host
+type Condition struct {
+	Header  string
+	Pattern string
+	Negate  bool // 为 true 时请求头不匹配才生效
+}
+
+// Rule URL 改写规则，语义参考 nginx rewrite
+//
+//	Pattern:     匹配转义后的请求路径的正则，如 ^/api/v1/(.*)
+//	Replacement: 改写后的地址，可以用 $1、${name} 引用捕获组，如 /$1。
+//	             可以带查询参数（如 /search?q=$1），与原有查询参数合并；以 ? 结尾时丢弃原有查询参数
+//	Redirect:    301/302/307/308 时不再转发给下游，直接返回重定向
+//	Last:        匹配后停止执行后续规则，否则继续用改写后的路径匹配后续规则
+type Rule struct {
+	Pattern     string
+	Replacement string
+	Conditions  []Condition
+	AddQuery    map[string]string // 追加的查询参数，取值可引用捕获组
+	RemoveQuery []string          // 删除的查询参数
+	Redirect    int
+	Last        bool
+}
+
+// Redirect 改写结果为重定向
+type Redirect struct {
+	Code     int
+	Location string
+}
+
+// Rewriter 按顺序执行 URL 改写规则
+type Rewriter struct {
+	rules []*compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	pattern    *regexp.Regexp
+	conditions []compiledCondition
+}
+
+type compiledCondition struct {
+	Condition
+	pattern *regexp.Regexp
+}
+
+// NewRewriter 新建 URL 改写器，正则或重定向状态码无效时返回错误
+func NewRewriter(rules ...Rule) (*Rewriter, error) {
+	r := &Rewriter{}
+	for i, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("url_rewrite: rule %d: %w", i, err)
+		}
+		switch rule.Redirect {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("url_rewrite: rule %d: invalid redirect code %d", i, rule.Redirect)
+		}
+		compiled := &compiledRule{Rule: rule, pattern: pattern}
+		for _, cond := range rule.Conditions {
+			condPattern, err := regexp.Compile(cond.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("url_rewrite: rule %d condition %s: %w", i, cond.Header, err)
+			}
+			compiled.conditions = append(compiled.conditions, compiledCondition{Condition: cond, pattern: condPattern})
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// Rewrite 原地改写请求的 URL，命中重定向规则时返回重定向，请求保持改写到该规则之前的状态
+//
+// 规则匹配的是转义后的路径（EscapedPath），%2F、%3F 等编码保持原样，捕获组不会改变路径层级，也不会注入查询参数；
+// 查询参数只来自 Replacement 中 ? 之后的模板，引用的捕获组解码后作为参数值重新编码
+func (r *Rewriter) Rewrite(req *http.Request) *Redirect {
+	for _, rule := range r.rules {
+		escapedPath := req.URL.EscapedPath()
+		match := rule.pattern.FindStringSubmatchIndex(escapedPath)
+		if match == nil || !rule.conditionsMet(req) {
+			continue
+		}
+		expand := func(template string) string {
+			return string(rule.pattern.ExpandString(nil, template, escapedPath, match))
+		}
+		// expandValue 展开查询参数模板，捕获组来自转义后的路径，解码为参数的原始值
+		expandValue := func(template string) string {
+			value := expand(template)
+			if decoded, err := url.PathUnescape(value); err == nil {
+				return decoded
+			}
+			return value
+		}
+
+		pathTemplate, queryTemplate, hasQuery := strings.Cut(rule.Replacement, "?")
+		path := expand(pathTemplate)
+		query := req.URL.Query()
+		if hasQuery && queryTemplate == "" {
+			query = url.Values{}
+		} else if hasQuery {
+			extra := url.Values{}
+			for _, pair := range strings.Split(queryTemplate, "&") {
+				if pair == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(pair, "=")
+				extra.Add(expandValue(key), expandValue(value))
+			}
+			for k, vs := range extra {
+				query[k] = vs
+			}
+		}
+		for k, v := range rule.AddQuery {
+			query.Set(k, expandValue(v))
+		}
+		changed := hasQuery || len(rule.AddQuery) > 0
+		for _, k := range rule.RemoveQuery {
+			if query.Has(k) {
+				query.Del(k)
+				changed = true
+			}
+		}
+
+		// 查询参数没有变化时保留原始顺序和编码
+		encoded := req.URL.RawQuery
+		if changed {
+			encoded = query.Encode()
+		}
+
+		if rule.Redirect != 0 {
+			location := path
+			if encoded != "" {
+				location += "?" + encoded
+			}
+			return &Redirect{Code: rule.Redirect, Location: location}
+		}
+		// RawPath 保留转义形式，%2F 不会变成 /
+		if decoded, err := url.PathUnescape(path); err == nil {
+			req.URL.Path, req.URL.RawPath = decoded, path
+		} else {
+			req.URL.Path, req.URL.RawPath = path, ""
+		}
+		req.URL.RawQuery = encoded
+		if rule.Last {
+			break
+		}
+	}
+	return nil
+}
+
+func (rule *compiledRule) conditionsMet(req *http.Request) bool {
+	for _, cond := range rule.conditions {
+		value := req.Header.Get(cond.Header)
+		if strings.EqualFold(cond.Header, "Host") {
+			value = req.Host
+		}
+		if cond.pattern.MatchString(value) == cond.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler 在请求交给 next（通常是 ReverseProxy）之前改写 URL，命中重定向规则时直接返回重定向
+func (r *Rewriter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if redirect := r.Rewrite(req); redirect != nil {
+			http.Redirect(w, req, redirect.Location, redirect.Code)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// HTTPMiddleware URL 改写中间件，挂在路由组上即为该路由的改写规则
+func HTTPMiddleware(r *Rewriter) middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		if redirect := r.Rewrite(c.Req); redirect != nil {
+			http.Redirect(c.Rw, c.Req, redirect.Location, redirect.Code)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
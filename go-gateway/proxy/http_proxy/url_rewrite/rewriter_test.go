@@ -0,0 +1,88 @@
+package url_rewrite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRewriter 测试捕获组改写、查询参数增删、条件改写、last 标志和重定向
+func TestRewriter(t *testing.T) {
+	r, err := NewRewriter(
+		Rule{Pattern: "^/old/(.*)$", Replacement: "/new/$1", Redirect: http.StatusMovedPermanently},
+		Rule{Pattern: "^/beta/(.*)$", Replacement: "/canary/$1", Last: true,
+			Conditions: []Condition{{Header: "X-Canary", Pattern: "^on$"}}},
+		Rule{Pattern: "^/api/v1/(.*)$", Replacement: "/$1", RemoveQuery: []string{"debug"}},
+		Rule{Pattern: "^/search/(?P<word>[^/]+)$", Replacement: "/search?q=${word}"},
+		Rule{Pattern: "^/users/(\\d+)$", Replacement: "/user?", AddQuery: map[string]string{"id": "$1"}, Last: true},
+		Rule{Pattern: "^/user$", Replacement: "/never"},
+		Rule{Pattern: "^/internal/", Replacement: "/", Redirect: http.StatusFound,
+			Conditions: []Condition{{Header: "Host", Pattern: `\.internal$`, Negate: true}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		url, header, host string
+		want              string
+		redirect          int
+	}{
+		{"/old/a/b?x=1", "", "", "/new/a/b?x=1", http.StatusMovedPermanently},
+		{"/beta/a", "on", "", "/canary/a", 0},
+		{"/beta/a", "", "", "/beta/a", 0},
+		{"/api/v1/orders?b=2&a=1", "", "", "/orders?b=2&a=1", 0},
+		{"/api/v1/orders?debug=1&a=1", "", "", "/orders?a=1", 0},
+		{"/api/v1/search/go?page=2", "", "", "/search?page=2&q=go", 0},
+		{"/users/42?x=1", "", "", "/user?id=42", 0},
+		{"/internal/metrics", "", "gw.example.com", "/", http.StatusFound},
+		{"/internal/metrics", "", "gw.internal", "/internal/metrics", 0},
+		// 编码的 ? 和 / 保持原样，不会注入查询参数或改变路径层级
+		{"/api/v1/x%3Fadmin=1", "", "", "/x%3Fadmin=1", 0},
+		{"/api/v1/a%2Fb", "", "", "/a%2Fb", 0},
+		{"/api/v1/search/a&admin=1", "", "", "/search?q=a%26admin%3D1", 0},
+		{"/api/v1/search/a%20b", "", "", "/search?q=a+b", 0},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.url, nil)
+		req.Header.Set("X-Canary", c.header)
+		if c.host != "" {
+			req.Host = c.host
+		}
+		redirect := r.Rewrite(req)
+		switch {
+		case c.redirect != 0 && (redirect == nil || redirect.Code != c.redirect || redirect.Location != c.want):
+			t.Errorf("%s: want redirect %d %s, got %+v", c.url, c.redirect, c.want, redirect)
+		case c.redirect == 0 && redirect != nil:
+			t.Errorf("%s: unexpected redirect %+v", c.url, redirect)
+		case c.redirect == 0 && req.URL.RequestURI() != c.want:
+			t.Errorf("%s: want %s, got %s", c.url, c.want, req.URL.RequestURI())
+		}
+	}
+
+	if _, err := NewRewriter(Rule{Pattern: "^/", Replacement: "/", Redirect: 303}); err == nil {
+		t.Error("want error for unsupported redirect code")
+	}
+}
+
+// TestHandler 测试重定向规则不访问下游
+func TestHandler(t *testing.T) {
+	r, _ := NewRewriter(
+		Rule{Pattern: "^/docs$", Replacement: "/docs/", Redirect: http.StatusPermanentRedirect},
+		Rule{Pattern: "^/v2/(.*)$", Replacement: "/$1"},
+	)
+	var upstreamPath string
+	handler := r.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		upstreamPath = req.URL.Path
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/docs", nil))
+	if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != "/docs/" || upstreamPath != "" {
+		t.Errorf("want 308 to /docs/ without upstream, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v2/items", nil))
+	if upstreamPath != "/items" {
+		t.Errorf("want upstream path /items, got %q", upstreamPath)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sen-golang-study/go-gateway/circuit_breaker"
 	"sen-golang-study/go-gateway/proxy/tcp_proxy"
 	"syscall"
 )
@@ -31,17 +32,25 @@ func main() {
 		tcpServer.ListenAndServe()
 	}()
 
-	// 启动TCP代理服务器
+	// 启动TCP代理服务器：将 8081 端口收到的连接代理到 8000 端口的TCP服务器
 	go func() {
-		var proxyServerAddr = "192.168.110.11:8081"
+		var proxyServerAddr = "127.0.0.1:8081"
 
-		tcpServer := tcp_proxy.NewSingleHostReverseProxy(proxyServerAddr)
+		// 下游拨号连续失败时熔断，熔断期间直接关闭客户端连接，不再拨号
+		proxy := tcp_proxy.NewSingleHostReverseProxy("127.0.0.1:8000")
+		proxy.DialContext = circuit_breaker.NewGroup(circuit_breaker.DefaultConfig()).DialContext(nil)
+
+		tcpServer := &tcp_proxy.TCPServer{
+			Addr:    proxyServerAddr,
+			Handler: proxy,
+		}
 
 		// 开始监听并提供服务
-		log.Println("Starting TCP server at " + proxyServerAddr)
+		log.Println("Starting TCP proxy server at " + proxyServerAddr)
 		tcpServer.ListenAndServe()
 	}()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
 }
@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"net"
 	"runtime"
+	"time"
 )
 
 type TCPConn struct {
+	id            uint64
 	server        *TCPServer
 	cancelCtx     context.CancelFunc
 	readWriteConn net.Conn
 	remoteAddr    string
+	since         time.Time
 }
 
 func (c *TCPConn) close() {
@@ -33,6 +36,13 @@ func (c *TCPConn) serve(ctx context.Context) {
 	}()
 	c.remoteAddr = c.readWriteConn.RemoteAddr().String()
 	ctx = context.WithValue(ctx, LocalAddrContextKey, c.readWriteConn.LocalAddr())
+	// 登记为活跃连接，可以通过 TCPServer.CloseConn 强制关闭
+	ctx, c.cancelCtx = context.WithCancel(ctx)
+	c.server.trackConn(c, true)
+	defer func() {
+		c.server.trackConn(c, false)
+		c.cancelCtx()
+	}()
 	if c.server.Handler == nil {
 		panic("handler empty")
 	}
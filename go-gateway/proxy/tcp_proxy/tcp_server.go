@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,10 +33,20 @@ type TCPServer struct {
 	WriteTimeout     time.Duration //写操作的超时时间
 	KeepAliveTimeout time.Duration //长连接断开后的超时时间
 
-	mu         sync.Mutex         //连接初始化、关闭等动作需要加锁
-	doneChan   chan struct{}      //服务已完成时，doneChan监听信号
-	isShutdown int32              //服务终止状态：0-未关闭，1-已关闭
-	listener   *onceCloseListener //服务器监听器，使用完成后将进程关闭
+	mu         sync.Mutex            //连接初始化、关闭等动作需要加锁
+	doneChan   chan struct{}         //服务已完成时，doneChan监听信号
+	isShutdown int32                 //服务终止状态：0-未关闭，1-已关闭
+	listener   *onceCloseListener    //服务器监听器，使用完成后将进程关闭
+	activeConn map[*TCPConn]struct{} //正在处理的连接
+	nextConnID atomic.Uint64         //连接编号
+}
+
+// ConnInfo 正在处理的连接信息
+type ConnInfo struct {
+	ID         uint64    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	LocalAddr  string    `json:"local_addr"`
+	Since      time.Time `json:"since"`
 }
 
 func (srv *TCPServer) ListenAndServe() error {
@@ -74,10 +85,17 @@ func (oc *onceCloseListener) close() { oc.closeErr = oc.Listener.Close() }
 // Close 关闭TCP Server
 func (srv *TCPServer) Close() error {
 	// 可能存在其它协程同时去关闭TCP Server
-	atomic.StoreInt32(&srv.isShutdown, 1) // 用原子操作修改服务的状态
-	close(srv.doneChan)                   // 关闭监听服务完成的信号Channel
-	srv.listener.close()
-
+	if !atomic.CompareAndSwapInt32(&srv.isShutdown, 0, 1) { // 用原子操作修改服务的状态，重复关闭直接返回
+		return nil
+	}
+	srv.getDoneChan()   // 确保doneChan已初始化
+	close(srv.doneChan) // 关闭监听服务完成的信号Channel
+	srv.mu.Lock()
+	listener := srv.listener
+	srv.mu.Unlock()
+	if listener != nil {
+		return listener.Close()
+	}
 	return nil
 }
 
@@ -87,7 +105,9 @@ func (srv *TCPServer) shuttingDown() bool {
 }
 
 func (srv *TCPServer) Serve(l net.Listener) error {
+	srv.mu.Lock()
 	srv.listener = &onceCloseListener{Listener: l}
+	srv.mu.Unlock()
 	defer func(listener *onceCloseListener) {
 		err := listener.Close()
 		if err != nil {
@@ -116,6 +136,55 @@ func (srv *TCPServer) Serve(l net.Listener) error {
 	}
 }
 
+// Conns 返回正在处理的连接，按连接编号排序
+func (srv *TCPServer) Conns() []ConnInfo {
+	srv.mu.Lock()
+	conns := make([]ConnInfo, 0, len(srv.activeConn))
+	for c := range srv.activeConn {
+		conns = append(conns, ConnInfo{
+			ID:         c.id,
+			RemoteAddr: c.remoteAddr,
+			LocalAddr:  c.readWriteConn.LocalAddr().String(),
+			Since:      c.since,
+		})
+	}
+	srv.mu.Unlock()
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	return conns
+}
+
+// CloseConn 强制关闭指定编号的连接，连接不存在时返回 false
+func (srv *TCPServer) CloseConn(id uint64) bool {
+	srv.mu.Lock()
+	var target *TCPConn
+	for c := range srv.activeConn {
+		if c.id == id {
+			target = c
+			break
+		}
+	}
+	srv.mu.Unlock()
+	if target == nil {
+		return false
+	}
+	target.cancelCtx()
+	target.close()
+	return true
+}
+
+func (srv *TCPServer) trackConn(c *TCPConn, add bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.activeConn == nil {
+		srv.activeConn = make(map[*TCPConn]struct{})
+	}
+	if add {
+		srv.activeConn[c] = struct{}{}
+	} else {
+		delete(srv.activeConn, c)
+	}
+}
+
 func (srv *TCPServer) getDoneChan() <-chan struct{} {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
@@ -129,9 +198,11 @@ func (srv *TCPServer) getDoneChan() <-chan struct{} {
 // 对监听到的连接进行再次封装，来支持我们的额外设置的参数比如ReadTimeout、WriteTimeout和KeepAliveTimeout等
 func (srv *TCPServer) newConn(readWriteConn net.Conn) *TCPConn {
 	tcpConn := &TCPConn{
+		id:            srv.nextConnID.Add(1),
 		server:        srv,
 		readWriteConn: readWriteConn,
 		remoteAddr:    readWriteConn.RemoteAddr().String(),
+		since:         time.Now(),
 	}
 	// 设置参数
 	if d := tcpConn.server.ReadTimeout; d != 0 {
@@ -1,12 +1,79 @@
 package tcp_proxy
 
-type TCPProxy struct {
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// TCPReverseProxy TCP反向代理，实现 TCPHandler
+//
+// 代理流程：
+//  1. 拨号连接下游服务器
+//  2. 双向拷贝客户端连接与下游连接的数据
+//  3. 任意一方关闭或出错时结束代理，关闭两端连接
+type TCPReverseProxy struct {
+	Addr            string        // 下游服务器地址
+	DialTimeout     time.Duration // 拨号超时时间
+	KeepAlivePeriod time.Duration // 下游连接的长连接探活周期
+
+	// DialContext 自定义拨号函数，为空时使用 net.Dialer
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+	// OnDialError 拨号失败的回调，为空时只打印日志
+	OnDialError func(src net.Conn, dstDialErr error)
+}
+
+// NewSingleHostReverseProxy 新建代理到单个下游服务器的TCP反向代理
+func NewSingleHostReverseProxy(addr string) *TCPReverseProxy {
+	return &TCPReverseProxy{
+		Addr:            addr,
+		DialTimeout:     10 * time.Second,
+		KeepAlivePeriod: time.Hour,
+	}
 }
 
-func (p TCPProxy) ListenAndServe() {
+func (p *TCPReverseProxy) Serve(ctx context.Context, src net.Conn) {
+	dst, err := p.dial(ctx)
+	if err != nil {
+		p.onDialError(src, err)
+		return
+	}
+	defer dst.Close()
+
+	errc := make(chan error, 2)
+	go p.proxyCopy(errc, src, dst)
+	go p.proxyCopy(errc, dst, src)
+	select {
+	case <-errc:
+	case <-ctx.Done():
+	}
+}
+
+func (p *TCPReverseProxy) dial(ctx context.Context) (net.Conn, error) {
+	if p.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.DialTimeout)
+		defer cancel()
+	}
+	if p.DialContext != nil {
+		return p.DialContext(ctx, "tcp", p.Addr)
+	}
+	dialer := &net.Dialer{KeepAlive: p.KeepAlivePeriod}
+	return dialer.DialContext(ctx, "tcp", p.Addr)
+}
 
+func (p *TCPReverseProxy) onDialError(src net.Conn, err error) {
+	if p.OnDialError != nil {
+		p.OnDialError(src, err)
+		return
+	}
+	log.Printf("tcp_proxy: dial %s for %v error: %v", p.Addr, src.RemoteAddr(), err)
 }
 
-func NewSingleHostReverseProxy(addr string) TCPProxy {
-	return TCPProxy{}
+// proxyCopy 将 src 的数据拷贝到 dst，结束时通知 errc
+func (p *TCPReverseProxy) proxyCopy(errc chan<- error, dst, src net.Conn) {
+	_, err := io.Copy(dst, src)
+	errc <- err
 }
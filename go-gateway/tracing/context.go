@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"strings"
+)
+
+var ErrInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+// TraceID 16 字节的链路ID，全零无效
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid 非全零即有效
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID 8 字节的 span ID，全零无效
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid 非全零即有效
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// TraceFlags traceparent 的 trace-flags 字段
+type TraceFlags byte
+
+// FlagsSampled 采样标记，上游已采样时下游跟随采样
+const FlagsSampled TraceFlags = 0x01
+
+// SpanContext 需要跨进程传递的链路上下文，对应 W3C traceparent/tracestate
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      TraceFlags
+	TraceState string
+	Remote     bool // 是否从上游传入
+}
+
+// IsValid TraceID 和 SpanID 都有效
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// IsSampled 是否被采样
+func (sc SpanContext) IsSampled() bool { return sc.Flags&FlagsSampled != 0 }
+
+// Traceparent 按 W3C 格式输出：00-<trace-id>-<parent-id>-<trace-flags>
+func (sc SpanContext) Traceparent() string {
+	var b [55]byte
+	copy(b[:], "00-")
+	hex.Encode(b[3:35], sc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], sc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:55], []byte{byte(sc.Flags)})
+	return string(b[:])
+}
+
+// ParseTraceparent 解析 traceparent，高版本按 00 版本的前缀解析，兼容以后的扩展字段
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	version, ok := decodeLowerHex(s[:2])
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(s) != 55) || (len(s) > 55 && s[55] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+	traceID, ok1 := decodeLowerHex(s[3:35])
+	spanID, ok2 := decodeLowerHex(s[36:52])
+	flags, ok3 := decodeLowerHex(s[53:55])
+	if !ok1 || !ok2 || !ok3 {
+		return sc, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = TraceFlags(flags[0])
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeLowerHex 规范只允许小写十六进制
+func decodeLowerHex(s string) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// maxTracestateMembers tracestate 最多 32 个成员
+const maxTracestateMembers = 32
+
+// normalizeTracestate 合并多个 tracestate 头并去掉空成员，成员过多时整体丢弃
+func normalizeTracestate(values []string) string {
+	var members []string
+	for _, v := range values {
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				if !strings.Contains(m, "=") {
+					return ""
+				}
+				members = append(members, m)
+			}
+		}
+	}
+	if len(members) > maxTracestateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// SpanFromContext 返回 ctx 中当前的 span，没有时返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext 返回 ctx 中当前的链路上下文：优先取本进程的 span，其次取上游传入的
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// ContextWithRemoteSpanContext 把上游传入的链路上下文放入 ctx，之后创建的 span 以它为父 span
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	// 屏蔽 ctx 中已有的本地 span，保证上游传入的链路上下文生效
+	ctx = context.WithValue(ctx, spanKey{}, (*Span)(nil))
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter 把结束的 span 导出到外部系统，由 Tracer 的后台协程批量调用
+type Exporter interface {
+	Export(ctx context.Context, spans []*SpanData) error
+}
+
+// WriterExporter 每个 span 输出一行 JSON，w 可以是 os.Stdout 或 access_log.RotatingFile
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter 新建输出 JSON 行的 Exporter
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+func (e *WriterExporter) Export(ctx context.Context, spans []*SpanData) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, span := range spans {
+		if err := enc.Encode(jsonSpan(span)); err != nil {
+			return err
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func jsonSpan(s *SpanData) any {
+	var parent string
+	if s.ParentSpanID.IsValid() {
+		parent = s.ParentSpanID.String()
+	}
+	type event struct {
+		Name       string         `json:"name"`
+		Time       time.Time      `json:"time"`
+		Attributes map[string]any `json:"attributes,omitempty"`
+	}
+	events := make([]event, len(s.Events))
+	for i, e := range s.Events {
+		events[i] = event{e.Name, e.Time, e.Attributes}
+	}
+	return struct {
+		Service    string         `json:"service"`
+		TraceID    string         `json:"trace_id"`
+		SpanID     string         `json:"span_id"`
+		ParentID   string         `json:"parent_span_id,omitempty"`
+		Name       string         `json:"name"`
+		Kind       string         `json:"kind"`
+		Start      time.Time      `json:"start"`
+		DurationMs float64        `json:"duration_ms"`
+		Attributes map[string]any `json:"attributes,omitempty"`
+		Events     []event        `json:"events,omitempty"`
+		Error      string         `json:"error,omitempty"`
+	}{
+		s.Service, s.SpanContext.TraceID.String(), s.SpanContext.SpanID.String(), parent,
+		s.Name, s.Kind.String(), s.Start, float64(s.End.Sub(s.Start).Microseconds()) / 1000,
+		s.Attributes, events, errorMessage(s),
+	}
+}
+
+func errorMessage(s *SpanData) string {
+	if s.StatusCode != StatusError {
+		return ""
+	}
+	if s.StatusMessage == "" {
+		return "error"
+	}
+	return s.StatusMessage
+}
+
+// OTLPExporter 按 OTLP/HTTP 的 JSON 编码把 span 发送到 collector，如 http://127.0.0.1:4318/v1/traces
+type OTLPExporter struct {
+	Endpoint string
+	Headers  map[string]string // 额外的请求头，如认证信息
+	Client   *http.Client
+}
+
+// NewOTLPExporter 新建 OTLP/HTTP Exporter
+func NewOTLPExporter(endpoint string) *OTLPExporter {
+	return &OTLPExporter{Endpoint: endpoint, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*SpanData) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("tracing: otlp collector returned %s", res.Status)
+	}
+	return nil
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// otlpRequest 按服务名分组，转换为 ExportTraceServiceRequest 的 JSON 结构
+func otlpRequest(spans []*SpanData) map[string]any {
+	byService := make(map[string][]any)
+	for _, s := range spans {
+		byService[s.Service] = append(byService[s.Service], otlpSpan(s))
+	}
+	services := make([]string, 0, len(byService))
+	for service := range byService {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	resourceSpans := make([]any, 0, len(services))
+	for _, service := range services {
+		resourceSpans = append(resourceSpans, map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(map[string]any{"service.name": service})},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "sen-golang-study/go-gateway/tracing"},
+				"spans": byService[service],
+			}},
+		})
+	}
+	return map[string]any{"resourceSpans": resourceSpans}
+}
+
+func otlpSpan(s *SpanData) map[string]any {
+	span := map[string]any{
+		"traceId":           s.SpanContext.TraceID.String(),
+		"spanId":            s.SpanContext.SpanID.String(),
+		"name":              s.Name,
+		"kind":              int(s.Kind),
+		"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.Attributes),
+		"status":            map[string]any{"code": int(s.StatusCode), "message": s.StatusMessage},
+	}
+	if s.ParentSpanID.IsValid() {
+		span["parentSpanId"] = s.ParentSpanID.String()
+	}
+	if s.SpanContext.TraceState != "" {
+		span["traceState"] = s.SpanContext.TraceState
+	}
+	events := make([]any, len(s.Events))
+	for i, e := range s.Events {
+		events[i] = map[string]any{
+			"name":         e.Name,
+			"timeUnixNano": strconv.FormatInt(e.Time.UnixNano(), 10),
+			"attributes":   otlpAttributes(e.Attributes),
+		}
+	}
+	span["events"] = events
+	return span
+}
+
+// otlpAttributes 按 AnyValue 的 JSON 编码转换属性，int64 按规范编码为字符串
+func otlpAttributes(attributes map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		var value map[string]any
+		switch v := attributes[k].(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: value})
+	}
+	return kvs
+}
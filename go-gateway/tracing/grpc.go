@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+)
+
+// MetadataCarrier 把 gRPC metadata 适配为 Carrier，metadata 的键都是小写
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Values(key string) []string { return metadata.MD(c).Get(key) }
+func (c MetadataCarrier) Set(key, value string)      { metadata.MD(c).Set(key, value) }
+
+// UnaryClientInterceptor 为每次调用创建客户端 span，并把链路上下文注入请求的 metadata
+func (t *Tracer) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := t.startClient(ctx, method, cc.Target())
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endRPC(span, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor 流式调用的客户端 span，在流结束（收到 io.EOF 或错误）时结束
+func (t *Tracer) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := t.startClient(ctx, method, cc.Target())
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			endRPC(span, err)
+			return nil, err
+		}
+		return &tracedClientStream{ClientStream: stream, span: span}, nil
+	}
+}
+
+func (t *Tracer) startClient(ctx context.Context, method, target string) (context.Context, *Span) {
+	ctx, span := t.Start(ctx, method, SpanKindClient)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", method)
+	span.SetAttribute("net.peer.name", target)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	Inject(ctx, MetadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// UnaryServerInterceptor 从请求的 metadata 中继续链路，为每次调用创建服务端 span
+func (t *Tracer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, span := t.startServerRPC(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endRPC(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor 流式调用的服务端 span
+func (t *Tracer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := t.startServerRPC(ss.Context(), info.FullMethod)
+		err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+		endRPC(span, err)
+		return err
+	}
+}
+
+func (t *Tracer) startServerRPC(ctx context.Context, method string) (context.Context, *Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = Extract(ctx, MetadataCarrier(md))
+	}
+	ctx, span := t.Start(ctx, method, SpanKindServer)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", method)
+	return ctx, span
+}
+
+// endRPC 记录 gRPC 状态码并结束 span
+func endRPC(span *Span, err error) {
+	code := status.Code(err)
+	span.SetAttribute("rpc.grpc.status_code", int(code))
+	if err != nil {
+		span.SetStatus(StatusError, code.String()+": "+status.Convert(err).Message())
+	}
+	span.End()
+}
+
+type tracedClientStream struct {
+	grpc.ClientStream
+	span *Span
+	once sync.Once
+}
+
+func (s *tracedClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		s.once.Do(func() { endRPC(s.span, nil) })
+	} else if err != nil {
+		s.once.Do(func() { endRPC(s.span, err) })
+	}
+	return err
+}
+
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context { return s.ctx }
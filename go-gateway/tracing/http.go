@@ -0,0 +1,214 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sen-golang-study/go-gateway/middleware"
+	"sen-golang-study/go-gateway/middleware/request_id"
+	"sync"
+	"time"
+)
+
+// Handler 包装 http.Handler：继续上游传入的链路或开始新链路，为每个请求创建服务端 span，
+// 并把网关的链路上下文写回请求头，未使用 Transport 时下游也能收到
+func (t *Tracer) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req, span := t.startServer(req)
+		rw := &statusWriter{ResponseWriter: w}
+		defer func() { endServer(span, rw.status) }()
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// HTTPMiddleware 链路追踪中间件，放在中间件链最前面
+func (t *Tracer) HTTPMiddleware() middleware.HandlerFunc {
+	return func(c *middleware.SliceRouterContext) {
+		req, span := t.startServer(c.Req)
+		w := c.Rw
+		rw := &statusWriter{ResponseWriter: w}
+		c.Req, c.Ctx, c.Rw = req, req.Context(), rw
+		c.Next()
+		c.Rw = w
+		endServer(span, rw.status)
+	}
+}
+
+func (t *Tracer) startServer(req *http.Request) (*http.Request, *Span) {
+	ctx := Extract(req.Context(), HeaderCarrier(req.Header))
+	ctx, span := t.Start(ctx, "HTTP "+req.Method, SpanKindServer)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.RequestURI())
+	span.SetAttribute("http.host", req.Host)
+	span.SetAttribute("net.peer.addr", req.RemoteAddr)
+	if ua := req.UserAgent(); ua != "" {
+		span.SetAttribute("http.user_agent", ua)
+	}
+	if id := request_id.FromContext(ctx); id != "" {
+		span.SetAttribute("request.id", id)
+	}
+	Inject(ctx, HeaderCarrier(req.Header))
+	return req.WithContext(ctx), span
+}
+
+func endServer(span *Span, status int) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	span.SetAttribute("http.status_code", status)
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(StatusError, http.StatusText(status))
+	}
+	span.End()
+}
+
+// Transport 为每次下游请求创建客户端 span，通过 httptrace 记录拨号、TLS 握手和首字节耗时，
+// 并把 traceparent 注入下游请求头；放在重试、对冲 Transport 之下，每次尝试一个 span。
+// span 在收到响应头时结束，不包含转发响应体的时间
+type Transport struct {
+	Base   http.RoundTripper
+	Tracer *Tracer
+}
+
+// NewTransport 新建链路追踪 Transport
+func (t *Tracer) NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base, Tracer: t}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := t.Tracer.Start(req.Context(), "proxy "+req.URL.Host, SpanKindClient)
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	span.SetAttribute("net.peer.name", req.URL.Host)
+
+	ctx = httptrace.WithClientTrace(ctx, clientTrace(span))
+	// RoundTripper 不能修改传入的请求，注入前先复制
+	out := req.Clone(ctx)
+	Inject(ctx, HeaderCarrier(out.Header))
+	res, err := base.RoundTrip(out)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", res.StatusCode)
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(StatusError, res.Status)
+	}
+	return res, nil
+}
+
+// clientTrace 把连接过程记录为 span 事件，耗时记录为属性
+func clientTrace(span *Span) *httptrace.ClientTrace {
+	// 回调可能在其他协程执行
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart, wroteRequest time.Time
+	since := func(start *time.Time) float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return float64(time.Since(*start).Microseconds()) / 1000
+	}
+	mark := func(start *time.Time) {
+		mu.Lock()
+		*start = time.Now()
+		mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.AddEvent("got_conn", map[string]any{"reused": info.Reused, "remote_addr": info.Conn.RemoteAddr().String()})
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { mark(&dnsStart) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			span.SetAttribute("net.dns_ms", since(&dnsStart))
+		},
+		ConnectStart: func(string, string) { mark(&connectStart) },
+		ConnectDone: func(network, addr string, err error) {
+			span.SetAttribute("net.dial_ms", since(&connectStart))
+			span.AddEvent("connect_done", withError(map[string]any{"addr": addr}, err))
+		},
+		TLSHandshakeStart: func() { mark(&tlsStart) },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			span.SetAttribute("tls.handshake_ms", since(&tlsStart))
+			span.AddEvent("tls_handshake_done", withError(map[string]any{"version": tls.VersionName(state.Version)}, err))
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mark(&wroteRequest)
+			span.AddEvent("wrote_request", nil)
+		},
+		GotFirstResponseByte: func() {
+			span.SetAttribute("http.ttfb_ms", since(&wroteRequest))
+			span.AddEvent("first_response_byte", nil)
+		},
+	}
+}
+
+func withError(attributes map[string]any, err error) map[string]any {
+	if err != nil {
+		attributes["error"] = err.Error()
+	}
+	return attributes
+}
+
+// TCPMiddleware 为每个 TCP 会话创建服务端 span，TCP 没有可以携带链路上下文的请求头，每个会话开始一条新链路
+func (t *Tracer) TCPMiddleware() middleware.TCPHandlerFunc {
+	return func(c *middleware.TCPSliceRouterContext) {
+		ctx, span := t.Start(c.Ctx, "tcp session", SpanKindServer)
+		span.SetAttribute("net.peer.addr", c.Conn.RemoteAddr().String())
+		span.SetAttribute("net.host.addr", c.Conn.LocalAddr().String())
+		if id := request_id.FromContext(ctx); id != "" {
+			span.SetAttribute("request.id", id)
+		}
+		c.Ctx = ctx
+		defer span.End()
+		c.Next()
+	}
+}
+
+// DialContext 包装拨号函数，为连接下游创建客户端 span，dial 为空时使用 net.Dialer
+func (t *Tracer) DialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		ctx, span := t.Start(ctx, "dial "+address, SpanKindClient)
+		defer span.End()
+		span.SetAttribute("net.peer.addr", address)
+		conn, err := dial(ctx, network, address)
+		span.SetError(err)
+		return conn, err
+	}
+}
+
+// statusWriter 记录响应状态码
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
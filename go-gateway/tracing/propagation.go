@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// Carrier 承载链路上下文的键值容器，如 HTTP 请求头、gRPC metadata
+type Carrier interface {
+	Values(key string) []string
+	Set(key, value string)
+}
+
+// HeaderCarrier 把 http.Header 适配为 Carrier
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Values(key string) []string { return http.Header(c).Values(key) }
+func (c HeaderCarrier) Set(key, value string)      { http.Header(c).Set(key, value) }
+
+// Inject 把 ctx 中的链路上下文写入 carrier，没有链路上下文时不做任何事
+func Inject(ctx context.Context, carrier Carrier) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	carrier.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		carrier.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+// Extract 从 carrier 中解析上游传入的链路上下文并放入 ctx；traceparent 无效时忽略，tracestate 也一并丢弃
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	values := carrier.Values(TraceparentHeader)
+	if len(values) != 1 {
+		return ctx
+	}
+	sc, err := ParseTraceparent(values[0])
+	if err != nil {
+		return ctx
+	}
+	sc.TraceState = normalizeTracestate(carrier.Values(TracestateHeader))
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
@@ -0,0 +1,258 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpanKind span 类型，取值与 OTLP 一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// StatusCode span 状态，取值与 OTLP 一致
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Event span 内的时间点事件，如建立连接、收到首字节
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// SpanData 结束后交给 Exporter 导出的 span
+type SpanData struct {
+	Service       string
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	ParentSpanID  SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	Events        []Event
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Span 进行中的 span，方法可以并发调用
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext 返回需要向下游传递的链路上下文
+func (s *Span) SpanContext() SpanContext { return s.data.SpanContext }
+
+// SetAttribute 设置属性，值支持 string、bool、整数和浮点数；span 结束后的修改被忽略
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any)
+	}
+	s.data.Attributes[key] = value
+}
+
+// AddEvent 记录一个事件
+func (s *Span) AddEvent(name string, attributes map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: attributes})
+}
+
+// SetStatus 设置 span 状态
+func (s *Span) SetStatus(code StatusCode, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.StatusCode, s.data.StatusMessage = code, message
+	}
+}
+
+// SetError 把 span 标记为失败，err 为空时不做任何事
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End 结束 span，采样的 span 交给 Tracer 异步导出，多次调用只生效一次
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if data.SpanContext.IsSampled() {
+		s.tracer.enqueue(&data)
+	}
+}
+
+// Tracer 创建 span 并批量导出
+type Tracer struct {
+	ServiceName string
+	// SampleRatio 新链路的采样比例，0~1；从上游继续的链路跟随上游的采样标记
+	SampleRatio float64
+
+	exporter  Exporter
+	queue     chan *SpanData
+	done      chan struct{}
+	dropped   atomic.Int64
+	batchSize int
+
+	mu     sync.RWMutex // 保护 closed，关闭后结束的 span 直接丢弃
+	closed bool
+}
+
+// NewTracer 新建 Tracer，默认全部采样，每 5 秒或攒够 256 个 span 导出一次
+func NewTracer(serviceName string, exporter Exporter) *Tracer {
+	t := &Tracer{
+		ServiceName: serviceName,
+		SampleRatio: 1,
+		exporter:    exporter,
+		queue:       make(chan *SpanData, 4096),
+		done:        make(chan struct{}),
+		batchSize:   256,
+	}
+	go t.run(5 * time.Second)
+	return t
+}
+
+// Start 创建 span 并放入返回的 ctx：ctx 中有链路上下文时作为子 span，否则开始一条新链路
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{SpanID: newSpanID()}
+	var parentID SpanID
+	if parent.IsValid() {
+		sc.TraceID, sc.Flags, sc.TraceState = parent.TraceID, parent.Flags, parent.TraceState
+		parentID = parent.SpanID
+	} else {
+		sc.TraceID = newTraceID()
+		if t.sample(sc.TraceID) {
+			sc.Flags = FlagsSampled
+		}
+	}
+	span := &Span{tracer: t, data: SpanData{
+		Service:      t.ServiceName,
+		Name:         name,
+		Kind:         kind,
+		SpanContext:  sc,
+		ParentSpanID: parentID,
+		Start:        time.Now(),
+	}}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// sample 按 TraceID 的低 8 字节决定是否采样，同一条链路在各个服务的采样结果一致
+func (t *Tracer) sample(id TraceID) bool {
+	switch {
+	case t.SampleRatio >= 1:
+		return true
+	case t.SampleRatio <= 0:
+		return false
+	}
+	return binary.BigEndian.Uint64(id[8:]) < uint64(t.SampleRatio*math.MaxUint64)
+}
+
+// Dropped 返回因导出队列满而丢弃的 span 数
+func (t *Tracer) Dropped() int64 { return t.dropped.Load() }
+
+func (t *Tracer) enqueue(data *SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		t.dropped.Add(1)
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// Shutdown 导出队列中剩余的 span，ctx 超时时直接返回
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) run(interval time.Duration) {
+	defer close(t.done)
+	batch := make([]*SpanData, 0, t.batchSize)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			log.Printf("tracing: export %d spans failed: %v", len(batch), err)
+		}
+		cancel()
+		batch = make([]*SpanData, 0, t.batchSize)
+	}
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if batch = append(batch, data); len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
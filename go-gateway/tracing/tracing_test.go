@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryExporter 把导出的 span 保存在内存中
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (e *memoryExporter) Export(ctx context.Context, spans []*SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// flush 关闭 Tracer 并返回导出的全部 span
+func flush(t *testing.T, tracer *Tracer, e *memoryExporter) []*SpanData {
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.spans
+}
+
+// TestParseTraceparent 测试 W3C traceparent 的解析规则
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(valid)
+	if err != nil || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !sc.IsSampled() || sc.Traceparent() != valid {
+		t.Fatalf("parse %s got %+v, %v", valid, sc, err)
+	}
+	// 高版本允许追加字段
+	if _, err := ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future"); err != nil {
+		t.Errorf("want future version accepted, got %v", err)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g",
+	} {
+		if _, err := ParseTraceparent(invalid); !errors.Is(err, ErrInvalidTraceparent) {
+			t.Errorf("want %q rejected, got %v", invalid, err)
+		}
+	}
+}
+
+// TestSampling 测试新链路按比例采样，上游传入的链路跟随上游的采样标记
+func TestSampling(t *testing.T) {
+	tracer := NewTracer("test", &memoryExporter{})
+	tracer.SampleRatio = 0.25
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		if _, span := tracer.Start(context.Background(), "root", SpanKindInternal); span.SpanContext().IsSampled() {
+			sampled++
+		}
+	}
+	if sampled < 2000 || sampled > 3000 {
+		t.Errorf("want about 25%% sampled, got %d/10000", sampled)
+	}
+
+	tracer.SampleRatio = 0
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span := tracer.Start(ContextWithRemoteSpanContext(context.Background(), remote), "child", SpanKindInternal)
+	if !span.SpanContext().IsSampled() || span.SpanContext().TraceID != remote.TraceID {
+		t.Errorf("want child follows sampled parent, got %+v", span.SpanContext())
+	}
+}
+
+// TestHTTP 测试网关继续上游的链路，下游收到的 traceparent 指向网关的客户端 span
+func TestHTTP(t *testing.T) {
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	exporter := &memoryExporter{}
+	tracer := NewTracer("gateway", exporter)
+	transport := tracer.NewTransport(http.DefaultTransport)
+	handler := tracer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL+"/orders", nil)
+		res, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders?id=1", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TracestateHeader, "vendor=abc, ,other=1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := flush(t, tracer, exporter)
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got %d", len(spans))
+	}
+	client, server := spans[0], spans[1]
+	if server.Kind != SpanKindServer || server.ParentSpanID.String() != "00f067aa0ba902b7" ||
+		server.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.StatusCode != StatusError {
+		t.Errorf("unexpected server span %+v", server)
+	}
+	if client.Kind != SpanKindClient || client.ParentSpanID != server.SpanContext.SpanID ||
+		client.Attributes["http.status_code"] != http.StatusOK || client.Attributes["net.dial_ms"] == nil {
+		t.Errorf("unexpected client span %+v", client)
+	}
+	if got := upstreamHeader.Get(TraceparentHeader); got != client.SpanContext.Traceparent() {
+		t.Errorf("want upstream traceparent %s, got %s", client.SpanContext.Traceparent(), got)
+	}
+	if got := upstreamHeader.Get(TracestateHeader); got != "vendor=abc,other=1" {
+		t.Errorf("want tracestate forwarded, got %q", got)
+	}
+}
+
+// TestGRPC 测试客户端把链路上下文注入 metadata，服务端据此继续链路
+func TestGRPC(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer := NewTracer("order", exporter)
+	cc, err := grpc.NewClient("passthrough:///product", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		// 模拟服务端收到请求
+		incoming := metadata.NewIncomingContext(context.Background(), outgoing)
+		_, err := tracer.UnaryServerInterceptor()(incoming, req, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req any) (any, error) {
+				return nil, status.Error(codes.NotFound, "no such product")
+			})
+		return err
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "req-1")
+	err = tracer.UnaryClientInterceptor()(ctx, "/Product/ProductInfo", nil, nil, cc, invoker)
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("want NotFound, got %v", err)
+	}
+	if len(outgoing.Get(TraceparentHeader)) != 1 || outgoing.Get("x-request-id")[0] != "req-1" {
+		t.Errorf("unexpected outgoing metadata %v", outgoing)
+	}
+
+	spans := flush(t, tracer, exporter)
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans, got %d", len(spans))
+	}
+	server, client := spans[0], spans[1]
+	if server.ParentSpanID != client.SpanContext.SpanID || server.SpanContext.TraceID != client.SpanContext.TraceID ||
+		server.Attributes["rpc.grpc.status_code"] != int(codes.NotFound) || client.StatusCode != StatusError {
+		t.Errorf("unexpected spans server %+v client %+v", server, client)
+	}
+}
+
+// TestOTLPExporter 测试按 OTLP/HTTP JSON 编码发送
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]any
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer collector.Close()
+
+	start := time.Unix(1700000000, 0)
+	span := &SpanData{
+		Service:     "gateway",
+		Name:        "HTTP GET",
+		Kind:        SpanKindServer,
+		SpanContext: SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Flags: FlagsSampled},
+		Start:       start,
+		End:         start.Add(time.Millisecond),
+		Attributes:  map[string]any{"http.status_code": 200, "http.method": "GET"},
+	}
+	if err := NewOTLPExporter(collector.URL+"/v1/traces").Export(context.Background(), []*SpanData{span}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(body)
+	for _, want := range []string{
+		`"service.name"`, `"traceId":"01000000000000000000000000000000"`, `"spanId":"0200000000000000"`,
+		`"startTimeUnixNano":"1700000000000000000"`, `"intValue":"200"`, `"kind":2`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("want %s in %s", want, data)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"google.golang.org/grpc"
 	"log"
 	"net"
+	"os"
+	"sen-golang-study/go-gateway/tracing"
 	"sen-golang-study/golang/148_net/04_rpc/demo_product/protobufs/compiles"
 )
 
@@ -22,7 +24,12 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	server := grpc.NewServer()
+	// 从请求的 metadata 中继续订单服务传入的链路，span 输出到标准输出
+	tracer := tracing.NewTracer("product", tracing.NewWriterExporter(os.Stdout))
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(tracer.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(tracer.StreamServerInterceptor()),
+	)
 
 	// 将产品服务注册到gRPC服务中
 	compiles.RegisterProductServer(server, &ProductServer{})
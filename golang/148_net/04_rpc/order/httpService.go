@@ -24,7 +24,9 @@ var (
 func main() {
 	flag.Parse()
 	// 连接 grpc 服务器
-	conn, err := grpc.NewClient(*gRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// 调用产品服务时透传链路上下文
+	conn, err := grpc.NewClient(*gRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(traceUnaryInterceptor))
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -41,8 +43,9 @@ func main() {
 	service := http.NewServeMux()
 	service.HandleFunc("/orders", func(writer http.ResponseWriter, request *http.Request) {
 
-		// RPC的超时处理
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		// RPC的超时处理，并继续网关传入的链路
+		ctx := context.WithValue(request.Context(), traceKey{}, traceFromRequest(request))
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
 		defer cancel()
 
 		// 调用产品服务提供的gRPC接口，获取产品信息
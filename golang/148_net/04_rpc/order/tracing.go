@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// W3C Trace Context 透传
+//
+// 订单服务是独立的 module，没有引用网关的 tracing 包，这里只实现链路上下文的传递：
+// 从 HTTP 请求头的 traceparent 继续网关传入的链路（没有或无效时开始新链路），
+// 调用 gRPC 时为每次调用生成新的 span ID，通过 metadata 传给产品服务
+
+var traceparentRE = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})(-.*)?$`)
+
+type traceContext struct {
+	traceID string
+	spanID  string
+	flags   string
+	state   string
+}
+
+func (tc traceContext) traceparent() string {
+	return "00-" + tc.traceID + "-" + tc.spanID + "-" + tc.flags
+}
+
+type traceKey struct{}
+
+// traceFromRequest 继续请求头中的链路，本服务处理请求的 span 使用新的 span ID
+func traceFromRequest(req *http.Request) traceContext {
+	tc := traceContext{traceID: randomHex(16), flags: "01"}
+	if values := req.Header.Values("traceparent"); len(values) == 1 {
+		m := traceparentRE.FindStringSubmatch(values[0])
+		if m != nil && m[1] != "ff" && (m[1] != "00" || m[5] == "") &&
+			strings.Trim(m[2], "0") != "" && strings.Trim(m[3], "0") != "" {
+			tc.traceID, tc.flags = m[2], m[4]
+			tc.state = strings.Join(req.Header.Values("tracestate"), ",")
+		}
+	}
+	tc.spanID = randomHex(8)
+	return tc
+}
+
+// traceUnaryInterceptor 把链路上下文注入 gRPC 调用的 metadata
+func traceUnaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if tc, ok := ctx.Value(traceKey{}).(traceContext); ok {
+		parent := tc.spanID
+		tc.spanID = randomHex(8)
+		ctx = metadata.AppendToOutgoingContext(ctx, "traceparent", tc.traceparent())
+		if tc.state != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "tracestate", tc.state)
+		}
+		log.Printf("trace %s: call %s, span %s, parent %s", tc.traceID, method, tc.spanID, parent)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}